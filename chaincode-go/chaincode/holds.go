@@ -0,0 +1,230 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+const (
+	// HoldLegal keeps entries until the hold is released.
+	HoldLegal = "legal"
+	// HoldRetention keeps entries until its RetainUntil date.
+	HoldRetention = "retention"
+
+	// auditorAttribute is the certificate attribute that allows an identity
+	// to manage holds, issued by the CA with --id.attrs role=auditor:ecert
+	auditorAttribute = "role"
+	auditorRole      = "auditor"
+)
+
+// Hold keeps the log entries of a source, or of every source when Source is
+// empty, from being purged. FromLogID and ToLogID bound the LogIDs it covers,
+// inclusively; since LogIDs start with their timestamp, a bound such as
+// "asset:20240101" selects a time range.
+// Insert struct field in alphabetic order => to achieve determinism across languages
+type Hold struct {
+	CreatedBy   string `json:"CreatedBy"`
+	FromLogID   string `json:"FromLogID,omitempty"`
+	HoldID      string `json:"HoldID"`
+	Kind        string `json:"Kind"`
+	Reason      string `json:"Reason"`
+	ReleasedAt  string `json:"ReleasedAt,omitempty"`
+	ReleasedBy  string `json:"ReleasedBy,omitempty"`
+	RetainUntil string `json:"RetainUntil,omitempty"`
+	Source      string `json:"Source"`
+	Timestamp   string `json:"Timestamp"`
+	ToLogID     string `json:"ToLogID,omitempty"`
+}
+
+// HoldChange is one version of a hold in its history.
+type HoldChange struct {
+	TxID      string `json:"TxID"`
+	Timestamp string `json:"Timestamp"`
+	Hold      *Hold  `json:"Hold"`
+}
+
+// PlaceLegalHold places a hold on the entries of source within the LogID
+// range until it is released, and returns its key.
+func (s *SmartContract) PlaceLegalHold(ctx contractapi.TransactionContextInterface, source string, fromLogID string, toLogID string, reason string) (string, error) {
+	return placeHold(ctx, Hold{
+		Kind:      HoldLegal,
+		Source:    source,
+		FromLogID: fromLogID,
+		ToLogID:   toLogID,
+		Reason:    reason,
+	})
+}
+
+// SetRetainUntil keeps the entries of source within the LogID range until the
+// given RFC 3339 date, and returns the key of the retention hold.
+func (s *SmartContract) SetRetainUntil(ctx contractapi.TransactionContextInterface, source string, fromLogID string, toLogID string, retainUntil string, reason string) (string, error) {
+	until, err := time.Parse(time.RFC3339, retainUntil)
+	if err != nil {
+		return "", fmt.Errorf("invalid retain-until date: %v", err)
+	}
+
+	return placeHold(ctx, Hold{
+		Kind:        HoldRetention,
+		Source:      source,
+		FromLogID:   fromLogID,
+		ToLogID:     toLogID,
+		RetainUntil: until.UTC().Format(time.RFC3339),
+		Reason:      reason,
+	})
+}
+
+func placeHold(ctx contractapi.TransactionContextInterface, hold Hold) (string, error) {
+	auditor, err := assertAuditor(ctx)
+	if err != nil {
+		return "", err
+	}
+	if hold.FromLogID != "" && hold.ToLogID != "" && hold.FromLogID > hold.ToLogID {
+		return "", fmt.Errorf("hold range starts after it ends")
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	hold.HoldID = "hold:" + ctx.GetStub().GetTxID()
+	hold.CreatedBy = auditor
+	hold.Timestamp = txTime
+	if err := putHold(ctx, hold); err != nil {
+		return "", err
+	}
+	return hold.HoldID, nil
+}
+
+// ReleaseLegalHold releases a legal hold. The hold stays in the world state,
+// and its history records who placed and released it.
+func (s *SmartContract) ReleaseLegalHold(ctx contractapi.TransactionContextInterface, holdID string) error {
+	auditor, err := assertAuditor(ctx)
+	if err != nil {
+		return err
+	}
+
+	hold, err := s.ReadHold(ctx, holdID)
+	if err != nil {
+		return err
+	}
+	if hold.Kind != HoldLegal {
+		return fmt.Errorf("%s is a %s hold, which expires instead of being released", holdID, hold.Kind)
+	}
+	if hold.ReleasedAt != "" {
+		return fmt.Errorf("the hold %s is already released", holdID)
+	}
+
+	if hold.ReleasedAt, err = txTimestamp(ctx); err != nil {
+		return err
+	}
+	hold.ReleasedBy = auditor
+	return putHold(ctx, *hold)
+}
+
+// ReadHold returns the hold stored in the world state with given key.
+func (s *SmartContract) ReadHold(ctx contractapi.TransactionContextInterface, holdID string) (*Hold, error) {
+	holdJSON, err := ctx.GetStub().GetState(holdID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if holdJSON == nil {
+		return nil, fmt.Errorf("the hold %s does not exist", holdID)
+	}
+
+	var hold Hold
+	if err := json.Unmarshal(holdJSON, &hold); err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// GetHolds returns every hold, released and expired ones included.
+func (s *SmartContract) GetHolds(ctx contractapi.TransactionContextInterface) ([]*Hold, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByRange("hold:", "hold;")
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	holds := []*Hold{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var hold Hold
+		if err := json.Unmarshal(queryResponse.Value, &hold); err != nil {
+			return nil, err
+		}
+		holds = append(holds, &hold)
+	}
+
+	return holds, nil
+}
+
+// GetHoldHistory returns every version of a hold, oldest first.
+func (s *SmartContract) GetHoldHistory(ctx contractapi.TransactionContextInterface, holdID string) ([]*HoldChange, error) {
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(holdID)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var changes []*HoldChange
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		change := HoldChange{TxID: modification.GetTxId()}
+		if timestamp := modification.GetTimestamp(); timestamp != nil {
+			change.Timestamp = timestamp.AsTime().UTC().Format(time.RFC3339)
+		}
+		if !modification.GetIsDelete() {
+			var hold Hold
+			if err := json.Unmarshal(modification.GetValue(), &hold); err != nil {
+				return nil, err
+			}
+			change.Hold = &hold
+		}
+		changes = append(changes, &change)
+	}
+
+	// the history is returned newest first
+	for i, j := 0, len(changes)-1; i < j; i, j = i+1, j-1 {
+		changes[i], changes[j] = changes[j], changes[i]
+	}
+	return changes, nil
+}
+
+// assertAuditor returns the ID of the submitting identity when it carries the
+// auditor role.
+func assertAuditor(ctx contractapi.TransactionContextInterface) (string, error) {
+	identity := ctx.GetClientIdentity()
+	if err := identity.AssertAttributeValue(auditorAttribute, auditorRole); err != nil {
+		return "", fmt.Errorf("only auditors may manage holds: %v", err)
+	}
+	return identity.GetID()
+}
+
+func txTimestamp(ctx contractapi.TransactionContextInterface) (string, error) {
+	txTime, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return "", err
+	}
+	return txTime.AsTime().UTC().Format(time.RFC3339), nil
+}
+
+func putHold(ctx contractapi.TransactionContextInterface, hold Hold) error {
+	holdJSON, err := json.Marshal(hold)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(hold.HoldID, holdJSON)
+}
@@ -0,0 +1,233 @@
+package chaincode
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ledgerStub keeps the world state and the history of every key written
+// through it. Calls the tests do not need panic on the nil interface.
+type ledgerStub struct {
+	shim.ChaincodeStubInterface
+	txID    string
+	txTime  time.Time
+	state   map[string][]byte
+	history map[string][]*queryresult.KeyModification
+}
+
+func newLedgerStub() *ledgerStub {
+	return &ledgerStub{state: map[string][]byte{}, history: map[string][]*queryresult.KeyModification{}}
+}
+
+// begin starts the next transaction.
+func (s *ledgerStub) begin(txID string, txTime time.Time) {
+	s.txID = txID
+	s.txTime = txTime
+}
+
+func (s *ledgerStub) GetTxID() string { return s.txID }
+
+func (s *ledgerStub) GetTxTimestamp() (*timestamppb.Timestamp, error) {
+	return timestamppb.New(s.txTime), nil
+}
+
+func (s *ledgerStub) GetState(key string) ([]byte, error) { return s.state[key], nil }
+
+func (s *ledgerStub) PutState(key string, value []byte) error {
+	s.state[key] = value
+	s.history[key] = append(s.history[key], &queryresult.KeyModification{
+		TxId:      s.txID,
+		Value:     value,
+		Timestamp: timestamppb.New(s.txTime),
+	})
+	return nil
+}
+
+// GetHistoryForKey returns the modifications newest first, as peers do.
+func (s *ledgerStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	var modifications []*queryresult.KeyModification
+	for i := len(s.history[key]) - 1; i >= 0; i-- {
+		modifications = append(modifications, s.history[key][i])
+	}
+	return &historyIterator{modifications: modifications}, nil
+}
+
+type historyIterator struct {
+	modifications []*queryresult.KeyModification
+}
+
+func (it *historyIterator) HasNext() bool { return len(it.modifications) > 0 }
+
+func (it *historyIterator) Close() error { return nil }
+
+func (it *historyIterator) Next() (*queryresult.KeyModification, error) {
+	next := it.modifications[0]
+	it.modifications = it.modifications[1:]
+	return next, nil
+}
+
+// clientIdentity is a submitter with the given certificate attributes.
+type clientIdentity struct {
+	id    string
+	attrs map[string]string
+}
+
+func (c clientIdentity) GetID() (string, error) { return c.id, nil }
+
+func (c clientIdentity) GetMSPID() (string, error) { return "Org1MSP", nil }
+
+func (c clientIdentity) GetAttributeValue(name string) (string, bool, error) {
+	value, ok := c.attrs[name]
+	return value, ok, nil
+}
+
+func (c clientIdentity) AssertAttributeValue(name, value string) error {
+	if got, ok := c.attrs[name]; !ok || got != value {
+		return fmt.Errorf("attribute %s is %q, not %q", name, got, value)
+	}
+	return nil
+}
+
+func (c clientIdentity) GetX509Certificate() (*x509.Certificate, error) { return nil, nil }
+
+func transactionContext(stub *ledgerStub, identity clientIdentity) *contractapi.TransactionContext {
+	ctx := &contractapi.TransactionContext{}
+	ctx.SetStub(stub)
+	ctx.SetClientIdentity(identity)
+	return ctx
+}
+
+func TestHoldsRequireAuditor(t *testing.T) {
+	auditor := clientIdentity{id: "auditor1", attrs: map[string]string{"role": "auditor"}}
+	writer := clientIdentity{id: "writer1", attrs: map[string]string{"role": "writer"}}
+	anonymous := clientIdentity{id: "user1"}
+	contract := &SmartContract{}
+
+	place := func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.PlaceLegalHold(ctx, "app", "asset:20240101", "asset:20240201", "case 42")
+		return err
+	}
+	retain := func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.SetRetainUntil(ctx, "app", "", "", "2030-01-01T00:00:00Z", "audit")
+		return err
+	}
+	placeReversed := func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.PlaceLegalHold(ctx, "app", "asset:20240201", "asset:20240101", "case 42")
+		return err
+	}
+	release := func(ctx contractapi.TransactionContextInterface) error {
+		return contract.ReleaseLegalHold(ctx, "hold:tx-0")
+	}
+
+	tests := []struct {
+		name        string
+		identity    clientIdentity
+		call        func(ctx contractapi.TransactionContextInterface) error
+		wantErr     string
+		wantWritten bool
+	}{
+		{name: "auditor places legal hold", identity: auditor, call: place, wantWritten: true},
+		{name: "auditor sets retention", identity: auditor, call: retain, wantWritten: true},
+		{name: "auditor releases legal hold", identity: auditor, call: release, wantWritten: true},
+		{name: "reversed range", identity: auditor, call: placeReversed, wantErr: "starts after it ends"},
+		{name: "writer places legal hold", identity: writer, call: place, wantErr: "only auditors"},
+		{name: "writer sets retention", identity: writer, call: retain, wantErr: "only auditors"},
+		{name: "writer releases legal hold", identity: writer, call: release, wantErr: "only auditors"},
+		{name: "no role attribute", identity: anonymous, call: place, wantErr: "only auditors"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// every case starts from a single legal hold placed in tx-0
+			stub := newLedgerStub()
+			stub.begin("tx-0", time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC))
+			if err := place(transactionContext(stub, auditor)); err != nil {
+				t.Fatal(err)
+			}
+			stub.begin("tx-1", time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC))
+
+			err := test.call(transactionContext(stub, test.identity))
+			if test.wantErr == "" && err != nil || test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Fatalf("error = %v, want %q", err, test.wantErr)
+			}
+
+			written := false
+			for _, modifications := range stub.history {
+				for _, modification := range modifications {
+					written = written || modification.TxId == "tx-1"
+				}
+			}
+			if written != test.wantWritten {
+				t.Errorf("wrote to the ledger = %v, want %v", written, test.wantWritten)
+			}
+		})
+	}
+}
+
+func TestGetHoldHistory(t *testing.T) {
+	auditor := clientIdentity{id: "auditor1", attrs: map[string]string{"role": "auditor"}}
+	otherAuditor := clientIdentity{id: "auditor2", attrs: map[string]string{"role": "auditor"}}
+	placedAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	releasedAt := placedAt.Add(24 * time.Hour)
+	contract := &SmartContract{}
+
+	tests := []struct {
+		name         string
+		release      bool
+		wantTxIDs    []string
+		wantReleased []string
+	}{
+		{name: "placed", wantTxIDs: []string{"tx-place"}, wantReleased: []string{""}},
+		{
+			name:         "placed and released",
+			release:      true,
+			wantTxIDs:    []string{"tx-place", "tx-release"},
+			wantReleased: []string{"", "auditor2"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub := newLedgerStub()
+			stub.begin("tx-place", placedAt)
+			holdID, err := contract.PlaceLegalHold(transactionContext(stub, auditor), "app", "", "", "case 42")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.release {
+				stub.begin("tx-release", releasedAt)
+				if err := contract.ReleaseLegalHold(transactionContext(stub, otherAuditor), holdID); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			changes, err := contract.GetHoldHistory(transactionContext(stub, auditor), holdID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(changes) != len(test.wantTxIDs) {
+				t.Fatalf("GetHoldHistory() returned %d changes, want %d", len(changes), len(test.wantTxIDs))
+			}
+			for i, change := range changes {
+				if change.TxID != test.wantTxIDs[i] || change.Hold.ReleasedBy != test.wantReleased[i] {
+					t.Errorf("change %d = %s released by %q, want %s released by %q", i, change.TxID, change.Hold.ReleasedBy, test.wantTxIDs[i], test.wantReleased[i])
+				}
+				// the placing auditor and time survive the release
+				if change.Hold.CreatedBy != "auditor1" || change.Hold.Timestamp != placedAt.Format(time.RFC3339) {
+					t.Errorf("change %d hold = %+v", i, change.Hold)
+				}
+			}
+			if test.release && changes[len(changes)-1].Timestamp != releasedAt.Format(time.RFC3339) {
+				t.Errorf("latest change at %s, want %s", changes[len(changes)-1].Timestamp, releasedAt.Format(time.RFC3339))
+			}
+		})
+	}
+}
@@ -18,12 +18,15 @@ type SmartContract struct {
 // Asset describes basic details of what makes up a simple asset
 // Insert struct field in alphabetic order => to achieve determinism across languages
 // golang keeps the order when marshal to json but doesn't order automatically
+// FieldHashes holds a separate hash per log entry field, so that a tampered entry
+// can be traced to the fields that changed
 type Asset struct {
-	BlobPath  string `json:"BlobPath"`
-	Hash      string `json:"Hash"`
-	LogID     string `json:"LogID"`
-	Source    string `json:"Source"`
-	Timestamp string `json:"Timestamp"`
+	BlobPath    string            `json:"BlobPath"`
+	FieldHashes map[string]string `json:"FieldHashes,omitempty"`
+	Hash        string            `json:"Hash"`
+	LogID       string            `json:"LogID"`
+	Source      string            `json:"Source"`
+	Timestamp   string            `json:"Timestamp"`
 }
 
 type PaginatedQueryResult struct {
@@ -33,11 +36,26 @@ type PaginatedQueryResult struct {
 	HasNextPage         bool     `json:"hasNextPage"`
 }
 
-// CreateAsset issues a new asset to the world state with given details.
-func (s *SmartContract) CreateAsset(ctx contractapi.TransactionContextInterface, blobPath string, hash string, source string) error {
+// CreateAsset issues a new asset to the world state with given details and returns its key.
+func (s *SmartContract) CreateAsset(ctx contractapi.TransactionContextInterface, blobPath string, hash string, source string) (string, error) {
+	return createAsset(ctx, blobPath, hash, source, nil)
+}
+
+// CreateAssetWithFields issues a new asset that also carries the hash of each field of
+// the log entry, given as a JSON object of field name to hash, and returns its key.
+func (s *SmartContract) CreateAssetWithFields(ctx contractapi.TransactionContextInterface, blobPath string, hash string, source string, fieldHashesJSON string) (string, error) {
+	var fieldHashes map[string]string
+	if err := json.Unmarshal([]byte(fieldHashesJSON), &fieldHashes); err != nil {
+		return "", fmt.Errorf("invalid field hashes: %v", err)
+	}
+
+	return createAsset(ctx, blobPath, hash, source, fieldHashes)
+}
+
+func createAsset(ctx contractapi.TransactionContextInterface, blobPath string, hash string, source string, fieldHashes map[string]string) (string, error) {
 	txTime, err := ctx.GetStub().GetTxTimestamp()
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	// create unique key based on timestamp and uuid (using timestamp to help with ordering)
@@ -48,26 +66,49 @@ func (s *SmartContract) CreateAsset(ctx contractapi.TransactionContextInterface,
 
 	exists, err := assetExists(ctx, key)
 	if err != nil {
-		return err
+		return "", err
 	}
 	if exists {
-		return fmt.Errorf("the asset %s already exists", key)
+		return "", fmt.Errorf("the asset %s already exists", key)
 	}
 
 	asset := Asset{
-		LogID:     key,
-		BlobPath:  blobPath,
-		Hash:      hash,
-		Source:    source,
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		LogID:       key,
+		BlobPath:    blobPath,
+		FieldHashes: fieldHashes,
+		Hash:        hash,
+		Source:      source,
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
 	}
 
 	assetJSON, err := json.Marshal(asset)
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	if err := ctx.GetStub().PutState(key, assetJSON); err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
+
+// ReadAsset returns the asset stored in the world state with given key.
+func (s *SmartContract) ReadAsset(ctx contractapi.TransactionContextInterface, key string) (*Asset, error) {
+	assetJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if assetJSON == nil {
+		return nil, fmt.Errorf("the asset %s does not exist", key)
+	}
+
+	var asset Asset
+	if err := json.Unmarshal(assetJSON, &asset); err != nil {
+		return nil, err
 	}
 
-	return ctx.GetStub().PutState(key, assetJSON)
+	return &asset, nil
 }
 
 // AssetExists returns true when asset with given ID exists in world state
@@ -82,7 +123,8 @@ func assetExists(ctx contractapi.TransactionContextInterface, id string) (bool,
 
 // GetAllAssets returns all assets found in world state
 func (s *SmartContract) GetAllAssets(ctx contractapi.TransactionContextInterface, sourceFilter string) ([]*Asset, error) {
-	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	// ';' follows ':', so the range holds every asset key and nothing else
+	resultsIterator, err := ctx.GetStub().GetStateByRange("asset:", "asset;")
 	if err != nil {
 		return nil, err
 	}
@@ -112,6 +154,7 @@ func (s *SmartContract) GetAllAssets(ctx contractapi.TransactionContextInterface
 func (s *SmartContract) GetAssetsWithFilter(ctx contractapi.TransactionContextInterface, source string, pageSize int, bookmark string) (*PaginatedQueryResult, error) {
 	query := fmt.Sprintf(`{
 			"selector": {
+					"LogID": {"$exists": true},
 					"Source": "%s"
 			}
 		}`, source)
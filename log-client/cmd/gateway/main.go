@@ -1,41 +1,167 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"log-client/internal"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
-var logPath = ""
-
 func main() {
-	// get smart contract connection
-	_, _, contract := internal.GetConnection()
-	defer internal.CloseConnection()
+	// stop intake on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// fail fast on a broken authentication setup, before connecting anywhere
+	authConfig := internal.AuthConfigFromEnv()
+	auth, err := internal.NewAuth(authConfig)
+	if err != nil {
+		log.Fatal("Failed to configure authentication: ", err)
+	}
+	tlsConfig, err := authConfig.TLSConfig()
+	if err != nil {
+		log.Fatal("Failed to configure TLS: ", err)
+	}
+	// without authentication only local callers reach the API
+	listenAddr := ":" + internal.PORT
+	if !auth.Enabled() {
+		listenAddr = "127.0.0.1:" + internal.PORT
+		log.Println("Authentication is disabled, serving localhost only, set AUTH_METHODS to require it")
+	}
+	if _, err := internal.DefaultRedactor(); err != nil {
+		log.Fatal("Failed to configure redaction: ", err)
+	}
+	if _, err := internal.DefaultEncryptor(); err != nil {
+		log.Fatal("Failed to configure encryption: ", err)
+	}
+	retentionConfig, err := internal.RetentionConfigFromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure retention: ", err)
+	}
+	archiveStore, err := internal.DefaultArchiveStore()
+	if err != nil {
+		log.Fatal("Failed to configure archive store: ", err)
+	}
+	if len(retentionConfig.Policies) > 0 && archiveStore == nil {
+		log.Fatal("RETENTION_POLICIES is set but neither ARCHIVE_DIR nor ARCHIVE_S3_BUCKET is")
+	}
+
+	// refuse to run against a schema this build was not written for, an
+	// unreachable database only makes the gateway report not ready
+	if _, err := internal.InitDB(); errors.Is(err, internal.ErrSchemaMismatch) {
+		log.Fatal("Database schema does not match: ", err)
+	} else if err != nil {
+		log.Println("Database not reachable yet: ", err)
+	}
+
+	// background work outlives intake so in-flight submissions can drain
+	background, cancelBackground := context.WithCancel(context.Background())
+	defer cancelBackground()
+	var workers sync.WaitGroup
+
+	// get smart contract connection, the gateway still serves indexed reads
+	// and reports not ready when no peer can be reached
+	connection, err := internal.GetConnection(ctx)
+	if err != nil {
+		log.Println("Failed to connect to Fabric gateway: ", err)
+	} else {
+		connectCtx, cancelConnect := context.WithTimeout(ctx, internal.ConnectTimeout)
+		if err := connection.WaitForReady(connectCtx); err != nil {
+			log.Println("Fabric gateway not ready yet: ", err)
+		}
+		cancelConnect()
+
+		// health-check peers and fail over while the gateway runs
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			connection.Monitor(background)
+		}()
+	}
+
+	// deliver tamper and anchoring alerts to the configured sinks
+	alerts := internal.StartAlerting(background, internal.AlertConfigFromEnv())
+
+	// verify anchored entries against the ledger and their off-chain rows in the background
+	if connection != nil {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			internal.RunIntegrityScanner(background, connection, internal.ScannerConfigFromEnv())
+		}()
+	}
+
+	// move entries past their retention into the archive store
+	if len(retentionConfig.Policies) > 0 {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			internal.RunRetention(background, retentionConfig, archiveStore)
+		}()
+	}
+
+	// keep the local anchor index in sync with the ledger
+	if connection != nil {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			internal.RunIndexer(background, connection)
+		}()
+	}
+
+	writer := internal.NewWriter(background, connection)
+	watcher := &fileWatcher{}
+
+	// accept syslog and OTLP/gRPC alongside the HTTP API, stopping with the rest of intake
+	var intake sync.WaitGroup
+	if syslogConfig := internal.SyslogConfigFromEnv(); syslogConfig.Enabled() && connection != nil {
+		intake.Add(1)
+		go func() {
+			defer intake.Done()
+			if err := internal.RunSyslogReceiver(ctx, syslogConfig, writer); err != nil {
+				log.Println("Syslog receiver failed: ", err)
+			}
+		}()
+	}
+
+	if otlpConfig := internal.OTLPConfigFromEnv(); otlpConfig.GRPCAddr != "" && connection != nil {
+		intake.Add(1)
+		go func() {
+			defer intake.Done()
+			if err := internal.RunOTLPReceiver(ctx, otlpConfig, writer, auth, tlsConfig); err != nil {
+				log.Println("OTLP receiver failed: ", err)
+			}
+		}()
+	}
 
 	r := gin.Default()
 	r.Use(cors.New(cors.Config{
-		AllowOrigins: []string{"*"},
+		AllowOrigins: authConfig.AllowedOrigins,
 		AllowMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders: []string{"Origin", "Content-Type"},
+		AllowHeaders: []string{"Origin", "Content-Type", "Authorization", "X-API-Key", "Idempotency-Key", "Prefer"},
 	}))
 
-	stop := make(chan struct{})
+	// health probes stay public, every other route needs a principal
+	api := r.Group("/", authenticate(auth))
 
 	// set logPath from request body
-	r.POST("/settings/log", func(c *gin.Context) {
-		var json struct {
-			Path string `json:"path" binding:"required"`
-		}
+	api.POST("/settings/log", requireRole(internal.RoleAdmin), requireConnection(connection), func(c *gin.Context) {
+		var json watchSettings
 
 		if err := c.ShouldBindJSON(&json); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -48,23 +174,223 @@ func main() {
 			return
 		}
 
-		logPath = json.Path
+		if json.Source == "" {
+			json.Source = "gateway-client"
+		}
+		// transact as the source's own identity unless one is given
+		if json.Identity == "" {
+			json.Identity = connection.IdentityForSource(json.Source)
+		}
+		if err := connection.LoadIdentity(json.Identity); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if json.Parser == "" {
+			json.Parser = internal.DefaultParser
+		}
+		parser, err := internal.LookupParser(json.Parser)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// join multi-line entries as configured by the environment unless given
+		if json.Multiline == nil {
+			json.Multiline = newMultilineSettings(internal.MultilineConfigFromEnv())
+		}
+		multiline, err := json.Multiline.config()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		multiline.QuotedRecords = internal.QuotedRecords(json.Parser)
+		redactor, err := json.redactor()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		options := internal.WriteOptions{Parser: parser, Redactor: redactor}
 
 		// stop previous watcher and start new one
-		close(stop)
-		stop = make(chan struct{})
-		go LogWriter(contract, stop)
+		if err := watcher.Start(ctx, json, options, multiline, writer); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
 		c.JSON(http.StatusOK, gin.H{"status": "log path set"})
 	})
 
 	// get logPath
-	r.GET("/settings/log", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"path": logPath})
+	api.GET("/settings/log", requireRole(internal.RoleAdmin), func(c *gin.Context) {
+		c.JSON(http.StatusOK, watcher.Settings())
+	})
+
+	// reload a wallet identity after it was deleted or re-imported
+	api.POST("/identities/:name/reload", requireRole(internal.RoleAdmin), requireConnection(connection), func(c *gin.Context) {
+		if err := connection.LoadIdentity(c.Param("name")); errors.Is(err, internal.ErrIdentityNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "identity reloaded"})
+	})
+
+	// list the data keys that encrypt stored content, optionally of one source
+	api.GET("/keys", requireRole(internal.RoleAdmin), func(c *gin.Context) {
+		keys, err := internal.ListDataKeys(c.Query("source"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, keys)
+	})
+
+	// crypto-shred a data key, erasing the content it encrypts while the
+	// anchors still prove the entries existed
+	api.DELETE("/keys/:keyId", requireRole(internal.RoleAdmin), func(c *gin.Context) {
+		if err := internal.ShredDataKey(c.Param("keyId")); errors.Is(err, internal.ErrDataKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		} else if errors.Is(err, internal.ErrHeld) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "data key shredded"})
+	})
+
+	// retention policies and archive state per source
+	api.GET("/archive", requireRole(internal.RoleAdmin), func(c *gin.Context) {
+		state, err := internal.GetArchiveState(retentionConfig)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, state)
 	})
 
-	// read logs from chain
-	r.GET("/log", func(c *gin.Context) {
+	// archive segments, optionally of one source
+	api.GET("/archive/segments", requireRole(internal.RoleAdmin), func(c *gin.Context) {
+		segments, err := internal.ListArchiveSegments(c.Query("source"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, segments)
+	})
+
+	// push a single entry, answering with its receipt once committed or a
+	// pending token in async mode
+	api.POST("/log", requireRole(internal.RoleWriter), requireConnection(connection), func(c *gin.Context) {
+		var input internal.LogInput
+		if err := json.NewDecoder(http.MaxBytesReader(c.Writer, c.Request.Body, internal.IngestBodyLimit)).Decode(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if input.IdempotencyKey == "" {
+			input.IdempotencyKey = c.GetHeader("Idempotency-Key")
+		}
+		if !principalFrom(c).Allows(internal.RoleWriter, input.Source) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "not allowed to write source " + input.Source})
+			return
+		}
+
+		async := isAsync(c)
+		receipt, err := writer.Ingest(input, async)
+		switch {
+		case errors.Is(err, internal.ErrInvalidLogInput):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, internal.ErrWriterClosed):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		case receipt == nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		case err != nil:
+			// stored off-chain but not anchored
+			c.JSON(http.StatusBadGateway, receipt)
+		case receipt.Status == internal.ReceiptPending:
+			c.JSON(http.StatusAccepted, receipt)
+		case receipt.Duplicate:
+			c.JSON(http.StatusOK, receipt)
+		default:
+			c.JSON(http.StatusCreated, receipt)
+		}
+	})
+
+	// push a JSON array or NDJSON batch of entries, answering with a receipt per entry
+	api.POST("/log/batch", requireRole(internal.RoleWriter), requireConnection(connection), func(c *gin.Context) {
+		ndjson := strings.HasPrefix(c.ContentType(), "application/x-ndjson")
+		inputs, err := internal.DecodeLogInputs(http.MaxBytesReader(c.Writer, c.Request.Body, internal.IngestBodyLimit), ndjson)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(inputs) > internal.IngestBatchLimit {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("batch exceeds %d entries", internal.IngestBatchLimit)})
+			return
+		}
+
+		principal := principalFrom(c)
+		for _, input := range inputs {
+			if !principal.Allows(internal.RoleWriter, input.Source) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "not allowed to write source " + input.Source})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"receipts": writer.IngestBatch(inputs, isAsync(c))})
+	})
+
+	// OTLP/HTTP logs receiver, answering in the encoding of the request
+	api.POST("/v1/logs", requireRole(internal.RoleWriter), requireConnection(connection), func(c *gin.Context) {
+		request, err := internal.DecodeOTLPRequest(c.Request.Body, c.ContentType(), c.GetHeader("Content-Encoding"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		response := internal.ExportOTLPLogs(writer, request, principalFrom(c))
+		if c.ContentType() == "application/json" {
+			data, err := protojson.Marshal(response)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.Data(http.StatusOK, "application/json", data)
+			return
+		}
+		c.ProtoBuf(http.StatusOK, response)
+	})
+
+	// look up the receipt behind a pending token
+	api.GET("/log/receipt/:token", func(c *gin.Context) {
+		receipt, err := internal.LoadReceipt(c.Param("token"))
+		if errors.Is(err, internal.ErrReceiptNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		principal := principalFrom(c)
+		if !principal.Allows(internal.RoleWriter, receipt.Source) && !principal.Allows(internal.RoleReader, receipt.Source) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "not allowed to read source " + receipt.Source})
+			return
+		}
+
+		c.JSON(http.StatusOK, receipt)
+	})
+
+	// read logs from the local anchor index
+	api.GET("/log", requireRole(internal.RoleReader), func(c *gin.Context) {
 		source := c.Query("source")
 		pageSize := c.Query("pageSize")
 		bookmark := c.Query("bookmark")
@@ -80,80 +406,111 @@ func main() {
 		pageSizeInt, err := strconv.Atoi(pageSize)
 		if err != nil || pageSizeInt <= 0 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid pageSize"})
+			return
 		}
 
-		var logs []internal.LogEntry
-		var hashes []string
-		var hasNextPage bool
+		// only return sources the caller may read
+		principal := principalFrom(c)
+		if source != "" && !principal.Allows(internal.RoleReader, source) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "not allowed to read source " + source})
+			return
+		}
+
+		fields, err := internal.ParseFieldPredicates(c.QueryArray("field"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-		if query != "" || startDate != "" || endDate != "" {
-			logs, hashes, err = internal.ReadLogs(contract, source)
-			hasNextPage = false
+		filter := internal.IndexFilter{
+			Source:   source,
+			Query:    strings.TrimSpace(query),
+			Fields:   fields,
+			PageSize: pageSizeInt,
+			Bookmark: bookmark,
+		}
 
-			var startT *time.Time
-			var endT *time.Time
+		if sources, all := principal.SourcesFor(internal.RoleReader); !all {
+			filter.Sources = sources
+		}
 
-			if startDate != "" {
-				t, err := internal.ParseDate(startDate)
-				if err != nil {
-					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-					return
-				}
-				startT = t
+		if startDate != "" {
+			t, err := internal.ParseDate(startDate)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
 			}
+			filter.StartDate = t
+		}
 
-			if endDate != "" {
-				t, err := internal.ParseDate(endDate)
-				if err != nil {
-					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-					return
-				}
-				endT = t
+		if endDate != "" {
+			t, err := internal.ParseDate(endDate)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
 			}
+			filter.EndDate = t
+		}
 
-			// filter logs and hashes (keep indexes aligned)
-			filteredLogs := []internal.LogEntry{}
-			filteredHashes := []string{}
-			q := strings.ToLower(strings.TrimSpace(query))
-			for i, le := range logs {
-				// date filtering
-				if startT != nil && le.Timestamp.UTC().Before(*startT) {
-					continue
-				}
-				if endT != nil && le.Timestamp.UTC().After(*endT) {
-					continue
-				}
-
-				// query filtering (match content or source, case-insensitive)
-				if q != "" {
-					content := strings.ToLower(le.Content)
-					if !strings.Contains(content, q) {
-						continue
-					}
-				}
-
-				filteredLogs = append(filteredLogs, le)
-				filteredHashes = append(filteredHashes, hashes[i])
-			}
+		// serve reads from the local anchor index kept up to date by the indexer
+		anchors, bookmark, hasNextPage, err := internal.ReadIndexedLogs(filter)
+		if errors.Is(err, internal.ErrQueryEncrypted) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 
-			logs = filteredLogs
-			hashes = filteredHashes
-			bookmark = ""
-		} else {
-			logs, hashes, bookmark, hasNextPage, err = internal.ReadLogsWithPagination(contract, source, pageSizeInt, bookmark)
+		// with ?verify=true, check entries against the ledger instead of the index
+		if verify, _ := strconv.ParseBool(c.Query("verify")); verify {
+			if connection == nil {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "not connected to the Fabric gateway"})
+				return
+			}
+			anchors, err = internal.ChainAnchors(c.Request.Context(), connection, anchors)
+			if err != nil {
+				c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+				return
+			}
 		}
+
+		// load the page in one query and verify it concurrently, in order
+		results, err := internal.VerifyLogEntries(anchors)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-
 		detailedLogs := []internal.DetailedLogEntry{}
-		for i := range logs {
-			logEntry := &logs[i]
-			detaildLogEntry, _ := logEntry.GetDetailedLogEntry(hashes[i])
+		for i, result := range results {
+			detaildLogEntry := result.Entry
+			if errors.Is(result.Err, internal.ErrLogEntryMissing) {
+				// the off-chain row is missing, which is itself a failed validation
+				detaildLogEntry = &internal.DetailedLogEntry{ID: anchors[i].EntryID, IsValid: false}
+			} else if result.Err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": result.Err.Error()})
+				return
+			}
 			detailedLogs = append(detailedLogs, *detaildLogEntry)
 		}
 
+		// attach the latest result of the background integrity scanner
+		entryIDs := make([]uint, 0, len(detailedLogs))
+		for _, detailedLog := range detailedLogs {
+			entryIDs = append(entryIDs, detailedLog.ID)
+		}
+		statuses, err := internal.LoadIntegrityStatuses(entryIDs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for i := range detailedLogs {
+			if status, ok := statuses[detailedLogs[i].ID]; ok {
+				detailedLogs[i].LastVerifiedAt = &status.LastVerifiedAt
+				detailedLogs[i].VerificationResult = status.Result
+			}
+		}
+
 		type Response struct {
 			Logs        []internal.DetailedLogEntry `json:"logs"`
 			Bookmark    string                      `json:"bookmark"`
@@ -168,22 +525,373 @@ func main() {
 		c.JSON(http.StatusOK, response)
 	})
 
-	log.Println("Server starting on :" + internal.PORT)
-	r.Run(":" + internal.PORT)
-}
+	// summary of the background integrity scanner
+	api.GET("/integrity", requireRole(internal.RoleAuditor), func(c *gin.Context) {
+		summary, err := internal.GetIntegritySummary()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 
-// go routine to watch file and write new lines to ledger
-func LogWriter(contract *client.Contract, stop chan struct{}) {
-	internal.WatchFile(
-		logPath,
-		func(line string) {
-			err := internal.WriteLog(contract, line, "gateway-client")
-			if err != nil {
-				log.Println("Failed to write log: ", err)
-			} else {
-				log.Println("Wrote log entry to ledger for line: ", line)
+		c.JSON(http.StatusOK, summary)
+	})
+
+	// legal and retention holds the caller may audit, only active ones with ?active=true
+	api.GET("/holds", requireRole(internal.RoleAuditor), func(c *gin.Context) {
+		holds, err := internal.ListHolds(c.Query("active") == "true")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		principal := principalFrom(c)
+		visible := []internal.Hold{}
+		for _, hold := range holds {
+			if hold.Source == "" || principal.Allows(internal.RoleAuditor, hold.Source) {
+				visible = append(visible, hold)
 			}
-		},
-		stop,
-	)
+		}
+		c.JSON(http.StatusOK, visible)
+	})
+
+	// place a legal or retention hold on the ledger; holds on every source
+	// need an auditor of every source
+	api.POST("/holds", requireRole(internal.RoleAuditor), requireConnection(connection), func(c *gin.Context) {
+		var request internal.HoldRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !principalFrom(c).Allows(internal.RoleAuditor, request.Source) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "not allowed to hold source " + request.Source})
+			return
+		}
+
+		hold, err := internal.PlaceHold(c.Request.Context(), connection, request)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, hold)
+	})
+
+	// release a legal hold
+	api.DELETE("/holds/:holdId", requireRole(internal.RoleAuditor), requireConnection(connection), func(c *gin.Context) {
+		hold, err := internal.LoadHold(c.Param("holdId"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if !principalFrom(c).Allows(internal.RoleAuditor, hold.Source) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "not allowed to release holds of source " + hold.Source})
+			return
+		}
+
+		hold, err = internal.ReleaseHold(c.Request.Context(), connection, hold.HoldID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, hold)
+	})
+
+	// every version of a hold recorded on the ledger
+	api.GET("/holds/:holdId/history", requireRole(internal.RoleAuditor), requireConnection(connection), func(c *gin.Context) {
+		hold, err := internal.LoadHold(c.Param("holdId"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if hold.Source != "" && !principalFrom(c).Allows(internal.RoleAuditor, hold.Source) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "not allowed to audit source " + hold.Source})
+			return
+		}
+
+		history, err := internal.HoldHistory(c.Request.Context(), connection, hold.HoldID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, history)
+	})
+
+	// expose prometheus metrics
+	api.GET("/metrics", requireRole(internal.RoleAuditor), gin.WrapH(internal.MetricsHandler()))
+
+	// check an indexed entry against the ledger on demand
+	api.GET("/log/verify/:logId", requireRole(internal.RoleAuditor), requireConnection(connection), func(c *gin.Context) {
+		anchor, err := internal.LoadAnchor(c.Param("logId"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if !principalFrom(c).Allows(internal.RoleAuditor, anchor.Source) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "not allowed to verify source " + anchor.Source})
+			return
+		}
+
+		verification, err := internal.VerifyAnchor(c.Request.Context(), connection, c.Param("logId"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, verification)
+	})
+
+	// liveness: the process and its watcher goroutines are running
+	r.GET("/healthz", func(c *gin.Context) {
+		report := internal.RunHealthChecks(c.Request.Context(), map[string]internal.HealthCheck{
+			"watchers": internal.CheckWatchers(watcher.Path()),
+		})
+		writeHealthReport(c, report)
+	})
+
+	// readiness: every dependency needed to anchor and read logs is available
+	r.GET("/readyz", func(c *gin.Context) {
+		report := internal.RunHealthChecks(c.Request.Context(), map[string]internal.HealthCheck{
+			"peers":     internal.CheckPeers(connection),
+			"database":  internal.CheckDatabase(),
+			"chaincode": internal.CheckChaincode(connection),
+			"watchers":  internal.CheckWatchers(watcher.Path()),
+			"spool":     internal.CheckSpool(internal.SpoolBacklogLimit),
+		})
+		writeHealthReport(c, report)
+	})
+
+	server := &http.Server{Addr: listenAddr, Handler: r, TLSConfig: tlsConfig}
+	go func() {
+		log.Println("Server starting on " + listenAddr)
+		var err error
+		if tlsConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Println("Server failed: ", err)
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down gateway")
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), internal.ShutdownTimeout)
+	defer cancelShutdown()
+
+	// stop intake: the file watcher, syslog and OTLP listeners and new HTTP requests
+	watcher.Stop()
+	intake.Wait()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("Failed to shut down HTTP server: ", err)
+	}
+
+	// wait for in-flight submissions to receive their commit status
+	if err := writer.Drain(shutdownCtx); err != nil {
+		log.Println("Failed to drain in-flight submissions: ", err)
+	}
+
+	// stop background workers, then close connections in order
+	cancelBackground()
+	workers.Wait()
+	alerts.Wait()
+	if err := connection.Close(); err != nil {
+		log.Println(err)
+	}
+	if err := internal.CloseDB(); err != nil {
+		log.Println("Failed to close database: ", err)
+	}
+}
+
+// watchSettings configures the file watcher started through the settings API.
+type watchSettings struct {
+	Path      string             `json:"path" binding:"required"`
+	Source    string             `json:"source"`
+	Identity  string             `json:"identity"`
+	Parser    string             `json:"parser"`
+	Multiline *multilineSettings `json:"multiline,omitempty"`
+	// Redaction replaces the rules of the environment for this watcher
+	Redaction *internal.RedactionConfig `json:"redaction,omitempty"`
+}
+
+// redactor builds the watcher's redactor, keeping the environment's HMAC key.
+func (s watchSettings) redactor() (*internal.Redactor, error) {
+	if s.Redaction == nil {
+		return internal.DefaultRedactor()
+	}
+
+	config, err := internal.RedactionConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	config.Detectors = s.Redaction.Detectors
+	config.Rules = s.Redaction.Rules
+	return internal.NewRedactor(config)
+}
+
+// multilineSettings is the JSON form of internal.MultilineConfig.
+type multilineSettings struct {
+	Start        string   `json:"start,omitempty"`
+	Continuation []string `json:"continuation,omitempty"`
+	FlushTimeout string   `json:"flushTimeout,omitempty"`
+	MaxLines     int      `json:"maxLines,omitempty"`
+}
+
+func newMultilineSettings(config internal.MultilineConfig) *multilineSettings {
+	if !config.Enabled() {
+		return nil
+	}
+	return &multilineSettings{
+		Start:        config.Start,
+		Continuation: config.Continuation,
+		FlushTimeout: config.FlushTimeout.String(),
+		MaxLines:     config.MaxLines,
+	}
+}
+
+func (s *multilineSettings) config() (internal.MultilineConfig, error) {
+	if s == nil {
+		return internal.MultilineConfig{}, nil
+	}
+
+	config := internal.MultilineConfig{Start: s.Start, Continuation: s.Continuation, MaxLines: s.MaxLines}
+	if s.FlushTimeout != "" {
+		flushTimeout, err := time.ParseDuration(s.FlushTimeout)
+		if err != nil {
+			return config, fmt.Errorf("invalid multiline flushTimeout: %w", err)
+		}
+		config.FlushTimeout = flushTimeout
+	}
+	return config, nil
+}
+
+// fileWatcher runs the log file watcher configured through the settings API.
+type fileWatcher struct {
+	mu       sync.Mutex
+	settings watchSettings
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// Start replaces the running watcher with one that writes new entries of the
+// watched file to the ledger under the configured source and identity, stored
+// as options configure. Lines are joined into entries as multiline configures.
+func (w *fileWatcher) Start(ctx context.Context, settings watchSettings, options internal.WriteOptions, multiline internal.MultilineConfig, writer *internal.Writer) error {
+	assembler, err := internal.NewLineAssembler(multiline, func(entry string) {
+		err := writer.WriteWith(entry, settings.Source, settings.Identity, options)
+		if err != nil {
+			log.Println("Failed to write log: ", err)
+		} else {
+			log.Println("Wrote log entry to ledger for line: ", options.Redactor.Redact(entry))
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Stop()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	w.settings = settings
+	w.cancel = cancel
+	w.done = done
+
+	go func() {
+		defer close(done)
+		err := internal.WatchFile(watchCtx, settings.Path, assembler.Add)
+		if err != nil {
+			log.Println("Failed to watch file: ", err)
+		}
+		// the last entry has no successor to end it
+		assembler.Flush()
+	}()
+	return nil
+}
+
+// Stop cancels the running watcher and waits for it to exit.
+func (w *fileWatcher) Stop() {
+	w.mu.Lock()
+	cancel, done := w.cancel, w.done
+	w.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// Path returns the file currently configured for watching.
+func (w *fileWatcher) Path() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.settings.Path
+}
+
+// Settings returns the configuration of the running watcher.
+func (w *fileWatcher) Settings() watchSettings {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.settings
+}
+
+// authenticate resolves the caller of a request and stores it on the context.
+func authenticate(auth *internal.Auth) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, err := auth.Authenticate(c.Request)
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer realm="immutable-log"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set("principal", principal)
+		c.Next()
+	}
+}
+
+// requireRole rejects callers that do not hold role on any source.
+func requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !principalFrom(c).HasRole(role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": role + " role required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func principalFrom(c *gin.Context) *internal.Principal {
+	return c.MustGet("principal").(*internal.Principal)
+}
+
+// isAsync reports whether the caller asked not to wait for the ledger commit.
+func isAsync(c *gin.Context) bool {
+	async, _ := strconv.ParseBool(c.Query("async"))
+	return async || strings.Contains(c.GetHeader("Prefer"), "respond-async")
+}
+
+// requireConnection rejects requests that need the ledger while no gateway connection exists.
+func requireConnection(connection *internal.Connection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if connection == nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "not connected to the Fabric gateway"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func writeHealthReport(c *gin.Context, report internal.HealthReport) {
+	if report.Healthy() {
+		c.JSON(http.StatusOK, report)
+	} else {
+		c.JSON(http.StatusServiceUnavailable, report)
+	}
 }
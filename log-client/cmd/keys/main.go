@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"log-client/internal"
+)
+
+func usage() {
+	fmt.Println("Usage:")
+	fmt.Println("  go run cmd/keys/main.go list [source]")
+	fmt.Println("  go run cmd/keys/main.go shred <key-id>")
+	os.Exit(1)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	defer internal.CloseDB()
+
+	switch os.Args[1] {
+	case "list":
+		source := ""
+		if len(os.Args) >= 3 {
+			source = os.Args[2]
+		}
+
+		keys, err := internal.ListDataKeys(source)
+		if err != nil {
+			panic(err)
+		}
+		for _, key := range keys {
+			state := "live"
+			if key.ShreddedAt != nil {
+				state = "shredded " + key.ShreddedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\n", key.ID, key.Source, key.Period, state)
+		}
+
+	case "shred":
+		if len(os.Args) < 3 {
+			usage()
+		}
+		if err := internal.ShredDataKey(os.Args[2]); err != nil {
+			panic(err)
+		}
+		fmt.Println("Shredded data key: ", os.Args[2])
+
+	default:
+		usage()
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"log-client/internal"
+)
+
+func usage() {
+	fmt.Println("Usage:")
+	fmt.Println("  go run cmd/migrate/main.go up [version]")
+	fmt.Println("  go run cmd/migrate/main.go down [steps]")
+	fmt.Println("  go run cmd/migrate/main.go status")
+	os.Exit(1)
+}
+
+// fail reports an error without a stack trace, which only helps with bugs.
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "migrate:", err)
+	os.Exit(1)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "up":
+		target := 0
+		if len(os.Args) >= 3 {
+			version, err := strconv.Atoi(os.Args[2])
+			if err != nil || version < 1 {
+				usage()
+			}
+			target = version
+		}
+
+		err := internal.MigrateUp(target, func(migration internal.Migration) {
+			fmt.Printf("Applied %04d_%s\n", migration.Version, migration.Name)
+		})
+		if err != nil {
+			fail(err)
+		}
+
+	case "down":
+		steps := 1
+		if len(os.Args) >= 3 {
+			n, err := strconv.Atoi(os.Args[2])
+			if err != nil || n < 1 {
+				usage()
+			}
+			steps = n
+		}
+
+		migrations, err := internal.Migrations()
+		if err != nil {
+			fail(err)
+		}
+		version, err := internal.SchemaVersion()
+		if err != nil {
+			fail(err)
+		}
+
+		// step back through the known versions below the current one
+		target := 0
+		for i := len(migrations) - 1; i >= 0; i-- {
+			if migrations[i].Version >= version {
+				continue
+			}
+			if steps--; steps == 0 {
+				target = migrations[i].Version
+				break
+			}
+		}
+
+		err = internal.MigrateDown(target, func(migration internal.Migration) {
+			fmt.Printf("Reverted %04d_%s\n", migration.Version, migration.Name)
+		})
+		if err != nil {
+			fail(err)
+		}
+
+	case "status":
+		migrations, err := internal.Migrations()
+		if err != nil {
+			fail(err)
+		}
+		version, err := internal.SchemaVersion()
+		if err != nil {
+			fail(err)
+		}
+
+		fmt.Printf("Schema version: %d (expected %d)\n", version, internal.LatestSchemaVersion())
+		for _, migration := range migrations {
+			state := "pending"
+			if migration.Version <= version {
+				state = "applied"
+			}
+			fmt.Printf("%04d_%s\t%s\n", migration.Version, migration.Name, state)
+		}
+
+	default:
+		usage()
+	}
+}
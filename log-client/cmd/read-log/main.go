@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strconv"
@@ -28,10 +29,19 @@ func main() {
 	}
 
 	// get smart contract connection
-	_, _, contract := internal.GetConnection()
-	defer internal.CloseConnection()
+	ctx, cancel := context.WithTimeout(context.Background(), internal.ConnectTimeout)
+	defer cancel()
+	connection, err := internal.GetConnection(ctx)
+	if err != nil {
+		panic(fmt.Errorf("failed to connect to gateway: %w", err))
+	}
+	defer connection.Close()
+	defer internal.CloseDB()
+	if err := connection.WaitForReady(ctx); err != nil {
+		panic(fmt.Errorf("failed to connect to gateway: %w", err))
+	}
 
-	logs, hashes, new_bookmark, hasNextPage, err := internal.ReadLogsWithPagination(contract, clientFilter, pageSize, bookmark)
+	chainEntries, new_bookmark, hasNextPage, err := internal.ReadLogsWithPagination(ctx, connection, clientFilter, pageSize, bookmark)
 
 	if err != nil {
 		panic(fmt.Errorf("failed to read logs: %w", err))
@@ -39,13 +49,28 @@ func main() {
 
 	fmt.Printf("Next Bookmark: %s\n", new_bookmark)
 	fmt.Printf("Has Next Page: %t\n", hasNextPage)
-	for i, logEntry := range logs {
-		valid, _ := logEntry.ValidateHash(hashes[i])
-
+	for _, chainEntry := range chainEntries {
+		logEntry := chainEntry.Entry
 		fmt.Printf("LogID: %d\n", logEntry.ID)
+		if chainEntry.Err != nil {
+			// the ledger vouches for an entry the database no longer has
+			fmt.Printf("Ledger Key: %s\n", chainEntry.LogID)
+			fmt.Printf("Error: %v\n", chainEntry.Err)
+			fmt.Printf("Hash: %s\n", chainEntry.Hash)
+			fmt.Println("Content Hash Valid: false")
+			fmt.Println("-----------------------------------------------------")
+			continue
+		}
+
+		valid, _ := logEntry.ValidateHash(chainEntry.Hash)
+		content, err := logEntry.Plaintext()
+		if err != nil {
+			content = fmt.Sprintf("(unreadable: %v)", err)
+		}
+
 		fmt.Printf("Timestamp: %s\n", logEntry.Timestamp.Format("2006-01-02T15:04:05.000000000Z07:00"))
-		fmt.Printf("Content: %s\n", logEntry.Content)
-		fmt.Printf("Hash: %s\n", hashes[i])
+		fmt.Printf("Content: %s\n", content)
+		fmt.Printf("Hash: %s\n", chainEntry.Hash)
 		fmt.Printf("Content Hash Valid: %t\n", valid)
 		fmt.Println("-----------------------------------------------------")
 	}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"log-client/internal"
+)
+
+func usage() {
+	fmt.Println("Usage:")
+	fmt.Println("  go run cmd/wallet/main.go import <name> <msp-id> <cert-file> [key-file]")
+	fmt.Println("  go run cmd/wallet/main.go list")
+	fmt.Println("  go run cmd/wallet/main.go delete <name>")
+	os.Exit(1)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	wallet, err := internal.OpenWallet()
+	if err != nil {
+		panic(err)
+	}
+
+	switch os.Args[1] {
+	case "import":
+		if len(os.Args) < 5 {
+			usage()
+		}
+
+		// without a key file the identity signs through the configured HSM
+		keyPath := ""
+		if len(os.Args) >= 6 {
+			keyPath = os.Args[5]
+		}
+
+		id, err := internal.NewWalletIdentity(os.Args[3], os.Args[4], keyPath)
+		if err != nil {
+			panic(err)
+		}
+		if err := wallet.Put(os.Args[2], id); err != nil {
+			panic(err)
+		}
+		fmt.Println("Imported identity: ", os.Args[2])
+
+	case "list":
+		names, err := wallet.List()
+		if err != nil {
+			panic(err)
+		}
+		for _, name := range names {
+			id, err := wallet.Get(name)
+			if err != nil {
+				fmt.Printf("%s\t(unreadable: %v)\n", name, err)
+				continue
+			}
+
+			keyStore := "file"
+			if id.Credentials.PrivateKey == "" {
+				keyStore = "hsm"
+			}
+			fmt.Printf("%s\t%s\t%s\n", name, id.MspID, keyStore)
+		}
+
+	case "delete":
+		if len(os.Args) < 3 {
+			usage()
+		}
+		if err := wallet.Remove(os.Args[2]); err != nil {
+			panic(err)
+		}
+		fmt.Println("Deleted identity: ", os.Args[2])
+
+	default:
+		usage()
+	}
+}
@@ -1,32 +1,105 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"log-client/internal"
 )
 
 func main() {
 	if len(os.Args) < 3 {
-		fmt.Println("Usage: go run cmd/write-log/main.go <filename> <client-name>")
+		fmt.Println("Usage: go run cmd/write-log/main.go <filename> <client-name> [identity] [parser]")
 		os.Exit(1)
 	}
 
 	filePath := os.Args[1]
 	clientName := os.Args[2]
+	identityName := ""
+	if len(os.Args) > 3 {
+		identityName = os.Args[3]
+	}
+	parserName := internal.DefaultParser
+	if len(os.Args) > 4 {
+		parserName = os.Args[4]
+	}
+	parser, err := internal.LookupParser(parserName)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	redactor, err := internal.DefaultRedactor()
+	if err != nil {
+		fmt.Println("Failed to configure redaction: ", err)
+		os.Exit(1)
+	}
+	options := internal.WriteOptions{Parser: parser, Redactor: redactor}
+
+	// stop watching on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	// get smart contract connection
-	_, _, contract := internal.GetConnection()
-	defer internal.CloseConnection()
+	connection, err := internal.GetConnection(ctx)
+	if err != nil {
+		panic(fmt.Errorf("failed to connect to gateway: %w", err))
+	}
+	connectCtx, cancelConnect := context.WithTimeout(ctx, internal.ConnectTimeout)
+	err = connection.WaitForReady(connectCtx)
+	cancelConnect()
+	if err != nil {
+		panic(fmt.Errorf("failed to connect to gateway: %w", err))
+	}
+
+	// without an explicit identity, transact as the one mapped to the client
+	if identityName == "" {
+		identityName = connection.IdentityForSource(clientName)
+	}
+	if err := connection.LoadIdentity(identityName); err != nil {
+		panic(fmt.Errorf("failed to load identity: %w", err))
+	}
+
+	// submissions outlive the signal so that they can drain
+	background, cancelBackground := context.WithCancel(context.Background())
+	go connection.Monitor(background)
+	writer := internal.NewWriter(background, connection)
 
-	// everytime a new line is added to the file, create a new asset on the ledger
-	internal.WatchFile(filePath, func(line string) {
-		err := internal.WriteLog(contract, line, clientName)
+	// everytime a new entry is added to the file, create a new asset on the
+	// ledger, joining lines as configured by the MULTILINE_* variables
+	multiline := internal.MultilineConfigFromEnv()
+	multiline.QuotedRecords = internal.QuotedRecords(parserName)
+	assembler, err := internal.NewLineAssembler(multiline, func(entry string) {
+		err := writer.WriteWith(entry, clientName, identityName, options)
 		if err != nil {
-			panic(fmt.Errorf("failed to write log: %w", err))
+			fmt.Println("Failed to write log: ", err)
 		} else {
-			fmt.Println("Wrote log entry to ledger for line: ", line)
+			fmt.Println("Wrote log entry to ledger for line: ", options.Redactor.Redact(entry))
 		}
-	}, nil)
+	})
+	if err != nil {
+		panic(err)
+	}
+	err = internal.WatchFile(ctx, filePath, assembler.Add)
+	if err != nil {
+		fmt.Println("Failed to watch file: ", err)
+	}
+	assembler.Flush()
+
+	// wait for in-flight submissions, then close connections in order
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), internal.ShutdownTimeout)
+	defer cancelDrain()
+	if err := writer.Drain(drainCtx); err != nil {
+		fmt.Println("Failed to drain in-flight submissions: ", err)
+	}
+	cancelBackground()
+
+	if err := connection.Close(); err != nil {
+		fmt.Println(err)
+	}
+	if err := internal.CloseDB(); err != nil {
+		fmt.Println("Failed to close database: ", err)
+	}
 }
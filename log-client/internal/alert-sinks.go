@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebhookSink posts alerts as JSON, signed with HMAC-SHA256 when a secret is set.
+type WebhookSink struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+func NewWebhookSink(url string, secret string) *WebhookSink {
+	return &WebhookSink{url: url, secret: []byte(secret), client: &http.Client{}}
+}
+
+func (s *WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (s *WebhookSink) Send(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// sign timestamp and body so receivers can reject replays and forgeries
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("X-Alert-Timestamp", timestamp)
+	if len(s.secret) > 0 {
+		req.Header.Set("X-Alert-Signature", "sha256="+SignWebhook(s.secret, timestamp, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SignWebhook computes the hex HMAC-SHA256 of "<timestamp>.<body>".
+func SignWebhook(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SMTPSink emails alerts through an SMTP relay.
+type SMTPSink struct {
+	addr     string
+	user     string
+	password string
+	from     string
+	to       []string
+}
+
+func NewSMTPSink(addr string, user string, password string, from string, to []string) *SMTPSink {
+	return &SMTPSink{addr: addr, user: user, password: password, from: from, to: to}
+}
+
+func (s *SMTPSink) Name() string {
+	return "smtp"
+}
+
+func (s *SMTPSink) Send(ctx context.Context, alert Alert) error {
+	var auth smtp.Auth
+	if s.user != "" {
+		host := strings.Split(s.addr, ":")[0]
+		auth = smtp.PlainAuth("", s.user, s.password, host)
+	}
+
+	msg := s.message(alert)
+
+	// net/smtp has no context support, so run it aside and honour the deadline
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(s.addr, auth, s.from, s.to, msg)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// message formats alert as an email. The source comes from clients, so it is
+// encoded into the subject rather than able to end the header with a newline.
+func (s *SMTPSink) message(alert Alert) []byte {
+	subject := fmt.Sprintf("[immutable-log] %s alert for %s", alert.Kind, alert.Source)
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", alert.Timestamp.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s\r\n\r\nSource: %s\r\nEntry ID: %d\r\nLog ID: %s\r\nDetected: %s\r\n",
+		alert.Message, alert.Source, alert.EntryID, alert.LogID, alert.Timestamp.Format(time.RFC3339))
+	return msg.Bytes()
+}
+
+// FileSink appends alerts to a file as JSON lines.
+type FileSink struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileSink(path string) *FileSink {
+	return &FileSink{path: path}
+}
+
+func (s *FileSink) Name() string {
+	return "file"
+}
+
+func (s *FileSink) Send(ctx context.Context, alert Alert) error {
+	line, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignWebhook(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      string
+		want      string
+	}{
+		// echo -n '<timestamp>.<body>' | openssl dgst -sha256 -hmac <secret>
+		{name: "known signature", secret: "secret", timestamp: "1700000000", body: `{"kind":"tampered"}`,
+			want: "ec8d386107cf71bf5e90ee96c5eb566afef1d0763978770c8ea3d167aeb0b48a"},
+		{name: "timestamp is signed", secret: "secret", timestamp: "1700000001", body: `{"kind":"tampered"}`,
+			want: "8f93ec8fe91af8d9e0b965f25fef68c5abb539caea4cb677724eafaaefab4aad"},
+		{name: "other secret", secret: "other", timestamp: "1700000000", body: `{"kind":"tampered"}`,
+			want: "db66c09ea95f9c496a283610b9e54bc415f54a8c69f0d1e74ae001706063164d"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := SignWebhook([]byte(test.secret), test.timestamp, []byte(test.body)); got != test.want {
+				t.Errorf("SignWebhook() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWebhookSinkSend(t *testing.T) {
+	alert := Alert{Kind: AlertTampered, Source: "app", EntryID: 1, Message: "log entry 1 does not match its on-chain hash"}
+
+	tests := []struct {
+		name          string
+		secret        string
+		status        int
+		wantSignature bool
+		wantErr       bool
+	}{
+		{name: "signed", secret: "secret", status: http.StatusNoContent, wantSignature: true},
+		{name: "unsigned", status: http.StatusOK},
+		{name: "rejected", secret: "secret", status: http.StatusUnauthorized, wantSignature: true, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var header http.Header
+			var body []byte
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				header = r.Header.Clone()
+				body, _ = io.ReadAll(r.Body)
+				w.WriteHeader(test.status)
+			}))
+			defer server.Close()
+
+			err := NewWebhookSink(server.URL, test.secret).Send(context.Background(), alert)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Send() error = %v, want error %v", err, test.wantErr)
+			}
+
+			signature := header.Get("X-Alert-Signature")
+			if !test.wantSignature {
+				if signature != "" {
+					t.Errorf("X-Alert-Signature = %q without a secret", signature)
+				}
+				return
+			}
+			// receivers check the signature over the timestamp header and raw body
+			want := "sha256=" + SignWebhook([]byte(test.secret), header.Get("X-Alert-Timestamp"), body)
+			if signature != want {
+				t.Errorf("X-Alert-Signature = %q, want %q", signature, want)
+			}
+		})
+	}
+}
+
+func TestSMTPSinkMessage(t *testing.T) {
+	sink := NewSMTPSink("localhost:25", "", "", "immutable-log@localhost", []string{"ops@example.com"})
+
+	tests := []struct {
+		name        string
+		source      string
+		wantSubject string
+	}{
+		{name: "plain source", source: "billing", wantSubject: "Subject: [immutable-log] tampered alert for billing"},
+		{name: "header injection", source: "app\r\nBcc: attacker@example.com", wantSubject: "Subject: =?utf-8?q?"},
+		{name: "bare line feed", source: "app\nBcc: attacker@example.com", wantSubject: "Subject: =?utf-8?q?"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			alert := Alert{Kind: AlertTampered, Source: test.source, Message: "tampered", Timestamp: time.Now()}
+			header, _, _ := strings.Cut(string(sink.message(alert)), "\r\n\r\n")
+
+			lines := strings.Split(header, "\r\n")
+			if len(lines) != 5 {
+				t.Fatalf("message header has %d lines, want 5:\n%s", len(lines), header)
+			}
+			if !strings.HasPrefix(lines[2], test.wantSubject) {
+				t.Errorf("subject line = %q, want prefix %q", lines[2], test.wantSubject)
+			}
+			if strings.ContainsAny(lines[2], "\r\n") || strings.Contains(header, "\nBcc:") {
+				t.Errorf("source escaped the subject:\n%s", header)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	AlertTampered       = "tampered"
+	AlertMissingRow     = "missing_row"
+	AlertAnchorFailure  = "anchor_failure"
+	alertQueueSize      = 256
+	alertDeliverTimeout = 10 * time.Second
+)
+
+// Alert describes an integrity problem detected by the client.
+type Alert struct {
+	Kind      string    `json:"kind"`
+	Source    string    `json:"source"`
+	EntryID   uint      `json:"entryId,omitempty"`
+	LogID     string    `json:"logId,omitempty"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (a Alert) key() string {
+	return fmt.Sprintf("%s:%s:%d:%s", a.Kind, a.Source, a.EntryID, a.LogID)
+}
+
+// AlertSink delivers alerts to an external destination.
+type AlertSink interface {
+	Name() string
+	Send(ctx context.Context, alert Alert) error
+}
+
+// AlertConfig configures the alert sinks, deduplication and rate limiting.
+type AlertConfig struct {
+	WebhookURL    string
+	WebhookSecret string
+	SMTPAddr      string
+	SMTPUser      string
+	SMTPPassword  string
+	SMTPFrom      string
+	SMTPTo        []string
+	FilePath      string
+	DedupWindow   time.Duration
+	RateLimit     int
+	RateWindow    time.Duration
+}
+
+// AlertConfigFromEnv reads the alert configuration from ALERT_* environment variables.
+func AlertConfigFromEnv() AlertConfig {
+	return AlertConfig{
+		WebhookURL:    getEnv("ALERT_WEBHOOK_URL", ""),
+		WebhookSecret: getEnv("ALERT_WEBHOOK_SECRET", ""),
+		SMTPAddr:      getEnv("ALERT_SMTP_ADDR", ""),
+		SMTPUser:      getEnv("ALERT_SMTP_USER", ""),
+		SMTPPassword:  getEnv("ALERT_SMTP_PASSWORD", ""),
+		SMTPFrom:      getEnv("ALERT_SMTP_FROM", "immutable-log@localhost"),
+		SMTPTo:        getEnvList("ALERT_SMTP_TO"),
+		FilePath:      getEnv("ALERT_FILE_PATH", ""),
+		DedupWindow:   getEnvDuration("ALERT_DEDUP_WINDOW", 10*time.Minute),
+		RateLimit:     getEnvInt("ALERT_RATE_LIMIT", 30),
+		RateWindow:    getEnvDuration("ALERT_RATE_WINDOW", time.Minute),
+	}
+}
+
+// Sinks builds the sinks enabled by the configuration.
+func (c AlertConfig) Sinks() []AlertSink {
+	var sinks []AlertSink
+	if c.WebhookURL != "" {
+		sinks = append(sinks, NewWebhookSink(c.WebhookURL, c.WebhookSecret))
+	}
+	if c.SMTPAddr != "" && len(c.SMTPTo) > 0 {
+		sinks = append(sinks, NewSMTPSink(c.SMTPAddr, c.SMTPUser, c.SMTPPassword, c.SMTPFrom, c.SMTPTo))
+	}
+	if c.FilePath != "" {
+		sinks = append(sinks, NewFileSink(c.FilePath))
+	}
+	return sinks
+}
+
+// AlertDispatcher deduplicates and rate limits alerts before fanning them out to the sinks.
+type AlertDispatcher struct {
+	config AlertConfig
+	sinks  []AlertSink
+	queue  chan Alert
+	done   chan struct{}
+
+	mu          sync.Mutex
+	lastSeen    map[string]time.Time
+	windowStart time.Time
+	windowCount int
+}
+
+var alertDispatcher *AlertDispatcher
+
+// StartAlerting starts delivering alerts raised anywhere in the client until ctx is cancelled.
+func StartAlerting(ctx context.Context, config AlertConfig) *AlertDispatcher {
+	dispatcher := &AlertDispatcher{
+		config:   config,
+		sinks:    config.Sinks(),
+		queue:    make(chan Alert, alertQueueSize),
+		done:     make(chan struct{}),
+		lastSeen: map[string]time.Time{},
+	}
+	alertDispatcher = dispatcher
+
+	go dispatcher.run(ctx)
+	return dispatcher
+}
+
+// raiseAlert hands an alert to the running dispatcher, if any.
+func raiseAlert(alert Alert) {
+	if alertDispatcher == nil {
+		return
+	}
+	if alert.Timestamp.IsZero() {
+		alert.Timestamp = time.Now().UTC()
+	}
+	alertDispatcher.Raise(alert)
+}
+
+// Raise queues an alert unless it is a duplicate or the rate limit is exceeded.
+func (d *AlertDispatcher) Raise(alert Alert) {
+	if !d.admit(alert, time.Now()) {
+		return
+	}
+
+	select {
+	case d.queue <- alert:
+		alertsRaised.WithLabelValues(alert.Kind, "queued").Inc()
+	default:
+		alertsRaised.WithLabelValues(alert.Kind, "dropped").Inc()
+		log.Println("alert queue full, dropping alert:", alert.Message)
+	}
+}
+
+// admit reports whether an alert raised at now is delivered, counting it
+// against the dedup and rate limit windows if so.
+func (d *AlertDispatcher) admit(alert Alert, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := alert.key()
+	if seen, ok := d.lastSeen[key]; ok && now.Sub(seen) < d.config.DedupWindow {
+		alertsRaised.WithLabelValues(alert.Kind, "duplicate").Inc()
+		return false
+	}
+
+	if now.Sub(d.windowStart) >= d.config.RateWindow {
+		d.windowStart = now
+		d.windowCount = 0
+	}
+	if d.config.RateLimit > 0 && d.windowCount >= d.config.RateLimit {
+		alertsRaised.WithLabelValues(alert.Kind, "rate_limited").Inc()
+		return false
+	}
+
+	d.windowCount++
+	d.lastSeen[key] = now
+
+	// forget entries that fell out of the dedup window
+	for k, seen := range d.lastSeen {
+		if now.Sub(seen) >= d.config.DedupWindow {
+			delete(d.lastSeen, k)
+		}
+	}
+	return true
+}
+
+// Wait blocks until the dispatcher has flushed its queue after ctx was cancelled.
+func (d *AlertDispatcher) Wait() {
+	<-d.done
+}
+
+func (d *AlertDispatcher) run(ctx context.Context) {
+	defer close(d.done)
+	for {
+		select {
+		case alert := <-d.queue:
+			d.deliver(ctx, alert)
+		case <-ctx.Done():
+			d.flush()
+			return
+		}
+	}
+}
+
+// flush delivers alerts still queued at shutdown.
+func (d *AlertDispatcher) flush() {
+	for {
+		select {
+		case alert := <-d.queue:
+			d.deliver(context.Background(), alert)
+		default:
+			return
+		}
+	}
+}
+
+func (d *AlertDispatcher) deliver(ctx context.Context, alert Alert) {
+	log.Printf("ALERT [%s] %s", alert.Kind, alert.Message)
+	for _, sink := range d.sinks {
+		sendCtx, cancel := context.WithTimeout(ctx, alertDeliverTimeout)
+		if err := sink.Send(sendCtx, alert); err != nil {
+			log.Printf("failed to deliver alert to %s: %v", sink.Name(), err)
+		}
+		cancel()
+	}
+}
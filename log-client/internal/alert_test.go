@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAlertDispatcherAdmit(t *testing.T) {
+	tampered := Alert{Kind: AlertTampered, Source: "app", EntryID: 1}
+	other := Alert{Kind: AlertTampered, Source: "app", EntryID: 2}
+	third := Alert{Kind: AlertMissingRow, Source: "db", EntryID: 3}
+
+	type raised struct {
+		alert Alert
+		after time.Duration
+		want  bool
+	}
+	tests := []struct {
+		name   string
+		config AlertConfig
+		raised []raised
+	}{
+		{
+			name:   "duplicate within the dedup window",
+			config: AlertConfig{DedupWindow: time.Minute},
+			raised: []raised{
+				{alert: tampered, want: true},
+				{alert: tampered, after: 59 * time.Second, want: false},
+				{alert: other, after: 59 * time.Second, want: true},
+			},
+		},
+		{
+			name:   "duplicate after the dedup window",
+			config: AlertConfig{DedupWindow: time.Minute},
+			raised: []raised{
+				{alert: tampered, want: true},
+				{alert: tampered, after: time.Minute, want: true},
+			},
+		},
+		{
+			name:   "suppressed duplicates do not extend the window",
+			config: AlertConfig{DedupWindow: time.Minute},
+			raised: []raised{
+				{alert: tampered, want: true},
+				{alert: tampered, after: 30 * time.Second, want: false},
+				{alert: tampered, after: 61 * time.Second, want: true},
+			},
+		},
+		{
+			name:   "rate limited within the window",
+			config: AlertConfig{DedupWindow: time.Minute, RateLimit: 2, RateWindow: time.Minute},
+			raised: []raised{
+				{alert: tampered, want: true},
+				{alert: other, after: time.Second, want: true},
+				{alert: third, after: 2 * time.Second, want: false},
+			},
+		},
+		{
+			name:   "rate limit resets with the window",
+			config: AlertConfig{DedupWindow: time.Second, RateLimit: 1, RateWindow: time.Minute},
+			raised: []raised{
+				{alert: tampered, want: true},
+				{alert: other, after: 59 * time.Second, want: false},
+				{alert: other, after: time.Minute, want: true},
+			},
+		},
+		{
+			name:   "no rate limit",
+			config: AlertConfig{DedupWindow: time.Minute, RateWindow: time.Minute},
+			raised: []raised{
+				{alert: tampered, want: true},
+				{alert: other, want: true},
+				{alert: third, want: true},
+			},
+		},
+	}
+
+	start := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dispatcher := &AlertDispatcher{config: test.config, lastSeen: map[string]time.Time{}}
+			for i, raised := range test.raised {
+				if got := dispatcher.admit(raised.alert, start.Add(raised.after)); got != raised.want {
+					t.Errorf("alert %d (%s) after %v: admit() = %v, want %v", i, raised.alert.key(), raised.after, got, raised.want)
+				}
+			}
+		})
+	}
+}
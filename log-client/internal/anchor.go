@@ -0,0 +1,302 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// Anchor is the locally indexed copy of an asset committed on the ledger.
+type Anchor struct {
+	ID          uint   `gorm:"primaryKey"`
+	LogID       string `gorm:"uniqueIndex"`
+	TxID        string `gorm:"index"`
+	BlockNumber uint64 `gorm:"index"`
+	EntryID     uint   `gorm:"index"`
+	BlobPath    string
+	Hash        string
+	Source      string `gorm:"index"`
+	Timestamp   string
+	FieldHashes map[string]string `gorm:"type:jsonb;serializer:json"`
+}
+
+// IndexFilter narrows down the anchors returned by ReadIndexedLogs. A non-nil
+// Sources restricts results to the sources the caller may read, and Fields to
+// entries whose parsed fields hold every given value. Query searches content,
+// so it only matches entries that are not archived.
+type IndexFilter struct {
+	Source    string
+	Sources   []string
+	Query     string
+	Fields    map[string]string
+	StartDate *time.Time
+	EndDate   *time.Time
+	PageSize  int
+	Bookmark  string
+}
+
+// ChainVerification is the result of checking an indexed anchor against the
+// ledger. TamperedFields names the entry fields that no longer match their
+// anchored hash.
+type ChainVerification struct {
+	LogID          string
+	TxID           string
+	BlockNumber    uint64
+	OnChain        bool
+	IndexValid     bool
+	ContentHash    string
+	ChainHash      string
+	IsValid        bool
+	TamperedFields []string
+}
+
+func newAnchor(asset rawChain, txID string, blockNumber uint64) Anchor {
+	entryID, _ := strconv.Atoi(asset.BlobPath)
+	return Anchor{
+		LogID:       asset.LogID,
+		TxID:        txID,
+		BlockNumber: blockNumber,
+		EntryID:     uint(entryID),
+		BlobPath:    asset.BlobPath,
+		Hash:        asset.Hash,
+		Source:      asset.Source,
+		Timestamp:   asset.Timestamp,
+		FieldHashes: asset.FieldHashes,
+	}
+}
+
+// ErrQueryEncrypted is returned by ReadIndexedLogs for a full-text query or
+// field predicates while content is encrypted.
+var ErrQueryEncrypted = errors.New("full-text and field queries are not available while content is encrypted")
+
+// ReadIndexedLogs serves a page of anchors from the local anchor index
+// instead of the chaincode. The entries themselves are loaded when they are
+// verified, with VerifyLogEntries.
+func ReadIndexedLogs(filter IndexFilter) ([]Anchor, string, bool, error) {
+	// sealed content cannot be matched and encrypted entries are stored
+	// without fields, so these filters would find nothing
+	if (filter.Query != "" || len(filter.Fields) > 0) && EncryptionConfigFromEnv().Enabled() {
+		return nil, "", false, ErrQueryEncrypted
+	}
+
+	db, err := InitDB()
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	// archived entries keep their timestamp and fields next to the pointer to
+	// their segment, so that filters still match them
+	query := db.Table("anchors").
+		Select("anchors.*").
+		Joins("LEFT JOIN log_entries ON log_entries.id = anchors.entry_id").
+		Joins("LEFT JOIN archived_entries ON archived_entries.entry_id = anchors.entry_id").
+		Order("anchors.id")
+
+	if filter.Source != "" {
+		query = query.Where("anchors.source = ?", filter.Source)
+	}
+	if filter.Sources != nil {
+		query = query.Where("anchors.source IN ?", filter.Sources)
+	}
+	if filter.Query != "" {
+		query = query.Where("log_entries.content ILIKE ?", "%"+filter.Query+"%")
+	}
+	if len(filter.Fields) > 0 {
+		// containment is served by the GIN index on fields
+		fields, err := json.Marshal(filter.Fields)
+		if err != nil {
+			return nil, "", false, err
+		}
+		query = query.Where("(log_entries.fields @> ? OR archived_entries.fields @> ?)", string(fields), string(fields))
+	}
+	if filter.StartDate != nil {
+		query = query.Where("COALESCE(log_entries.timestamp, archived_entries.timestamp) >= ?", *filter.StartDate)
+	}
+	if filter.EndDate != nil {
+		query = query.Where("COALESCE(log_entries.timestamp, archived_entries.timestamp) <= ?", *filter.EndDate)
+	}
+	if filter.Bookmark != "" {
+		after, err := strconv.Atoi(filter.Bookmark)
+		if err != nil {
+			return nil, "", false, fmt.Errorf("invalid bookmark: %w", err)
+		}
+		query = query.Where("anchors.id > ?", after)
+	}
+	if filter.PageSize > 0 {
+		// fetch one extra row to know whether another page exists
+		query = query.Limit(filter.PageSize + 1)
+	}
+
+	var anchors []Anchor
+	if err := query.Scan(&anchors).Error; err != nil {
+		return nil, "", false, fmt.Errorf("failed to read anchor index: %w", err)
+	}
+
+	hasNextPage := false
+	if filter.PageSize > 0 && len(anchors) > filter.PageSize {
+		anchors = anchors[:filter.PageSize]
+		hasNextPage = true
+	}
+
+	bookmark := ""
+	if hasNextPage {
+		bookmark = strconv.FormatUint(uint64(anchors[len(anchors)-1].ID), 10)
+	}
+
+	return anchors, bookmark, hasNextPage, nil
+}
+
+// LoadAnchor loads an indexed anchor by its ledger key.
+func LoadAnchor(logID string) (*Anchor, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var anchor Anchor
+	if err := db.Where("log_id = ?", logID).First(&anchor).Error; err != nil {
+		return nil, fmt.Errorf("failed to load anchor %s: %w", logID, err)
+	}
+	return &anchor, nil
+}
+
+// VerifyAnchor checks an indexed anchor against the asset on the ledger and the off-chain row.
+func VerifyAnchor(ctx context.Context, connection *Connection, logID string) (*ChainVerification, error) {
+	anchor, err := LoadAnchor(logID)
+	if err != nil {
+		return nil, err
+	}
+
+	verification := ChainVerification{
+		LogID:       anchor.LogID,
+		TxID:        anchor.TxID,
+		BlockNumber: anchor.BlockNumber,
+	}
+
+	// compare fields against the ledger, falling back to the index when the
+	// asset cannot be read
+	chainFieldHashes := anchor.FieldHashes
+	if asset, err := readAsset(ctx, connection, logID); err == nil {
+		verification.OnChain = true
+		verification.ChainHash = asset.Hash
+		chainFieldHashes = asset.FieldHashes
+		verification.IndexValid = anchor.matches(*asset)
+	}
+
+	var logEntry LogEntry
+	if err := logEntry.LoadFromDB(anchor.EntryID); err == nil {
+		verification.ContentHash, err = logEntry.Hash()
+		if err != nil {
+			return nil, err
+		}
+		if verification.ContentHash != verification.ChainHash {
+			verification.TamperedFields = logEntry.TamperedFields(chainFieldHashes)
+		}
+	}
+
+	verification.IsValid = verification.OnChain && verification.IndexValid &&
+		verification.ContentHash == verification.ChainHash
+
+	if !verification.IsValid {
+		raiseAlert(Alert{
+			Kind:    AlertTampered,
+			Source:  anchor.Source,
+			EntryID: anchor.EntryID,
+			LogID:   anchor.LogID,
+			Message: fmt.Sprintf("ledger asset %s failed verification against the index and database", anchor.LogID),
+		})
+	}
+
+	return &verification, nil
+}
+
+// ErrAssetMissing is returned when the ledger has no asset for an indexed anchor.
+var ErrAssetMissing = errors.New("asset is missing from the ledger")
+
+// readAsset reads the asset of logID from the ledger.
+func readAsset(ctx context.Context, connection *Connection, logID string) (*rawChain, error) {
+	var assetJSON []byte
+	err := connection.Do(ctx, func(contract *client.Contract) (err error) {
+		assetJSON, err = contract.EvaluateWithContext(ctx, "ReadAsset", client.WithArguments(logID))
+		return err
+	})
+	if err != nil {
+		// the chaincode only reports unknown keys in its error message
+		if !isUnavailable(err) && strings.Contains(err.Error(), "does not exist") {
+			return nil, fmt.Errorf("%w: %s", ErrAssetMissing, logID)
+		}
+		return nil, fmt.Errorf("failed to read asset %s: %w", logID, err)
+	}
+
+	var asset rawChain
+	if err := json.Unmarshal(assetJSON, &asset); err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// matches reports whether the anchor is an unchanged copy of asset.
+func (a Anchor) matches(asset rawChain) bool {
+	return asset.Hash == a.Hash &&
+		asset.BlobPath == a.BlobPath &&
+		asset.Source == a.Source &&
+		maps.Equal(asset.FieldHashes, a.FieldHashes)
+}
+
+// ChainAnchors replaces indexed anchors by their assets on the ledger, read on
+// up to VerifyConcurrency workers, so that VerifyLogEntries checks entries
+// against the chain rather than the index, which the gateway's login writes.
+// An anchor whose asset differs from it or is missing raises a tamper alert;
+// a missing asset leaves no hash, so that its entry fails verification.
+func ChainAnchors(ctx context.Context, connection *Connection, anchors []Anchor) ([]Anchor, error) {
+	chained := make([]Anchor, len(anchors))
+	errs := make([]error, len(anchors))
+
+	runBounded(len(anchors), VerifyConcurrency, func(i int) {
+		asset, err := readAsset(ctx, connection, anchors[i].LogID)
+		if err != nil && !errors.Is(err, ErrAssetMissing) {
+			errs[i] = err
+			return
+		}
+		chained[i] = anchors[i].onChain(asset)
+	})
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return chained, nil
+}
+
+// onChain returns the anchor as the ledger has it, asset being nil when the
+// ledger has none, and raises a tamper alert when the index differs.
+func (a Anchor) onChain(asset *rawChain) Anchor {
+	if asset != nil && a.matches(*asset) {
+		return a
+	}
+
+	chained := a
+	message := fmt.Sprintf("indexed anchor %s is missing from the ledger", a.LogID)
+	if asset != nil {
+		chained = newAnchor(*asset, a.TxID, a.BlockNumber)
+		chained.ID = a.ID
+		message = fmt.Sprintf("indexed anchor %s differs from its ledger asset", a.LogID)
+	} else {
+		chained.Hash = ""
+		chained.FieldHashes = nil
+	}
+	raiseAlert(Alert{
+		Kind:    AlertTampered,
+		Source:  a.Source,
+		EntryID: a.EntryID,
+		LogID:   a.LogID,
+		Message: message,
+	})
+	return chained
+}
@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"errors"
+	"maps"
+	"testing"
+)
+
+func TestAnchorOnChain(t *testing.T) {
+	anchor := Anchor{
+		ID:          7,
+		LogID:       "log-1",
+		TxID:        "tx-1",
+		BlockNumber: 3,
+		EntryID:     42,
+		BlobPath:    "42",
+		Hash:        "index-hash",
+		Source:      "app",
+		FieldHashes: map[string]string{"level": "a"},
+	}
+	asset := rawChain{LogID: "log-1", BlobPath: "42", Hash: "index-hash", Source: "app", FieldHashes: map[string]string{"level": "a"}}
+	changed := func(change func(asset *rawChain)) *rawChain {
+		changed := asset
+		change(&changed)
+		return &changed
+	}
+
+	tests := []struct {
+		name            string
+		asset           *rawChain
+		wantEntryID     uint
+		wantHash        string
+		wantFieldHashes map[string]string
+	}{
+		{name: "unchanged", asset: &asset, wantEntryID: 42, wantHash: "index-hash", wantFieldHashes: asset.FieldHashes},
+		{
+			name:            "index hash rewritten",
+			asset:           changed(func(asset *rawChain) { asset.Hash = "chain-hash" }),
+			wantEntryID:     42,
+			wantHash:        "chain-hash",
+			wantFieldHashes: asset.FieldHashes,
+		},
+		{
+			name:            "index points at another entry",
+			asset:           changed(func(asset *rawChain) { asset.BlobPath = "43" }),
+			wantEntryID:     43,
+			wantHash:        "index-hash",
+			wantFieldHashes: asset.FieldHashes,
+		},
+		{
+			name:            "field hashes rewritten",
+			asset:           changed(func(asset *rawChain) { asset.FieldHashes = map[string]string{"level": "b"} }),
+			wantEntryID:     42,
+			wantHash:        "index-hash",
+			wantFieldHashes: map[string]string{"level": "b"},
+		},
+		{name: "missing from the ledger", wantEntryID: 42},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := anchor.onChain(test.asset)
+			if got.ID != anchor.ID || got.TxID != anchor.TxID || got.BlockNumber != anchor.BlockNumber {
+				t.Errorf("onChain() = %+v, lost the index position of %+v", got, anchor)
+			}
+			if got.EntryID != test.wantEntryID || got.Hash != test.wantHash || !maps.Equal(got.FieldHashes, test.wantFieldHashes) {
+				t.Errorf("onChain() = entry %d, hash %q, field hashes %v; want entry %d, hash %q, field hashes %v",
+					got.EntryID, got.Hash, got.FieldHashes, test.wantEntryID, test.wantHash, test.wantFieldHashes)
+			}
+		})
+	}
+}
+
+func TestReadIndexedLogsEncrypted(t *testing.T) {
+	t.Setenv("ENCRYPTION_MASTER_KEY_FILE", "master.key")
+
+	tests := []struct {
+		name   string
+		filter IndexFilter
+	}{
+		{name: "full-text query", filter: IndexFilter{Query: "hunter2"}},
+		{name: "field predicate", filter: IndexFilter{Fields: map[string]string{"password": "hunter2"}}},
+		{name: "both", filter: IndexFilter{Query: "error", Fields: map[string]string{"level": "error"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// rejected before the database is opened
+			if _, _, _, err := ReadIndexedLogs(test.filter); !errors.Is(err, ErrQueryEncrypted) {
+				t.Errorf("ReadIndexedLogs() error = %v, want %v", err, ErrQueryEncrypted)
+			}
+		})
+	}
+}
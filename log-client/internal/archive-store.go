@@ -0,0 +1,259 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrArchiveObjectNotFound is returned by ArchiveStore.Get for unknown keys.
+var ErrArchiveObjectNotFound = errors.New("archive object not found")
+
+// ArchiveStore holds archive segments under slash separated keys.
+type ArchiveStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	// String describes the store without its credentials.
+	String() string
+}
+
+// ArchiveStoreConfig selects a local directory or an S3-compatible bucket,
+// such as MinIO, to archive to. The bucket is addressed path-style at
+// S3Endpoint.
+type ArchiveStoreConfig struct {
+	Dir         string
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3Prefix    string
+	S3AccessKey string
+	S3SecretKey string
+}
+
+// ArchiveStoreConfigFromEnv reads ARCHIVE_DIR and the ARCHIVE_S3_* variables.
+func ArchiveStoreConfigFromEnv() ArchiveStoreConfig {
+	return ArchiveStoreConfig{
+		Dir:         getEnv("ARCHIVE_DIR", ""),
+		S3Endpoint:  getEnv("ARCHIVE_S3_ENDPOINT", ""),
+		S3Region:    getEnv("ARCHIVE_S3_REGION", "us-east-1"),
+		S3Bucket:    getEnv("ARCHIVE_S3_BUCKET", ""),
+		S3Prefix:    getEnv("ARCHIVE_S3_PREFIX", ""),
+		S3AccessKey: getEnv("ARCHIVE_S3_ACCESS_KEY", ""),
+		S3SecretKey: getEnv("ARCHIVE_S3_SECRET_KEY", ""),
+	}
+}
+
+// NewArchiveStore opens the configured store, returning nil when there is none.
+func NewArchiveStore(config ArchiveStoreConfig) (ArchiveStore, error) {
+	switch {
+	case config.S3Bucket != "":
+		endpoint, err := url.Parse(config.S3Endpoint)
+		if err != nil || endpoint.Host == "" {
+			return nil, fmt.Errorf("invalid ARCHIVE_S3_ENDPOINT %q", config.S3Endpoint)
+		}
+		return &s3ArchiveStore{
+			endpoint:  endpoint,
+			region:    config.S3Region,
+			bucket:    config.S3Bucket,
+			prefix:    strings.Trim(config.S3Prefix, "/"),
+			accessKey: config.S3AccessKey,
+			secretKey: config.S3SecretKey,
+			client:    &http.Client{Timeout: ArchiveRequestTimeout},
+		}, nil
+	case config.Dir != "":
+		if err := os.MkdirAll(config.Dir, 0o750); err != nil {
+			return nil, fmt.Errorf("failed to create archive directory: %w", err)
+		}
+		return localArchiveStore(config.Dir), nil
+	}
+	return nil, nil
+}
+
+type localArchiveStore string
+
+func (s localArchiveStore) Put(ctx context.Context, key string, data []byte) error {
+	target := filepath.Join(string(s), filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return err
+	}
+
+	// write then rename, so that a segment is either whole or absent
+	file, err := os.CreateTemp(filepath.Dir(target), ".segment-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), target)
+}
+
+func (s localArchiveStore) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(string(s), filepath.FromSlash(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrArchiveObjectNotFound, key)
+	}
+	return data, err
+}
+
+func (s localArchiveStore) String() string {
+	return "file://" + string(s)
+}
+
+// s3ArchiveStore talks to the S3 REST API with AWS Signature Version 4.
+type s3ArchiveStore struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	prefix    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+func (s *s3ArchiveStore) Put(ctx context.Context, key string, data []byte) error {
+	response, err := s.do(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("failed to put %s: %s: %s", key, response.Status, body)
+	}
+	return nil
+}
+
+func (s *s3ArchiveStore) Get(ctx context.Context, key string) ([]byte, error) {
+	response, err := s.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(response.Body)
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrArchiveObjectNotFound, key)
+	}
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	return nil, fmt.Errorf("failed to get %s: %s: %s", key, response.Status, body)
+}
+
+func (s *s3ArchiveStore) String() string {
+	return "s3://" + path.Join(s.bucket, s.prefix) + " at " + s.endpoint.String()
+}
+
+func (s *s3ArchiveStore) do(ctx context.Context, method string, key string, body []byte) (*http.Response, error) {
+	target := *s.endpoint
+	target.Path = "/" + path.Join(s.bucket, s.prefix, key)
+	// send the path encoded the way it is signed
+	target.RawPath = s3Escape(target.Path, true)
+
+	request, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	s.sign(request, body, time.Now().UTC())
+	return s.client.Do(request)
+}
+
+// sign adds the Authorization header of AWS Signature Version 4.
+func (s *s3ArchiveStore) sign(request *http.Request, body []byte, now time.Time) {
+	payloadHash := sha256.Sum256(body)
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	request.Header.Set("x-amz-date", amzDate)
+	request.Header.Set("x-amz-content-sha256", hex.EncodeToString(payloadHash[:]))
+
+	canonicalPath := request.URL.Path
+	if canonicalPath == "" {
+		canonicalPath = "/"
+	}
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		s3Escape(canonicalPath, true),
+		s3CanonicalQuery(request.URL.Query()),
+		"host:" + request.URL.Host,
+		"x-amz-content-sha256:" + hex.EncodeToString(payloadHash[:]),
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+// s3Escape percent-encodes all but the unreserved characters, as Signature
+// Version 4 expects, keeping slashes when path is set.
+func s3Escape(value string, path bool) string {
+	var escaped strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (path && c == '/') {
+			escaped.WriteByte(c)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		}
+	}
+	return escaped.String()
+}
+
+// s3CanonicalQuery encodes query parameters sorted by name, then value, each
+// with an "=" even when the value is empty.
+func s3CanonicalQuery(query url.Values) string {
+	params := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, s3Escape(name, false)+"="+s3Escape(value, false))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
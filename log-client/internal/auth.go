@@ -0,0 +1,422 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Roles a principal can be granted. Admin implies every other role and
+// auditor implies reader.
+const (
+	RoleReader  = "reader"
+	RoleWriter  = "writer"
+	RoleAuditor = "auditor"
+	RoleAdmin   = "admin"
+)
+
+// Authentication methods that can be enabled through AUTH_METHODS.
+const (
+	AuthAPIKey = "apikey"
+	AuthJWT    = "jwt"
+	AuthMTLS   = "mtls"
+)
+
+// AllSources grants a role on every log source.
+const AllSources = "*"
+
+var (
+	ErrNoCredentials      = errors.New("no credentials presented")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Grant gives a role on a set of log sources.
+type Grant struct {
+	Role    string   `json:"role"`
+	Sources []string `json:"sources"`
+}
+
+// Principal is an authenticated caller of the gateway API.
+type Principal struct {
+	Name   string  `json:"name"`
+	Method string  `json:"method"`
+	Grants []Grant `json:"grants"`
+}
+
+// HasRole reports whether the principal holds role on at least one source.
+func (p *Principal) HasRole(role string) bool {
+	for _, grant := range p.Grants {
+		if roleImplies(grant.Role, role) && len(grant.Sources) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the principal holds role on source.
+func (p *Principal) Allows(role string, source string) bool {
+	sources, all := p.SourcesFor(role)
+	return all || slices.Contains(sources, source)
+}
+
+// SourcesFor lists the sources the principal holds role on. all is true when
+// the role is granted on every source.
+func (p *Principal) SourcesFor(role string) (sources []string, all bool) {
+	sources = []string{}
+	for _, grant := range p.Grants {
+		if !roleImplies(grant.Role, role) {
+			continue
+		}
+		for _, source := range grant.Sources {
+			if source == AllSources {
+				return nil, true
+			}
+			if !slices.Contains(sources, source) {
+				sources = append(sources, source)
+			}
+		}
+	}
+	return sources, false
+}
+
+func roleImplies(granted string, required string) bool {
+	switch granted {
+	case RoleAdmin:
+		return true
+	case RoleAuditor:
+		return required == RoleAuditor || required == RoleReader
+	default:
+		return granted == required
+	}
+}
+
+// Authenticator resolves the principal behind a request. It returns
+// ErrNoCredentials when the request carries none of its credentials.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// AuthConfig holds the authentication settings of the gateway API. Disabled
+// must be set to run without any method, which serves local requests only.
+type AuthConfig struct {
+	Methods        []string
+	Disabled       bool
+	PrincipalsFile string
+	JWTSecret      string
+	JWTIssuer      string
+	JWTAudience    string
+	TLSCertPath    string
+	TLSKeyPath     string
+	TLSClientCA    string
+	AllowedOrigins []string
+}
+
+// AuthConfigFromEnv reads the authentication settings from AUTH_* variables.
+func AuthConfigFromEnv() AuthConfig {
+	config := AuthConfig{
+		Methods:        getEnvList("AUTH_METHODS"),
+		Disabled:       getEnv("AUTH_DISABLED", "") == "true",
+		PrincipalsFile: getEnv("AUTH_PRINCIPALS_FILE", ""),
+		JWTSecret:      getEnv("AUTH_JWT_SECRET", ""),
+		JWTIssuer:      getEnv("AUTH_JWT_ISSUER", ""),
+		JWTAudience:    getEnv("AUTH_JWT_AUDIENCE", ""),
+		TLSCertPath:    getEnv("AUTH_TLS_CERT", ""),
+		TLSKeyPath:     getEnv("AUTH_TLS_KEY", ""),
+		TLSClientCA:    getEnv("AUTH_TLS_CLIENT_CA", ""),
+		AllowedOrigins: getEnvList("CORS_ALLOWED_ORIGINS"),
+	}
+	if len(config.AllowedOrigins) == 0 {
+		config.AllowedOrigins = DefaultAllowedOrigins
+	}
+	return config
+}
+
+// TLSConfig returns the server TLS settings, or nil when the API is served
+// over plain HTTP. Client certificates are requested but only required by
+// the mtls method.
+func (c AuthConfig) TLSConfig() (*tls.Config, error) {
+	if c.TLSCertPath == "" {
+		return nil, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(c.TLSCertPath, c.TLSKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS key pair: %w", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if c.TLSClientCA != "" {
+		caPEM, err := os.ReadFile(c.TLSClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in %s", c.TLSClientCA)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return config, nil
+}
+
+// Auth tries each enabled authenticator in turn.
+type Auth struct {
+	authenticators []Authenticator
+}
+
+// NewAuth builds the authenticators enabled in config. It fails closed when
+// no method is enabled, unless authentication is explicitly disabled, in which
+// case every request is served as an anonymous admin.
+func NewAuth(config AuthConfig) (*Auth, error) {
+	switch {
+	case len(config.Methods) == 0 && !config.Disabled:
+		return nil, fmt.Errorf("no authentication method configured, set AUTH_METHODS, or AUTH_DISABLED=true to serve local requests as an anonymous admin")
+	case len(config.Methods) > 0 && config.Disabled:
+		return nil, fmt.Errorf("AUTH_DISABLED cannot be combined with AUTH_METHODS")
+	}
+
+	var principals []principalEntry
+	if config.PrincipalsFile != "" {
+		data, err := os.ReadFile(config.PrincipalsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read principals file: %w", err)
+		}
+		if err := json.Unmarshal(data, &principals); err != nil {
+			return nil, fmt.Errorf("failed to decode principals file: %w", err)
+		}
+	}
+
+	auth := &Auth{}
+	for _, method := range config.Methods {
+		switch method {
+		case AuthAPIKey:
+			authenticator := &apiKeyAuthenticator{keys: map[string]*Principal{}}
+			for _, entry := range principals {
+				if entry.APIKeySHA256 != "" {
+					authenticator.keys[strings.ToLower(entry.APIKeySHA256)] = entry.principal(AuthAPIKey)
+				}
+			}
+			auth.authenticators = append(auth.authenticators, authenticator)
+		case AuthJWT:
+			if config.JWTSecret == "" {
+				return nil, fmt.Errorf("AUTH_JWT_SECRET is required for jwt authentication")
+			}
+			auth.authenticators = append(auth.authenticators, &jwtAuthenticator{
+				secret:   []byte(config.JWTSecret),
+				issuer:   config.JWTIssuer,
+				audience: config.JWTAudience,
+			})
+		case AuthMTLS:
+			if config.TLSClientCA == "" {
+				return nil, fmt.Errorf("AUTH_TLS_CLIENT_CA is required for mtls authentication")
+			}
+			// client certificates only arrive over TLS
+			if config.TLSCertPath == "" || config.TLSKeyPath == "" {
+				return nil, fmt.Errorf("AUTH_TLS_CERT and AUTH_TLS_KEY are required for mtls authentication")
+			}
+			authenticator := &mtlsAuthenticator{subjects: map[string]*Principal{}}
+			for _, entry := range principals {
+				authenticator.subjects[entry.Name] = entry.principal(AuthMTLS)
+			}
+			auth.authenticators = append(auth.authenticators, authenticator)
+		default:
+			return nil, fmt.Errorf("unknown authentication method %q", method)
+		}
+	}
+
+	return auth, nil
+}
+
+// Enabled reports whether requests have to authenticate.
+func (a *Auth) Enabled() bool {
+	return len(a.authenticators) > 0
+}
+
+// Authenticate resolves the caller with the first authenticator whose
+// credentials are present on the request.
+func (a *Auth) Authenticate(r *http.Request) (*Principal, error) {
+	if !a.Enabled() {
+		return &Principal{Name: "anonymous", Grants: []Grant{{Role: RoleAdmin, Sources: []string{AllSources}}}}, nil
+	}
+
+	for _, authenticator := range a.authenticators {
+		principal, err := authenticator.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return principal, err
+	}
+	return nil, ErrNoCredentials
+}
+
+// principalEntry is a principal configured in AUTH_PRINCIPALS_FILE. The name
+// is matched against the common name of mTLS client certificates.
+type principalEntry struct {
+	Name         string  `json:"name"`
+	APIKeySHA256 string  `json:"apiKeySha256"`
+	Grants       []Grant `json:"grants"`
+}
+
+func (e principalEntry) principal(method string) *Principal {
+	return &Principal{Name: e.Name, Method: method, Grants: e.Grants}
+}
+
+// apiKeyAuthenticator accepts keys from the X-API-Key header or an
+// "Authorization: ApiKey <key>" header. Only key hashes are configured.
+type apiKeyAuthenticator struct {
+	keys map[string]*Principal
+}
+
+func (a *apiKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get("X-API-Key")
+	if scheme, credentials, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "ApiKey") {
+		key = credentials
+	}
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	principal, ok := a.keys[hex.EncodeToString(sum[:])]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown API key", ErrInvalidCredentials)
+	}
+	return principal, nil
+}
+
+// jwtAuthenticator accepts HS256 bearer tokens whose claims carry the grants.
+type jwtAuthenticator struct {
+	secret   []byte
+	issuer   string
+	audience string
+}
+
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *int64          `json:"exp"`
+	NotBefore *int64          `json:"nbf"`
+	Grants    []Grant         `json:"grants"`
+}
+
+func (a *jwtAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := a.verify(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	return &Principal{Name: claims.Subject, Method: AuthJWT, Grants: claims.Grants}, nil
+}
+
+func (a *jwtAuthenticator) verify(token string) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token header")
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("malformed token header")
+	}
+	// never let the token pick its own algorithm
+	if header.Algorithm != "HS256" {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", header.Algorithm)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature")
+	}
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token payload")
+	}
+	var claims jwtClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("malformed token payload")
+	}
+
+	now := time.Now().Unix()
+	if claims.ExpiresAt == nil || now >= *claims.ExpiresAt {
+		return nil, fmt.Errorf("token expired")
+	}
+	if claims.NotBefore != nil && now < *claims.NotBefore {
+		return nil, fmt.Errorf("token not valid yet")
+	}
+	if a.issuer != "" && claims.Issuer != a.issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if a.audience != "" && !claims.hasAudience(a.audience) {
+		return nil, fmt.Errorf("token not issued for %q", a.audience)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("token has no subject")
+	}
+
+	return &claims, nil
+}
+
+// hasAudience handles aud as either a single string or a list.
+func (c *jwtClaims) hasAudience(audience string) bool {
+	var single string
+	if err := json.Unmarshal(c.Audience, &single); err == nil {
+		return single == audience
+	}
+	var list []string
+	if err := json.Unmarshal(c.Audience, &list); err == nil {
+		return slices.Contains(list, audience)
+	}
+	return false
+}
+
+// mtlsAuthenticator maps verified client certificates to principals by their
+// subject common name.
+type mtlsAuthenticator struct {
+	subjects map[string]*Principal
+}
+
+func (a *mtlsAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil, ErrNoCredentials
+	}
+
+	subject := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	principal, ok := a.subjects[subject]
+	if !ok {
+		return nil, fmt.Errorf("%w: no principal for client certificate %q", ErrInvalidCredentials, subject)
+	}
+	return principal, nil
+}
@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func signJWT(t *testing.T, header string, claims map[string]any, secret string) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestJWTVerify(t *testing.T) {
+	authenticator := &jwtAuthenticator{secret: []byte("secret"), issuer: "issuer", audience: "gateway"}
+	now := time.Now().Unix()
+	hs256 := `{"alg":"HS256","typ":"JWT"}`
+	claims := func(overrides map[string]any) map[string]any {
+		claims := map[string]any{
+			"sub":    "alice",
+			"iss":    "issuer",
+			"aud":    "gateway",
+			"exp":    now + 60,
+			"grants": []Grant{{Role: RoleReader, Sources: []string{"app"}}},
+		}
+		for key, value := range overrides {
+			if value == nil {
+				delete(claims, key)
+			} else {
+				claims[key] = value
+			}
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "valid", token: signJWT(t, hs256, claims(nil), "secret")},
+		{name: "audience list", token: signJWT(t, hs256, claims(map[string]any{"aud": []string{"other", "gateway"}}), "secret")},
+		{name: "not before passed", token: signJWT(t, hs256, claims(map[string]any{"nbf": now - 60}), "secret")},
+		{name: "wrong secret", token: signJWT(t, hs256, claims(nil), "other"), wantErr: true},
+		{name: "algorithm none", token: signJWT(t, `{"alg":"none"}`, claims(nil), "secret"), wantErr: true},
+		{name: "algorithm RS256", token: signJWT(t, `{"alg":"RS256"}`, claims(nil), "secret"), wantErr: true},
+		{name: "expired", token: signJWT(t, hs256, claims(map[string]any{"exp": now - 1}), "secret"), wantErr: true},
+		{name: "no expiry", token: signJWT(t, hs256, claims(map[string]any{"exp": nil}), "secret"), wantErr: true},
+		{name: "not valid yet", token: signJWT(t, hs256, claims(map[string]any{"nbf": now + 60}), "secret"), wantErr: true},
+		{name: "wrong issuer", token: signJWT(t, hs256, claims(map[string]any{"iss": "other"}), "secret"), wantErr: true},
+		{name: "wrong audience", token: signJWT(t, hs256, claims(map[string]any{"aud": "other"}), "secret"), wantErr: true},
+		{name: "no subject", token: signJWT(t, hs256, claims(map[string]any{"sub": nil}), "secret"), wantErr: true},
+		{name: "two parts", token: "a.b", wantErr: true},
+		{name: "bad signature encoding", token: "eyJhbGciOiJIUzI1NiJ9.e30.!!", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verified, err := authenticator.verify(test.token)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("verify() = %+v, want an error", verified)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verify() error = %v", err)
+			}
+			if verified.Subject != "alice" || len(verified.Grants) != 1 {
+				t.Errorf("verify() = %+v", verified)
+			}
+		})
+	}
+}
+
+func TestJWTAuthenticate(t *testing.T) {
+	authenticator := &jwtAuthenticator{secret: []byte("secret")}
+	token := signJWT(t, `{"alg":"HS256"}`, map[string]any{"sub": "alice", "exp": time.Now().Unix() + 60}, "secret")
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantErr       error
+	}{
+		{name: "bearer", authorization: "Bearer " + token},
+		{name: "lower case scheme", authorization: "bearer " + token},
+		{name: "no header", wantErr: ErrNoCredentials},
+		{name: "other scheme", authorization: "ApiKey key", wantErr: ErrNoCredentials},
+		{name: "invalid token", authorization: "Bearer " + token + "x", wantErr: ErrInvalidCredentials},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, _ := http.NewRequest(http.MethodGet, "/log", nil)
+			if test.authorization != "" {
+				request.Header.Set("Authorization", test.authorization)
+			}
+			principal, err := authenticator.Authenticate(request)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("Authenticate() error = %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if principal.Name != "alice" || principal.Method != AuthJWT {
+				t.Errorf("Authenticate() = %+v", principal)
+			}
+		})
+	}
+}
+
+func TestPrincipalAllows(t *testing.T) {
+	principal := &Principal{Grants: []Grant{
+		{Role: RoleAuditor, Sources: []string{"app"}},
+		{Role: RoleWriter, Sources: []string{AllSources}},
+	}}
+
+	tests := []struct {
+		role   string
+		source string
+		want   bool
+	}{
+		{role: RoleAuditor, source: "app", want: true},
+		{role: RoleReader, source: "app", want: true},
+		{role: RoleReader, source: "db", want: false},
+		{role: RoleWriter, source: "db", want: true},
+		{role: RoleAdmin, source: "app", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.role+"/"+test.source, func(t *testing.T) {
+			if got := principal.Allows(test.role, test.source); got != test.want {
+				t.Errorf("Allows(%q, %q) = %v, want %v", test.role, test.source, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+const assetKeyPrefix = "asset:"
+
+// parseBlock extracts every asset and hold written by a valid transaction in
+// the block.
+func parseBlock(block *common.Block) ([]Anchor, []Hold, error) {
+	blockNumber := block.GetHeader().GetNumber()
+	validationCodes := block.GetMetadata().GetMetadata()
+	var txFilter []byte
+	if len(validationCodes) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		txFilter = validationCodes[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+
+	var anchors []Anchor
+	var holds []Hold
+	for i, envelopeBytes := range block.GetData().GetData() {
+		// skip transactions the peer marked as invalid
+		if i < len(txFilter) && peer.TxValidationCode(txFilter[i]) != peer.TxValidationCode_VALID {
+			continue
+		}
+
+		envelope := &common.Envelope{}
+		if err := proto.Unmarshal(envelopeBytes, envelope); err != nil {
+			return nil, nil, fmt.Errorf("failed to deserialize envelope in block %d: %w", blockNumber, err)
+		}
+
+		txAnchors, txHolds, err := parseEnvelope(envelope, blockNumber)
+		if err != nil {
+			return nil, nil, err
+		}
+		anchors = append(anchors, txAnchors...)
+		holds = append(holds, txHolds...)
+	}
+
+	return anchors, holds, nil
+}
+
+// parseEnvelope extracts the assets and holds written by the transaction in
+// envelope, which is assumed to be valid.
+func parseEnvelope(envelope *common.Envelope, blockNumber uint64) ([]Anchor, []Hold, error) {
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(envelope.GetPayload(), payload); err != nil {
+		return nil, nil, fmt.Errorf("failed to deserialize payload in block %d: %w", blockNumber, err)
+	}
+
+	channelHeader := &common.ChannelHeader{}
+	if err := proto.Unmarshal(payload.GetHeader().GetChannelHeader(), channelHeader); err != nil {
+		return nil, nil, fmt.Errorf("failed to deserialize channel header in block %d: %w", blockNumber, err)
+	}
+
+	if common.HeaderType(channelHeader.GetType()) != common.HeaderType_ENDORSER_TRANSACTION {
+		return nil, nil, nil
+	}
+
+	writes, err := parseChaincodeWrites(payload.GetData())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse transaction %s: %w", channelHeader.GetTxId(), err)
+	}
+
+	var anchors []Anchor
+	var holds []Hold
+	for _, write := range writes {
+		switch {
+		case strings.HasPrefix(write.GetKey(), assetKeyPrefix):
+			var asset rawChain
+			if err := json.Unmarshal(write.GetValue(), &asset); err != nil {
+				return nil, nil, fmt.Errorf("failed to decode asset %s: %w", write.GetKey(), err)
+			}
+			anchors = append(anchors, newAnchor(asset, channelHeader.GetTxId(), blockNumber))
+		case strings.HasPrefix(write.GetKey(), holdKeyPrefix):
+			var hold Hold
+			if err := json.Unmarshal(write.GetValue(), &hold); err != nil {
+				return nil, nil, fmt.Errorf("failed to decode hold %s: %w", write.GetKey(), err)
+			}
+			holds = append(holds, hold)
+		}
+	}
+	return anchors, holds, nil
+}
+
+// parseChaincodeWrites returns the asset and hold writes made by our chaincode
+// in a transaction.
+func parseChaincodeWrites(transactionBytes []byte) ([]*kvrwset.KVWrite, error) {
+	transaction := &peer.Transaction{}
+	if err := proto.Unmarshal(transactionBytes, transaction); err != nil {
+		return nil, fmt.Errorf("failed to deserialize transaction: %w", err)
+	}
+
+	var writes []*kvrwset.KVWrite
+	for _, action := range transaction.GetActions() {
+		actionPayload := &peer.ChaincodeActionPayload{}
+		if err := proto.Unmarshal(action.GetPayload(), actionPayload); err != nil {
+			return nil, fmt.Errorf("failed to deserialize chaincode action payload: %w", err)
+		}
+
+		responsePayload := &peer.ProposalResponsePayload{}
+		if err := proto.Unmarshal(actionPayload.GetAction().GetProposalResponsePayload(), responsePayload); err != nil {
+			return nil, fmt.Errorf("failed to deserialize proposal response payload: %w", err)
+		}
+
+		chaincodeAction := &peer.ChaincodeAction{}
+		if err := proto.Unmarshal(responsePayload.GetExtension(), chaincodeAction); err != nil {
+			return nil, fmt.Errorf("failed to deserialize chaincode action: %w", err)
+		}
+
+		txRwSet := &rwset.TxReadWriteSet{}
+		if err := proto.Unmarshal(chaincodeAction.GetResults(), txRwSet); err != nil {
+			return nil, fmt.Errorf("failed to deserialize read-write set: %w", err)
+		}
+
+		for _, nsRwSet := range txRwSet.GetNsRwset() {
+			if nsRwSet.GetNamespace() != ChaincodeName {
+				continue
+			}
+
+			kvRwSet := &kvrwset.KVRWSet{}
+			if err := proto.Unmarshal(nsRwSet.GetRwset(), kvRwSet); err != nil {
+				return nil, fmt.Errorf("failed to deserialize key-value read-write set: %w", err)
+			}
+
+			for _, write := range kvRwSet.GetWrites() {
+				if write.GetIsDelete() {
+					continue
+				}
+				writes = append(writes, write)
+			}
+		}
+	}
+
+	return writes, nil
+}
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+// endorserEnvelope wraps the writes of a namespace into a transaction
+// envelope the way a peer commits it.
+func endorserEnvelope(t *testing.T, headerType common.HeaderType, namespace string, writes ...*kvrwset.KVWrite) *common.Envelope {
+	t.Helper()
+	marshal := func(message proto.Message) []byte {
+		bytes, err := proto.Marshal(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bytes
+	}
+
+	results := marshal(&rwset.TxReadWriteSet{NsRwset: []*rwset.NsReadWriteSet{
+		{Namespace: namespace, Rwset: marshal(&kvrwset.KVRWSet{Writes: writes})},
+	}})
+	responsePayload := marshal(&peer.ProposalResponsePayload{Extension: marshal(&peer.ChaincodeAction{Results: results})})
+	transaction := marshal(&peer.Transaction{Actions: []*peer.TransactionAction{{
+		Payload: marshal(&peer.ChaincodeActionPayload{Action: &peer.ChaincodeEndorsedAction{ProposalResponsePayload: responsePayload}}),
+	}}})
+	channelHeader := marshal(&common.ChannelHeader{Type: int32(headerType), TxId: "tx-1"})
+	return &common.Envelope{Payload: marshal(&common.Payload{
+		Header: &common.Header{ChannelHeader: channelHeader},
+		Data:   transaction,
+	})}
+}
+
+func TestParseEnvelope(t *testing.T) {
+	asset := &kvrwset.KVWrite{
+		Key:   "asset:20240301T100000Z:1",
+		Value: []byte(`{"LogID":"asset:20240301T100000Z:1","BlobPath":"42","Hash":"h","Source":"app"}`),
+	}
+	hold := &kvrwset.KVWrite{Key: "hold:1", Value: []byte(`{"HoldID":"hold:1","Kind":"legal","Source":"app"}`)}
+	deleted := &kvrwset.KVWrite{Key: "asset:20240301T100000Z:2", IsDelete: true}
+
+	tests := []struct {
+		name        string
+		envelope    *common.Envelope
+		wantAnchors []string
+		wantHolds   []string
+		wantErr     bool
+	}{
+		{
+			name:        "asset and hold",
+			envelope:    endorserEnvelope(t, common.HeaderType_ENDORSER_TRANSACTION, ChaincodeName, asset, hold),
+			wantAnchors: []string{"asset:20240301T100000Z:1"},
+			wantHolds:   []string{"hold:1"},
+		},
+		{name: "deleted key", envelope: endorserEnvelope(t, common.HeaderType_ENDORSER_TRANSACTION, ChaincodeName, deleted)},
+		{name: "other chaincode", envelope: endorserEnvelope(t, common.HeaderType_ENDORSER_TRANSACTION, "other", asset)},
+		{name: "config transaction", envelope: endorserEnvelope(t, common.HeaderType_CONFIG, ChaincodeName, asset)},
+		{
+			name: "undecodable asset",
+			envelope: endorserEnvelope(t, common.HeaderType_ENDORSER_TRANSACTION, ChaincodeName,
+				&kvrwset.KVWrite{Key: "asset:x", Value: []byte("{")}),
+			wantErr: true,
+		},
+		{name: "undecodable payload", envelope: &common.Envelope{Payload: []byte{0xff}}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			anchors, holds, err := parseEnvelope(test.envelope, 7)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parseEnvelope() error = %v, want error %v", err, test.wantErr)
+			}
+			if len(anchors) != len(test.wantAnchors) || len(holds) != len(test.wantHolds) {
+				t.Fatalf("parseEnvelope() = %d anchors, %d holds; want %d, %d", len(anchors), len(holds), len(test.wantAnchors), len(test.wantHolds))
+			}
+			for i, anchor := range anchors {
+				if anchor.LogID != test.wantAnchors[i] || anchor.TxID != "tx-1" || anchor.BlockNumber != 7 || anchor.EntryID != 42 {
+					t.Errorf("anchor %d = %+v", i, anchor)
+				}
+			}
+			for i, hold := range holds {
+				if hold.HoldID != test.wantHolds[i] {
+					t.Errorf("hold %d = %+v", i, hold)
+				}
+			}
+		})
+	}
+}
@@ -1,14 +1,54 @@
 package internal
 
+import "time"
+
 const (
 	PORT          = "3001"
 	MspID         = "Org1MSP"
 	CryptoPath    = "../organizations/peerOrganizations/org1.example.com"
 	CertPath      = CryptoPath + "/users/User1@org1.example.com/msp/signcerts"
 	KeyPath       = CryptoPath + "/users/User1@org1.example.com/msp/keystore"
-	TlsCertPath   = CryptoPath + "/peers/peer0.org1.example.com/tls/ca.crt"
-	PeerEndpoint  = "dns:///localhost:7051"
-	GatewayPeer   = "peer0.org1.example.com"
 	ChaincodeName = "basic"
 	ChannelName   = "mychannel"
+
+	// DefaultIdentity names the identity used when no other one is chosen.
+	DefaultIdentity   = ""
+	DefaultWalletPath = "wallet"
+
+	DefaultDatabaseDSN = "host=localhost user=testuser password=testpass dbname=testdb port=5432 sslmode=disable"
+)
+
+const (
+	IndexerRetryDelay     = 5 * time.Second
+	HealthCheckTimeout    = 3 * time.Second
+	SpoolBacklogLimit     = 1000
+	ConnectTimeout        = 10 * time.Second
+	ShutdownTimeout       = 30 * time.Second
+	PeerHealthInterval    = 5 * time.Second
+	PeerRetryBackoff      = 500 * time.Millisecond
+	PeerRetryRounds       = 3
+	IngestBatchLimit      = 1000
+	IngestConcurrency     = 16
+	IngestBodyLimit       = 10 << 20
+	SyslogQueueSize       = 1024
+	SyslogMaxMessage      = 64 * 1024
+	SyslogReadTimeout     = 5 * time.Minute
+	MultilineFlush        = 2 * time.Second
+	MultilineMaxLines     = 500
+	DataKeyCacheTTL       = time.Minute
+	RetentionInterval     = time.Hour
+	ArchiveSegmentSize    = 10000
+	ArchiveCacheSegments  = 8
+	ArchiveRequestTimeout = time.Minute
+	LoadBatchSize         = 1000
+	VerifyConcurrency     = 8
 )
+
+var DefaultPeerEndpoints = []string{
+	"localhost:7051=peer0.org1.example.com",
+	"localhost:8051=peer1.org1.example.com",
+	"localhost:10051=peer2.org1.example.com",
+}
+
+// DefaultAllowedOrigins are the dashboard origins allowed by CORS.
+var DefaultAllowedOrigins = []string{"http://localhost:3000", "http://localhost:5173"}
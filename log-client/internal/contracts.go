@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"sort"
@@ -12,11 +13,12 @@ import (
 )
 
 type rawChain struct {
-	BlobPath  string `json:"BlobPath"`
-	Hash      string `json:"Hash"`
-	LogID     string `json:"LogID"`
-	Source    string `json:"Source"`
-	Timestamp string `json:"Timestamp"`
+	BlobPath    string            `json:"BlobPath"`
+	FieldHashes map[string]string `json:"FieldHashes"`
+	Hash        string            `json:"Hash"`
+	LogID       string            `json:"LogID"`
+	Source      string            `json:"Source"`
+	Timestamp   string            `json:"Timestamp"`
 }
 
 type rawPaginatedResult struct {
@@ -26,92 +28,239 @@ type rawPaginatedResult struct {
 	HasNextPage         bool        `json:"hasNextPage"`
 }
 
-func ReadLogs(contract *client.Contract, clientFilter string) ([]LogEntry, []string, error) {
-	evaluateResult, err := contract.EvaluateTransaction("GetAllAssets", clientFilter)
+func ReadLogs(ctx context.Context, connection *Connection, clientFilter string) ([]ChainEntry, error) {
+	var evaluateResult []byte
+	err := connection.Do(ctx, func(contract *client.Contract) (err error) {
+		evaluateResult, err = contract.EvaluateWithContext(ctx, "GetAllAssets", client.WithArguments(clientFilter))
+		return err
+	})
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	if len(evaluateResult) == 0 {
-		return nil, nil, nil
+		return nil, nil
 	}
 
-	var rawChain []rawChain
-	if err := json.Unmarshal([]byte(evaluateResult), &rawChain); err != nil {
-		return nil, nil, err
+	var assets []*rawChain
+	if err := json.Unmarshal([]byte(evaluateResult), &assets); err != nil {
+		return nil, err
 	}
 
 	// sort by timestamp
-	sort.SliceStable(rawChain, func(i, j int) bool {
-		return rawChain[i].Timestamp < rawChain[j].Timestamp
+	sort.SliceStable(assets, func(i, j int) bool {
+		return assets[i].Timestamp < assets[j].Timestamp
 	})
 
-	var logEntries []LogEntry
-	var hashes []string
+	return loadChainEntries(assets)
+}
 
-	// print out raw chain in nice format
-	for _, entry := range rawChain {
-		var logEntry LogEntry
-		dbId, _ := strconv.Atoi(entry.BlobPath)
-		_ = logEntry.LoadFromDB(uint(dbId))
-		logEntries = append(logEntries, logEntry)
-		hashes = append(hashes, entry.Hash)
+// ChainEntry is a ledger asset along with its off-chain entry. Err is
+// ErrLogEntryMissing when neither the database nor the archive has the entry,
+// which then only carries the ID and source the asset names.
+type ChainEntry struct {
+	LogID string
+	Hash  string
+	Entry LogEntry
+	Err   error
+}
+
+// loadChainEntries loads the off-chain entries of ledger assets in one go,
+// returning them in order.
+func loadChainEntries(records []*rawChain) ([]ChainEntry, error) {
+	ids := make([]uint, 0, len(records))
+	for _, record := range records {
+		dbId, _ := strconv.Atoi(record.BlobPath)
+		ids = append(ids, uint(dbId))
+	}
+	entries, err := LoadLogEntries(ids)
+	if err != nil {
+		return nil, err
 	}
+	return chainEntries(records, ids, entries), nil
+}
+
+// chainEntries pairs records with their loaded entries, marking and raising
+// an alert for those that are missing.
+func chainEntries(records []*rawChain, ids []uint, entries map[uint]LogEntry) []ChainEntry {
+	chained := make([]ChainEntry, 0, len(records))
+	for i, record := range records {
+		chainEntry := ChainEntry{LogID: record.LogID, Hash: record.Hash}
+		entry, ok := entries[ids[i]]
+		if !ok {
+			entry = LogEntry{ID: ids[i], Source: record.Source}
+			entry.raiseMissing()
+			chainEntry.Err = fmt.Errorf("%w: %d", ErrLogEntryMissing, ids[i])
+		}
+		chainEntry.Entry = entry
+		chained = append(chained, chainEntry)
+	}
+	return chained
+}
 
-	return logEntries, hashes, nil
+// WriteLog stores and anchors a log line as the identity mapped to its source.
+func WriteLog(ctx context.Context, connection *Connection, content string, clientID string) error {
+	return WriteLogAs(ctx, connection, content, clientID, connection.IdentityForSource(clientID))
 }
 
-func WriteLog(contract *client.Contract, content string, clientID string) error {
-	var logEntry LogEntry
-	logEntry.Content = strings.TrimSpace(content)
-	logEntry.Timestamp = time.Now()
-	logEntry.Source = clientID
-	err := logEntry.WriteToDB()
+// WriteLogAs stores and anchors a log line, submitting as the named wallet
+// identity. The line is redacted by the default redactor.
+func WriteLogAs(ctx context.Context, connection *Connection, content string, clientID string, identityName string) error {
+	redactor, err := DefaultRedactor()
 	if err != nil {
 		return err
 	}
+	return WriteLogWith(ctx, connection, content, clientID, identityName, WriteOptions{Redactor: redactor})
+}
 
-	logHash, err := logEntry.Hash()
+// WriteOptions controls how a log line is stored.
+type WriteOptions struct {
+	// Parser extracts the fields of the line, ParseFields when nil.
+	Parser Parser
+	// Redactor scrubs the line before anything of it is stored or hashed.
+	Redactor *Redactor
+}
+
+// WriteLogWith stores a log line as options configure and anchors it,
+// submitting as the named wallet identity.
+func WriteLogWith(ctx context.Context, connection *Connection, content string, clientID string, identityName string, options WriteOptions) error {
+	logEntry, err := newLogEntry(LogInput{Source: clientID, Content: content}, options)
 	if err != nil {
 		return err
 	}
+	if err := logEntry.WriteToDB(); err != nil {
+		return err
+	}
 
-	_, commit, err := contract.SubmitAsync("CreateAsset", client.WithArguments(fmt.Sprint(logEntry.ID), logHash, clientID))
+	_, err = anchorStoredEntry(ctx, connection, identityName, *logEntry, nil)
+	return err
+}
+
+// newLogEntry builds the entry stored for a watched or pushed log line,
+// redacted, parsed, salted and sealed as options configure. Its event time is
+// the one given, else the one parsed from its fields.
+func newLogEntry(input LogInput, options WriteOptions) (*LogEntry, error) {
+	if options.Parser == nil {
+		options.Parser = ParseFields
+	}
+
+	logEntry := &LogEntry{
+		Content:          strings.TrimSpace(options.Redactor.Redact(input.Content)),
+		Timestamp:        time.Now(),
+		Source:           input.Source,
+		Labels:           options.Redactor.RedactLabels(input.Labels),
+		RedactionVersion: options.Redactor.Version(),
+	}
+	logEntry.Fields = options.Parser(logEntry.Content)
+	if input.EventTime != nil {
+		logEntry.setEventTime(*input.EventTime)
+	} else if eventTime, ok := parsedEventTime(logEntry.Fields); ok {
+		logEntry.setEventTime(eventTime)
+	}
+
+	salt, err := newFieldSalt()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	logEntry.FieldSalt = salt
+	if err := logEntry.sealContent(); err != nil {
+		return nil, err
+	}
+	return logEntry, nil
+}
+
+// anchorStoredEntry anchors an entry already written to the database and
+// raises an alert when it cannot be anchored. submitted, when given, learns
+// the ID of the transaction once it is submitted.
+func anchorStoredEntry(ctx context.Context, connection *Connection, identityName string, logEntry LogEntry, submitted func(txID string)) (*Receipt, error) {
+	receipt, err := anchorLogEntry(ctx, connection, identityName, logEntry, submitted)
+	if err != nil {
+		raiseAlert(Alert{
+			Kind:    AlertAnchorFailure,
+			Source:  logEntry.Source,
+			EntryID: logEntry.ID,
+			Message: fmt.Sprintf("log entry %d was stored but could not be anchored: %v", logEntry.ID, err),
+		})
+		return nil, err
+	}
+
+	return receipt, nil
+}
+
+// anchorLogEntry creates the ledger asset holding the hash of a stored log entry.
+func anchorLogEntry(ctx context.Context, connection *Connection, identityName string, logEntry LogEntry, submitted func(txID string)) (*Receipt, error) {
+	// the entry stays in the spool until its anchoring transaction is resolved
+	spoolAdd()
+	defer spoolDone()
+
+	logHash, err := logEntry.Hash()
+	if err != nil {
+		return nil, err
+	}
+	fieldHashes, err := json.Marshal(logEntry.FieldHashes())
+	if err != nil {
+		return nil, err
 	}
 
-	if commitStatus, err := commit.Status(); err != nil {
+	// endorse and submit may fail over to another peer; the commit status is
+	// then awaited on the peer that accepted the transaction
+	transaction, commit, err := connection.SubmitAs(ctx, identityName, "CreateAssetWithFields",
+		fmt.Sprint(logEntry.ID), logHash, logEntry.Source, string(fieldHashes))
+	if err != nil {
+		return nil, err
+	}
+	// the transaction may still commit should waiting for it fail
+	if submitted != nil {
+		submitted(transaction.TransactionID())
+	}
+	if err := awaitCommit(ctx, commit); err != nil {
+		return nil, err
+	}
+
+	// CreateAsset returns the ledger key of the new asset
+	return &Receipt{
+		EntryID: logEntry.ID,
+		Source:  logEntry.Source,
+		LogID:   string(transaction.Result()),
+		TxID:    transaction.TransactionID(),
+		Status:  ReceiptCommitted,
+	}, nil
+}
+
+// awaitCommit waits for a submitted transaction to commit and fails unless it
+// committed successfully.
+func awaitCommit(ctx context.Context, commit *client.Commit) error {
+	start := time.Now()
+	commitStatus, err := commit.StatusWithContext(ctx)
+	observeSince(fabricDuration.WithLabelValues("commit"), start)
+	if err != nil {
 		return err
 	} else if !commitStatus.Successful {
+		commitFailures.WithLabelValues(commitStatus.Code.String()).Inc()
 		return fmt.Errorf("transaction %s failed to commit with status: %d", commitStatus.TransactionID, int32(commitStatus.Code))
 	}
-
 	return nil
 }
 
-func ReadLogsWithPagination(contract *client.Contract, clientFilter string, pageSize int, bookmark string) ([]LogEntry, []string, string, bool, error) {
-	evaluateResult, err := contract.EvaluateTransaction("GetAssetsWithFilter", clientFilter, strconv.Itoa(pageSize), bookmark)
+func ReadLogsWithPagination(ctx context.Context, connection *Connection, clientFilter string, pageSize int, bookmark string) ([]ChainEntry, string, bool, error) {
+	var evaluateResult []byte
+	err := connection.Do(ctx, func(contract *client.Contract) (err error) {
+		evaluateResult, err = contract.EvaluateWithContext(ctx, "GetAssetsWithFilter", client.WithArguments(clientFilter, strconv.Itoa(pageSize), bookmark))
+		return err
+	})
 	if err != nil {
-		return nil, nil, "", false, err
+		return nil, "", false, err
 	}
 
 	var rawPaginatedResult rawPaginatedResult
 	if err := json.Unmarshal([]byte(evaluateResult), &rawPaginatedResult); err != nil {
-		return nil, nil, "", false, err
+		return nil, "", false, err
 	}
 
-	var logEntries []LogEntry
-	var hashes []string
-
-	// print out raw chain in nice format
-	for _, entry := range rawPaginatedResult.Records {
-		var logEntry LogEntry
-		dbId, _ := strconv.Atoi(entry.BlobPath)
-		_ = logEntry.LoadFromDB(uint(dbId))
-		logEntries = append(logEntries, logEntry)
-		hashes = append(hashes, entry.Hash)
+	entries, err := loadChainEntries(rawPaginatedResult.Records)
+	if err != nil {
+		return nil, "", false, err
 	}
 
-	return logEntries, hashes, rawPaginatedResult.Bookmark, rawPaginatedResult.HasNextPage, nil
+	return entries, rawPaginatedResult.Bookmark, rawPaginatedResult.HasNextPage, nil
 }
@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestChainEntries(t *testing.T) {
+	stored := LogEntry{ID: 1, Source: "app", Content: "started"}
+	records := []*rawChain{
+		{LogID: "asset:1", BlobPath: "1", Hash: "h1", Source: "app"},
+		{LogID: "asset:2", BlobPath: "2", Hash: "h2", Source: "db"},
+		{LogID: "asset:3", BlobPath: "not-an-id", Hash: "h3", Source: "app"},
+	}
+
+	tests := []struct {
+		name      string
+		record    int
+		wantID    uint
+		wantEntry string
+		wantErr   error
+	}{
+		{name: "stored", record: 0, wantID: 1, wantEntry: "started"},
+		{name: "missing from the database", record: 1, wantID: 2, wantErr: ErrLogEntryMissing},
+		{name: "unreadable blob path", record: 2, wantErr: ErrLogEntryMissing},
+	}
+
+	got := chainEntries(records, []uint{1, 2, 0}, map[uint]LogEntry{1: stored})
+	if len(got) != len(records) {
+		t.Fatalf("chainEntries() returned %d entries, want %d", len(got), len(records))
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chainEntry := got[test.record]
+			record := records[test.record]
+			if chainEntry.LogID != record.LogID || chainEntry.Hash != record.Hash {
+				t.Errorf("chainEntries() = %s %s, want %s %s", chainEntry.LogID, chainEntry.Hash, record.LogID, record.Hash)
+			}
+			if !errors.Is(chainEntry.Err, test.wantErr) || (test.wantErr == nil) != (chainEntry.Err == nil) {
+				t.Errorf("chainEntries() error = %v, want %v", chainEntry.Err, test.wantErr)
+			}
+			// missing entries keep the ID and source of their asset, never a zero entry
+			if chainEntry.Entry.ID != test.wantID || chainEntry.Entry.Source != record.Source || chainEntry.Entry.Content != test.wantEntry {
+				t.Errorf("chainEntries() entry = %+v", chainEntry.Entry)
+			}
+		})
+	}
+}
@@ -1,31 +1,130 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
-var dbInstance *gorm.DB
+// databases holds the shared connections, which are opened on first use by
+// whichever goroutine gets there first.
+var databases struct {
+	sync.Mutex
+	db          *gorm.DB
+	maintenance *gorm.DB
+}
+
+// DatabaseConfig holds the DSNs of the database logins. DSN is the login of
+// the gateway and the other commands, granted log_ingest and log_reader.
+// MigrationDSN owns the schema and applies migrations. MaintenanceDSN is the
+// only member of log_maintenance, which archival and shredding need. Both
+// default to DSN, which suits a development database with one superuser.
+type DatabaseConfig struct {
+	DSN            string
+	MigrationDSN   string
+	MaintenanceDSN string
+}
+
+// DatabaseConfigFromEnv reads DATABASE_DSN, MIGRATION_DSN and MAINTENANCE_DSN.
+func DatabaseConfigFromEnv() DatabaseConfig {
+	dsn := getEnv("DATABASE_DSN", DefaultDatabaseDSN)
+	return DatabaseConfig{
+		DSN:            dsn,
+		MigrationDSN:   getEnv("MIGRATION_DSN", dsn),
+		MaintenanceDSN: getEnv("MAINTENANCE_DSN", dsn),
+	}
+}
 
+// InitDB opens the shared database connection, failing with
+// ErrSchemaMismatch unless the schema is at LatestSchemaVersion. Migrations
+// are applied by the migrate command, never implicitly.
 func InitDB() (*gorm.DB, error) {
-	if dbInstance != nil {
-		return dbInstance, nil
+	databases.Lock()
+	defer databases.Unlock()
+
+	if databases.db != nil {
+		return databases.db, nil
 	}
-	dsn := "host=localhost user=testuser password=testpass dbname=testdb port=5432 sslmode=disable"
+	db, err := openDB(DatabaseConfigFromEnv().DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkSchema(db); err != nil {
+		closeDB(db)
+		return nil, err
+	}
+
+	databases.db = db
+	return db, nil
+}
+
+func openDB(dsn string) (*gorm.DB, error) {
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
+	return db, nil
+}
+
+func closeDB(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
 
-	if err := db.AutoMigrate(&LogEntry{}); err != nil {
-		return nil, fmt.Errorf("failed to migrate database: %w", err)
+// CloseDB closes the shared database connections.
+func CloseDB() error {
+	databases.Lock()
+	defer databases.Unlock()
+
+	var errs []error
+	if databases.db != nil {
+		errs = append(errs, closeDB(databases.db))
+		databases.db = nil
+	}
+	if databases.maintenance != nil {
+		errs = append(errs, closeDB(databases.maintenance))
+		databases.maintenance = nil
 	}
+	return errors.Join(errs...)
+}
 
-	dbInstance = db
-	return dbInstance, nil
+// maintain runs fn in a maintenance transaction as the login of
+// MAINTENANCE_DSN, which may delete archived log entries and clear parsed
+// fields despite the append-only triggers.
+func maintain(fn func(tx *gorm.DB) error) error {
+	db, err := maintenanceDB()
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SET LOCAL log_client.maintenance = 'on'").Error; err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+func maintenanceDB() (*gorm.DB, error) {
+	databases.Lock()
+	defer databases.Unlock()
+
+	if databases.maintenance == nil {
+		db, err := openDB(DatabaseConfigFromEnv().MaintenanceDSN)
+		if err != nil {
+			return nil, err
+		}
+		databases.maintenance = db
+	}
+	return databases.maintenance, nil
 }
@@ -0,0 +1,512 @@
+package internal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// encryptedPrefix marks content sealed by an Encryptor:
+// enc:v1:<data key id>:<base64 of nonce and ciphertext>
+const encryptedPrefix = "enc:v1:"
+
+// ErrDataKeyShredded is returned when content is opened whose data key has
+// been destroyed.
+var ErrDataKeyShredded = errors.New("data key has been shredded")
+
+// ErrDataKeyNotFound is returned when shredding a key that does not exist or
+// is already shredded.
+var ErrDataKeyNotFound = errors.New("data key not found")
+
+// EncryptionConfig selects the master key that wraps the data keys, either a
+// 32-byte AES key in MasterKeyFile or the AES key labelled HSMKey in the token
+// configured through HSM_*. KeyPeriod scopes data keys to a source and, when
+// set to "day" or "month", to the period an entry was written in.
+type EncryptionConfig struct {
+	MasterKeyFile string
+	HSMKey        string
+	KeyPeriod     string
+}
+
+// EncryptionConfigFromEnv reads ENCRYPTION_MASTER_KEY_FILE, ENCRYPTION_HSM_KEY
+// and ENCRYPTION_KEY_PERIOD.
+func EncryptionConfigFromEnv() EncryptionConfig {
+	return EncryptionConfig{
+		MasterKeyFile: getEnv("ENCRYPTION_MASTER_KEY_FILE", ""),
+		HSMKey:        getEnv("ENCRYPTION_HSM_KEY", ""),
+		KeyPeriod:     getEnv("ENCRYPTION_KEY_PERIOD", ""),
+	}
+}
+
+// Enabled reports whether content is encrypted at all.
+func (c EncryptionConfig) Enabled() bool {
+	return c.MasterKeyFile != "" || c.HSMKey != ""
+}
+
+// DataKey is a content key, stored only wrapped by the master key. Shredding
+// drops the wrapped key, which leaves the content it sealed unreadable.
+type DataKey struct {
+	ID         string `gorm:"primaryKey"`
+	Source     string `gorm:"uniqueIndex:idx_data_keys_scope,where:shredded_at IS NULL"`
+	Period     string `gorm:"uniqueIndex:idx_data_keys_scope,where:shredded_at IS NULL"`
+	WrappedKey []byte `json:"-"`
+	CreatedAt  time.Time
+	ShreddedAt *time.Time
+}
+
+// KeyWrapper encrypts data keys under a master key that never leaves it.
+type KeyWrapper interface {
+	Wrap(key []byte) ([]byte, error)
+	Unwrap(wrapped []byte) ([]byte, error)
+}
+
+// Encryptor seals log content with per-scope data keys. A nil Encryptor
+// leaves content as it is. Unwrapped keys are cached for DataKeyCacheTTL, so
+// that keys shredded by another process soon stop being used.
+type Encryptor struct {
+	wrapper KeyWrapper
+	period  string
+
+	mu     sync.Mutex
+	keys   map[string]cachedKey
+	scopes map[string]string
+}
+
+type cachedKey struct {
+	key    []byte
+	loaded time.Time
+}
+
+// NewEncryptor loads the master key of config, returning nil when encryption
+// is not enabled.
+func NewEncryptor(config EncryptionConfig) (*Encryptor, error) {
+	if !config.Enabled() {
+		return nil, nil
+	}
+	switch config.KeyPeriod {
+	case "", "day", "month":
+	default:
+		return nil, fmt.Errorf("unknown encryption key period %q, expected day or month", config.KeyPeriod)
+	}
+
+	var wrapper KeyWrapper
+	var err error
+	if config.HSMKey != "" {
+		hsmConfig := HSMConfigFromEnv()
+		if hsmConfig == nil {
+			return nil, fmt.Errorf("ENCRYPTION_HSM_KEY is set but HSM_LIBRARY is not")
+		}
+		wrapper, err = newHSMKeyWrapper(*hsmConfig, config.HSMKey)
+	} else {
+		wrapper, err = newFileKeyWrapper(config.MasterKeyFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Encryptor{
+		wrapper: wrapper,
+		period:  config.KeyPeriod,
+		keys:    map[string]cachedKey{},
+		scopes:  map[string]string{},
+	}, nil
+}
+
+// Seal encrypts content under the data key of source for the period of at,
+// creating the key on first use, and returns the sealed content with the ID
+// of its key. A nil Encryptor returns content unchanged.
+func (e *Encryptor) Seal(content string, source string, at time.Time) (string, string, error) {
+	if e == nil {
+		return content, "", nil
+	}
+
+	keyID, key, err := e.scopeKey(source, e.periodOf(at))
+	if err != nil {
+		return "", "", err
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return "", "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", "", err
+	}
+	// the source is authenticated so that content cannot be moved between sources
+	sealed := aead.Seal(nonce, nonce, []byte(content), []byte(source))
+
+	return encryptedPrefix + keyID + ":" + base64.StdEncoding.EncodeToString(sealed), keyID, nil
+}
+
+// Open decrypts content sealed by Seal and returns other content unchanged.
+// It fails with ErrDataKeyShredded once the data key has been destroyed.
+func (e *Encryptor) Open(content string, source string) (string, error) {
+	keyID, sealed, ok := parseSealed(content)
+	if !ok {
+		return content, nil
+	}
+	if e == nil {
+		return "", fmt.Errorf("content is encrypted with data key %s but encryption is not configured", keyID)
+	}
+
+	key, err := e.key(keyID)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("sealed content is too short")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(source))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt content with data key %s: %w", keyID, err)
+	}
+	return string(plaintext), nil
+}
+
+func (e *Encryptor) periodOf(at time.Time) string {
+	switch e.period {
+	case "day":
+		return at.UTC().Format("2006-01-02")
+	case "month":
+		return at.UTC().Format("2006-01")
+	}
+	return ""
+}
+
+// scopeKey returns the live data key of a source and period, creating it when
+// there is none.
+func (e *Encryptor) scopeKey(source string, period string) (string, []byte, error) {
+	scope := source + "\x00" + period
+
+	e.mu.Lock()
+	keyID, ok := e.scopes[scope]
+	e.mu.Unlock()
+	if ok {
+		if key, ok := e.cached(keyID); ok {
+			return keyID, key, nil
+		}
+	}
+
+	db, err := InitDB()
+	if err != nil {
+		return "", nil, err
+	}
+
+	key := make([]byte, 32)
+	id := make([]byte, 8)
+	if _, err := rand.Read(key); err != nil {
+		return "", nil, err
+	}
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+	wrapped, err := e.wrapper.Wrap(key)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	// another writer may create the key of the scope first, whose key is then used
+	dataKey := DataKey{ID: hex.EncodeToString(id), Source: source, Period: period, WrappedKey: wrapped}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&dataKey).Error; err != nil {
+		return "", nil, fmt.Errorf("failed to store data key: %w", err)
+	}
+	if err := db.Where("source = ? AND period = ? AND shredded_at IS NULL", source, period).First(&dataKey).Error; err != nil {
+		return "", nil, fmt.Errorf("failed to load data key: %w", err)
+	}
+	if key, err = e.wrapper.Unwrap(dataKey.WrappedKey); err != nil {
+		return "", nil, fmt.Errorf("failed to unwrap data key %s: %w", dataKey.ID, err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.scopes[scope] = dataKey.ID
+	e.keys[dataKey.ID] = cachedKey{key: key, loaded: time.Now()}
+	return dataKey.ID, key, nil
+}
+
+// key returns the unwrapped data key with the given ID.
+func (e *Encryptor) key(keyID string) ([]byte, error) {
+	if key, ok := e.cached(keyID); ok {
+		return key, nil
+	}
+
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+	var dataKey DataKey
+	if err := db.First(&dataKey, "id = ?", keyID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load data key %s: %w", keyID, err)
+	}
+	if dataKey.ShreddedAt != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDataKeyShredded, keyID)
+	}
+	key, err := e.wrapper.Unwrap(dataKey.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key %s: %w", keyID, err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.keys[keyID] = cachedKey{key: key, loaded: time.Now()}
+	return key, nil
+}
+
+func (e *Encryptor) cached(keyID string) ([]byte, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	cached, ok := e.keys[keyID]
+	if !ok || time.Since(cached.loaded) > DataKeyCacheTTL {
+		return nil, false
+	}
+	return cached.key, true
+}
+
+// forget drops a data key from the cache.
+func (e *Encryptor) forget(keyID string) {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.keys, keyID)
+	for scope, id := range e.scopes {
+		if id == keyID {
+			delete(e.scopes, scope)
+		}
+	}
+}
+
+func parseSealed(content string) (keyID string, sealed []byte, ok bool) {
+	rest, found := strings.CutPrefix(content, encryptedPrefix)
+	if !found {
+		return "", nil, false
+	}
+	keyID, encoded, found := strings.Cut(rest, ":")
+	if !found {
+		return "", nil, false
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", nil, false
+	}
+	return keyID, sealed, true
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// fileKeyWrapper wraps data keys with AES-GCM under a master key read from a
+// file.
+type fileKeyWrapper struct {
+	aead cipher.AEAD
+}
+
+// newFileKeyWrapper reads a 32-byte master key, stored raw or hex or base64
+// encoded.
+func newFileKeyWrapper(path string) (*fileKeyWrapper, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read master key: %w", err)
+	}
+
+	key := data
+	text := strings.TrimSpace(string(data))
+	if decoded, err := hex.DecodeString(text); err == nil && len(decoded) == 32 {
+		key = decoded
+	} else if decoded, err := base64.StdEncoding.DecodeString(text); err == nil && len(decoded) == 32 {
+		key = decoded
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("master key in %s must be 32 bytes, got %d", path, len(key))
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &fileKeyWrapper{aead: aead}, nil
+}
+
+func (w *fileKeyWrapper) Wrap(key []byte) ([]byte, error) {
+	nonce := make([]byte, w.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return w.aead.Seal(nonce, nonce, key, nil), nil
+}
+
+func (w *fileKeyWrapper) Unwrap(wrapped []byte) ([]byte, error) {
+	if len(wrapped) < w.aead.NonceSize() {
+		return nil, fmt.Errorf("wrapped key is too short")
+	}
+	return w.aead.Open(nil, wrapped[:w.aead.NonceSize()], wrapped[w.aead.NonceSize():], nil)
+}
+
+var defaultEncryptor = struct {
+	once      sync.Once
+	encryptor *Encryptor
+	err       error
+}{}
+
+// DefaultEncryptor returns the encryptor configured by the environment, which
+// seals the content of every stored entry.
+func DefaultEncryptor() (*Encryptor, error) {
+	defaultEncryptor.once.Do(func() {
+		defaultEncryptor.encryptor, defaultEncryptor.err = NewEncryptor(EncryptionConfigFromEnv())
+	})
+	return defaultEncryptor.encryptor, defaultEncryptor.err
+}
+
+// sealContent encrypts the content and label values of an entry about to be
+// stored with the default encryptor.
+func (l *LogEntry) sealContent() error {
+	encryptor, err := DefaultEncryptor()
+	if err != nil {
+		return err
+	}
+	return l.sealWith(encryptor)
+}
+
+// sealWith encrypts the content and label values of an entry with encryptor,
+// which is nil when encryption is off. Label names stay readable, while the
+// parsed fields are dropped, since they would give the content away.
+func (l *LogEntry) sealWith(encryptor *Encryptor) error {
+	content, keyID, err := encryptor.Seal(l.Content, l.Source, l.Timestamp)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt log entry: %w", err)
+	}
+	l.Content = content
+	if keyID != "" {
+		l.DataKeyID = &keyID
+		l.Fields = nil
+	}
+
+	if encryptor == nil || len(l.Labels) == 0 {
+		return nil
+	}
+	labels := make(map[string]string, len(l.Labels))
+	for name, value := range l.Labels {
+		if labels[name], _, err = encryptor.Seal(value, l.Source, l.Timestamp); err != nil {
+			return fmt.Errorf("failed to encrypt label %s: %w", name, err)
+		}
+	}
+	l.Labels = labels
+	return nil
+}
+
+// Plaintext returns the content of the entry, decrypted when it is sealed.
+func (l LogEntry) Plaintext() (string, error) {
+	encryptor, err := DefaultEncryptor()
+	if err != nil {
+		return "", err
+	}
+	return encryptor.Open(l.Content, l.Source)
+}
+
+// PlaintextLabels returns the labels of the entry, their values decrypted
+// when they are sealed.
+func (l LogEntry) PlaintextLabels() (map[string]string, error) {
+	encryptor, err := DefaultEncryptor()
+	if err != nil {
+		return nil, err
+	}
+	if len(l.Labels) == 0 {
+		return l.Labels, nil
+	}
+
+	labels := make(map[string]string, len(l.Labels))
+	for name, value := range l.Labels {
+		if labels[name], err = encryptor.Open(value, l.Source); err != nil {
+			return nil, err
+		}
+	}
+	return labels, nil
+}
+
+// ListDataKeys returns the data keys of a source, or of every source when
+// source is empty, oldest first.
+func ListDataKeys(source string) ([]DataKey, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+
+	query := db.Order("created_at")
+	if source != "" {
+		query = query.Where("source = ?", source)
+	}
+	var keys []DataKey
+	if err := query.Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to list data keys: %w", err)
+	}
+	return keys, nil
+}
+
+// ShredDataKey destroys a data key, making the content it sealed unreadable
+// while the entries and their anchors remain. The parsed fields of those
+// entries, which are not hashed, are erased along with it. It fails with
+// ErrHeld while a hold covers any of the entries.
+func ShredDataKey(keyID string) error {
+	err := maintain(func(tx *gorm.DB) error {
+		// the key is locked first, then holds cannot change until the key is
+		// shredded, so that a hold placed meanwhile is either seen or waits
+		var dataKey DataKey
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&dataKey, "id = ? AND shredded_at IS NULL", keyID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: %s", ErrDataKeyNotFound, keyID)
+		} else if err != nil {
+			return fmt.Errorf("failed to load data key %s: %w", keyID, err)
+		}
+		if err := tx.Exec("LOCK TABLE holds IN SHARE MODE").Error; err != nil {
+			return err
+		}
+		if err := checkHolds(tx, dataKey.Source, tx.Model(&LogEntry{}).Select("id").Where("data_key_id = ?", keyID)); err != nil {
+			return err
+		}
+		if err := checkHolds(tx, dataKey.Source, tx.Model(&ArchivedEntry{}).Select("entry_id").Where("data_key_id = ?", keyID)); err != nil {
+			return err
+		}
+
+		err = tx.Model(&DataKey{}).
+			Where("id = ?", keyID).
+			Updates(map[string]any{"wrapped_key": nil, "shredded_at": time.Now()}).Error
+		if err != nil {
+			return fmt.Errorf("failed to shred data key %s: %w", keyID, err)
+		}
+		if err := tx.Model(&LogEntry{}).Where("data_key_id = ?", keyID).Update("fields", gorm.Expr("NULL")).Error; err != nil {
+			return fmt.Errorf("failed to shred data key %s: %w", keyID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	encryptor, _ := DefaultEncryptor()
+	encryptor.forget(keyID)
+	return nil
+}
@@ -0,0 +1,244 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncryptorSealOpen(t *testing.T) {
+	// the data key of source "app" is cached, so no database is needed
+	encryptor := &Encryptor{
+		keys:   map[string]cachedKey{"k1": {key: bytes.Repeat([]byte{0x42}, 32), loaded: time.Now()}},
+		scopes: map[string]string{"app\x00": "k1"},
+	}
+	sealed, keyID, err := encryptor.Seal("level=error password=hunter2", "app", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID != "k1" || !strings.HasPrefix(sealed, encryptedPrefix+"k1:") || strings.Contains(sealed, "hunter2") {
+		t.Fatalf("Seal() = %q, %q", sealed, keyID)
+	}
+	again, _, err := encryptor.Seal("level=error password=hunter2", "app", time.Now())
+	if err != nil || again == sealed {
+		t.Errorf("sealing twice gave the same ciphertext")
+	}
+
+	_, encoded, _ := strings.Cut(strings.TrimPrefix(sealed, encryptedPrefix), ":")
+	raw, _ := base64.StdEncoding.DecodeString(encoded)
+	raw[len(raw)-1] ^= 1
+	tampered := encryptedPrefix + "k1:" + base64.StdEncoding.EncodeToString(raw)
+
+	tests := []struct {
+		name      string
+		encryptor *Encryptor
+		content   string
+		source    string
+		want      string
+		wantErr   bool
+	}{
+		{name: "sealed", encryptor: encryptor, content: sealed, source: "app", want: "level=error password=hunter2"},
+		{name: "plaintext", encryptor: encryptor, content: "not sealed", source: "app", want: "not sealed"},
+		{name: "plaintext without encryption", content: "not sealed", source: "app", want: "not sealed"},
+		{name: "sealed without encryption", content: sealed, source: "app", wantErr: true},
+		{name: "other source", encryptor: encryptor, content: sealed, source: "db", wantErr: true},
+		{name: "tampered ciphertext", encryptor: encryptor, content: tampered, source: "app", wantErr: true},
+		{name: "truncated ciphertext", encryptor: encryptor, content: encryptedPrefix + "k1:AAAA", source: "app", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.encryptor.Open(test.content, test.source)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Open() error = %v, want error %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("Open() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNilEncryptorSeal(t *testing.T) {
+	var encryptor *Encryptor
+	sealed, keyID, err := encryptor.Seal("content", "app", time.Now())
+	if err != nil || sealed != "content" || keyID != "" {
+		t.Errorf("Seal() = %q, %q, %v", sealed, keyID, err)
+	}
+}
+
+func TestEncryptorPeriodOf(t *testing.T) {
+	at := time.Date(2024, 3, 31, 23, 30, 0, 0, time.FixedZone("", -2*60*60))
+
+	tests := []struct {
+		period string
+		want   string
+	}{
+		{period: "", want: ""},
+		{period: "day", want: "2024-04-01"},
+		{period: "month", want: "2024-04"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.period, func(t *testing.T) {
+			encryptor := &Encryptor{period: test.period}
+			if got := encryptor.periodOf(at); got != test.want {
+				t.Errorf("periodOf() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseSealed(t *testing.T) {
+	tests := []struct {
+		content string
+		keyID   string
+		sealed  []byte
+		ok      bool
+	}{
+		{content: "enc:v1:abc:AQID", keyID: "abc", sealed: []byte{1, 2, 3}, ok: true},
+		{content: "plain text"},
+		{content: "enc:v1:abc"},
+		{content: "enc:v1:abc:not base64!"},
+		{content: "enc:v2:abc:AQID"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.content, func(t *testing.T) {
+			keyID, sealed, ok := parseSealed(test.content)
+			if ok != test.ok || keyID != test.keyID || !bytes.Equal(sealed, test.sealed) {
+				t.Errorf("parseSealed() = %q, %v, %v", keyID, sealed, ok)
+			}
+		})
+	}
+}
+
+func TestFileKeyWrapper(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{name: "raw", data: key},
+		{name: "hex", data: []byte(hex.EncodeToString(key) + "\n")},
+		{name: "base64", data: []byte(base64.StdEncoding.EncodeToString(key))},
+		{name: "too short", data: key[:16], wantErr: true},
+		{name: "hex too long", data: []byte(hex.EncodeToString(append(key, 7))), wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "master.key")
+			if err := os.WriteFile(path, test.data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			wrapper, err := newFileKeyWrapper(path)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("newFileKeyWrapper() error = %v, want error %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+
+			dataKey := bytes.Repeat([]byte{9}, 32)
+			wrapped, err := wrapper.Wrap(dataKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			unwrapped, err := wrapper.Unwrap(wrapped)
+			if err != nil || !bytes.Equal(unwrapped, dataKey) {
+				t.Errorf("Unwrap() = %x, %v", unwrapped, err)
+			}
+			wrapped[len(wrapped)-1] ^= 1
+			if _, err := wrapper.Unwrap(wrapped); err == nil {
+				t.Error("Unwrap() accepted a tampered key")
+			}
+		})
+	}
+}
+
+func TestNewEncryptor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "master.key")
+	if err := os.WriteFile(path, bytes.Repeat([]byte{7}, 32), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		config  EncryptionConfig
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "disabled", wantNil: true},
+		{name: "master key file", config: EncryptionConfig{MasterKeyFile: path, KeyPeriod: "month"}},
+		{name: "unknown period", config: EncryptionConfig{MasterKeyFile: path, KeyPeriod: "week"}, wantErr: true},
+		{name: "missing file", config: EncryptionConfig{MasterKeyFile: path + ".missing"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encryptor, err := NewEncryptor(test.config)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("NewEncryptor() error = %v, want error %v", err, test.wantErr)
+			}
+			if !test.wantErr && (encryptor == nil) != test.wantNil {
+				t.Errorf("NewEncryptor() = %v, want nil %v", encryptor, test.wantNil)
+			}
+		})
+	}
+}
+
+func TestSealWithDropsFields(t *testing.T) {
+	encryptor := &Encryptor{
+		keys:   map[string]cachedKey{"k1": {key: bytes.Repeat([]byte{0x42}, 32), loaded: time.Now()}},
+		scopes: map[string]string{"app\x00": "k1"},
+	}
+	content := `{"level":"error","user":"alice","password":"hunter2"}`
+
+	tests := []struct {
+		name       string
+		encryptor  *Encryptor
+		wantFields bool
+	}{
+		{name: "encrypted", encryptor: encryptor},
+		{name: "not encrypted", wantFields: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entry := LogEntry{Content: content, Source: "app", Timestamp: time.Now(), Labels: map[string]string{"user": "alice"}}
+			entry.Fields = ParseFields(entry.Content)
+			if err := entry.sealWith(test.encryptor); err != nil {
+				t.Fatal(err)
+			}
+
+			if test.wantFields {
+				if entry.Fields["password"] != "hunter2" {
+					t.Errorf("Fields = %v, want the parsed fields", entry.Fields)
+				}
+				return
+			}
+			if entry.Fields != nil {
+				t.Errorf("Fields = %v, want none for an encrypted entry", entry.Fields)
+			}
+			stored, err := json.Marshal(entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, plaintext := range []string{"hunter2", "alice"} {
+				if strings.Contains(string(stored), plaintext) {
+					t.Errorf("stored entry %s contains %q", stored, plaintext)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ParseFields extracts the fields of a structured log line, either a JSON
+// object or logfmt. Nested JSON objects are flattened to dotted keys, so
+// {"user":{"id":42}} yields user.id=42. Values are kept as text: strings
+// as they are and any other JSON value in its JSON form. Lines in neither
+// format have no fields.
+func ParseFields(content string) map[string]string {
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, "{") {
+		return parseJSONFields(content)
+	}
+	return parseLogfmtFields(content)
+}
+
+// ParseFieldPredicates parses key=value predicates, as given to the field
+// parameter of GET /log.
+func ParseFieldPredicates(predicates []string) (map[string]string, error) {
+	if len(predicates) == 0 {
+		return nil, nil
+	}
+
+	fields := make(map[string]string, len(predicates))
+	for _, predicate := range predicates {
+		key, value, ok := strings.Cut(predicate, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid field predicate %q, expected key=value", predicate)
+		}
+		fields[key] = value
+	}
+	return fields, nil
+}
+
+func parseJSONFields(content string) map[string]string {
+	decoder := json.NewDecoder(strings.NewReader(content))
+	decoder.UseNumber()
+
+	var document map[string]any
+	if err := decoder.Decode(&document); err != nil || decoder.More() {
+		return nil
+	}
+
+	fields := map[string]string{}
+	flattenJSONFields(fields, "", document)
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+func flattenJSONFields(fields map[string]string, prefix string, document map[string]any) {
+	for key, value := range document {
+		switch v := value.(type) {
+		case map[string]any:
+			flattenJSONFields(fields, prefix+key+".", v)
+		case string:
+			fields[prefix+key] = v
+		default:
+			data, err := json.Marshal(v)
+			if err == nil {
+				fields[prefix+key] = string(data)
+			}
+		}
+	}
+}
+
+// parseLogfmtFields reads key=value pairs separated by spaces, where values
+// may be double quoted. Every token has to be a pair, so plain text that
+// happens to contain an '=' is not mistaken for logfmt.
+func parseLogfmtFields(content string) map[string]string {
+	fields := map[string]string{}
+	s := content
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			break
+		}
+
+		keyEnd := strings.IndexAny(s, "= \t\"")
+		if keyEnd <= 0 || s[keyEnd] != '=' {
+			return nil
+		}
+		key := s[:keyEnd]
+		s = s[keyEnd+1:]
+
+		if strings.HasPrefix(s, `"`) {
+			var value bytes.Buffer
+			closed := false
+			for i := 1; i < len(s); i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					switch s[i+1] {
+					case 'n':
+						value.WriteByte('\n')
+					case 't':
+						value.WriteByte('\t')
+					default:
+						value.WriteByte(s[i+1])
+					}
+					i++
+				} else if s[i] == '"' {
+					s = s[i+1:]
+					closed = true
+					break
+				} else {
+					value.WriteByte(s[i])
+				}
+			}
+			if !closed || (s != "" && s[0] != ' ' && s[0] != '\t') {
+				return nil
+			}
+			fields[key] = value.String()
+			continue
+		}
+
+		valueEnd := strings.IndexAny(s, " \t")
+		if valueEnd < 0 {
+			valueEnd = len(s)
+		}
+		value := s[:valueEnd]
+		if strings.ContainsAny(value, `="`) {
+			return nil
+		}
+		fields[key] = value
+		s = s[valueEnd:]
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+	}{
+		{
+			name:    "json",
+			content: `{"level":"error","status":500,"ok":false,"tags":["a"],"empty":null}`,
+			want:    map[string]string{"level": "error", "status": "500", "ok": "false", "tags": `["a"]`, "empty": "null"},
+		},
+		{
+			name:    "nested json",
+			content: ` {"user":{"id":42,"name":"alice"}} `,
+			want:    map[string]string{"user.id": "42", "user.name": "alice"},
+		},
+		{
+			name:    "json keeps large numbers",
+			content: `{"id":12345678901234567890}`,
+			want:    map[string]string{"id": "12345678901234567890"},
+		},
+		{name: "json with trailing data", content: `{"a":1} {"b":2}`},
+		{name: "malformed json", content: `{"a":`},
+		{name: "empty json object", content: `{}`},
+		{
+			name:    "logfmt",
+			content: `level=info msg="user logged in" user=alice`,
+			want:    map[string]string{"level": "info", "msg": "user logged in", "user": "alice"},
+		},
+		{
+			name:    "logfmt escapes and empty value",
+			content: "path=\"a \\\"b\\\"\\n\" empty= code=7",
+			want:    map[string]string{"path": "a \"b\"\n", "empty": "", "code": "7"},
+		},
+		{name: "plain text", content: "user logged in"},
+		{name: "plain text with an equals sign", content: "retrying with timeout=5s"},
+		{name: "unterminated quote", content: `msg="never closed`},
+		{name: "text after quoted value", content: `msg="a"b`},
+		{name: "quote inside bare value", content: `msg=a"b`},
+		{name: "empty", content: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ParseFields(test.content); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseFields(%q) = %v, want %v", test.content, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseFieldPredicates(t *testing.T) {
+	tests := []struct {
+		name       string
+		predicates []string
+		want       map[string]string
+		wantErr    bool
+	}{
+		{name: "none"},
+		{
+			name:       "several",
+			predicates: []string{"level=error", "user.id=42"},
+			want:       map[string]string{"level": "error", "user.id": "42"},
+		},
+		{name: "value with equals sign", predicates: []string{"query=a=b"}, want: map[string]string{"query": "a=b"}},
+		{name: "empty value", predicates: []string{"level="}, want: map[string]string{"level": ""}},
+		{name: "missing equals sign", predicates: []string{"level"}, wantErr: true},
+		{name: "empty key", predicates: []string{"=error"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseFieldPredicates(test.predicates)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseFieldPredicates() error = %v, want error %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseFieldPredicates() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -1,34 +1,302 @@
 package internal
 
 import (
+	"context"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/hyperledger/fabric-gateway/pkg/client"
 	"github.com/hyperledger/fabric-gateway/pkg/hash"
 	"github.com/hyperledger/fabric-gateway/pkg/identity"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
 )
 
-var clientConnection *grpc.ClientConn
-var gateway *client.Gateway
+// PeerConfig identifies a gateway peer and the TLS settings used to reach it.
+type PeerConfig struct {
+	Endpoint    string
+	HostName    string
+	TlsCertPath string
+}
+
+// PeersFromEnv reads the gateway peers from PEER_ENDPOINTS, a comma separated
+// list of endpoint=hostname pairs, defaulting to the three peers of the test network.
+func PeersFromEnv() []PeerConfig {
+	endpoints := getEnvList("PEER_ENDPOINTS")
+	if len(endpoints) == 0 {
+		endpoints = DefaultPeerEndpoints
+	}
+
+	peers := make([]PeerConfig, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		address, hostName, _ := strings.Cut(endpoint, "=")
+		peers = append(peers, PeerConfig{
+			Endpoint:    address,
+			HostName:    hostName,
+			TlsCertPath: CryptoPath + "/peers/" + hostName + "/tls/ca.crt",
+		})
+	}
+	return peers
+}
+
+// signingIdentity is a client identity together with its signer. Identities
+// loaded from the wallet keep what they were loaded from in stored.
+type signingIdentity struct {
+	id        identity.Identity
+	sign      identity.Sign
+	closeSign func() error
+	stored    *WalletIdentity
+}
+
+// identityGateway is a gateway opened for a signing identity.
+type identityGateway struct {
+	signer  *signingIdentity
+	gateway *client.Gateway
+}
+
+// peerConnection is the gRPC connection to a single peer and the gateways
+// opened on it, one per client identity.
+type peerConnection struct {
+	config     PeerConfig
+	clientConn *grpc.ClientConn
+
+	mu       sync.Mutex
+	gateways map[string]identityGateway
+}
+
+// Connection manages gateway connections to a set of peers. Calls go to the
+// active peer and fail over to the next ready peer when it becomes unavailable.
+// Each call may transact as a different identity from the wallet.
+type Connection struct {
+	peers            []*peerConnection
+	sourceIdentities map[string]string
+
+	mu     sync.RWMutex
+	active int
+
+	identitiesMu sync.Mutex
+	identities   map[string]*signingIdentity
+	resolved     map[string]string
+	wallet       *Wallet
+}
+
+// GetConnection opens a gateway connection to every configured peer. Peers
+// are dialled lazily and redialled with backoff by gRPC when they go away.
+func GetConnection(ctx context.Context) (*Connection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connection := &Connection{
+		sourceIdentities: map[string]string{},
+		identities:       map[string]*signingIdentity{},
+		resolved:         map[string]string{},
+	}
+	for _, pair := range getEnvList("SOURCE_IDENTITIES") {
+		source, name, _ := strings.Cut(pair, "=")
+		connection.sourceIdentities[source] = name
+	}
+
+	// load the default identity up front so missing crypto material fails fast
+	if _, err := connection.signingIdentity(DefaultIdentity); err != nil {
+		return nil, err
+	}
+
+	for _, config := range PeersFromEnv() {
+		clientConnection, err := newGrpcConnection(config)
+		if err != nil {
+			_ = connection.Close()
+			return nil, err
+		}
+		peer := &peerConnection{
+			config:     config,
+			clientConn: clientConnection,
+			gateways:   map[string]identityGateway{},
+		}
+		connection.peers = append(connection.peers, peer)
+
+		if _, err := connection.gateway(peer, DefaultIdentity); err != nil {
+			_ = connection.Close()
+			return nil, err
+		}
+	}
+	if len(connection.peers) == 0 {
+		return nil, fmt.Errorf("no peer endpoints configured")
+	}
+
+	return connection, nil
+}
+
+// IdentityForSource picks the identity that transacts for a log source: the
+// one mapped in SOURCE_IDENTITIES, else a wallet identity named after the
+// source, else the default identity. The wallet is consulted once per source
+// until LoadIdentity refreshes that name.
+func (c *Connection) IdentityForSource(source string) string {
+	if name, ok := c.sourceIdentities[source]; ok {
+		return name
+	}
+	if source == "" {
+		return DefaultIdentity
+	}
+
+	c.identitiesMu.Lock()
+	name, ok := c.resolved[source]
+	c.identitiesMu.Unlock()
+	if ok {
+		return name
+	}
+
+	name = DefaultIdentity
+	wallet, err := c.openWallet()
+	if err != nil {
+		// not cached, so a wallet that opens later is still consulted
+		return name
+	}
+	if _, err := wallet.Get(source); err == nil {
+		name = source
+	}
+
+	c.identitiesMu.Lock()
+	c.resolved[source] = name
+	c.identitiesMu.Unlock()
+	return name
+}
+
+// LoadIdentity makes sure the named identity exists and can sign, refreshing
+// it from the wallet: one deleted from the wallet stops signing and one
+// replaced in it is reloaded. Running clients only pick up wallet changes here.
+func (c *Connection) LoadIdentity(name string) error {
+	c.identitiesMu.Lock()
+	cached, ok := c.identities[name]
+	delete(c.resolved, name)
+	c.identitiesMu.Unlock()
+
+	if ok && name != DefaultIdentity && cached.stored != nil {
+		wallet, err := c.openWallet()
+		if err != nil {
+			return err
+		}
+		stored, err := wallet.Get(name)
+		if err == nil && *stored == *cached.stored {
+			return nil
+		}
+		c.evictIdentity(name, cached)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := c.signingIdentity(name)
+	return err
+}
+
+func (c *Connection) openWallet() (*Wallet, error) {
+	c.identitiesMu.Lock()
+	defer c.identitiesMu.Unlock()
+
+	if c.wallet == nil {
+		wallet, err := OpenWallet()
+		if err != nil {
+			return nil, err
+		}
+		c.wallet = wallet
+	}
+	return c.wallet, nil
+}
+
+// signingIdentity loads and caches the named identity. The default identity
+// comes from CLIENT_IDENTITY in the wallet when set, else from the MSP
+// directory of the test network user, and is kept for the lifetime of the
+// connection. Other wallet identities are kept until LoadIdentity refreshes
+// them.
+func (c *Connection) signingIdentity(name string) (*signingIdentity, error) {
+	c.identitiesMu.Lock()
+	cached, ok := c.identities[name]
+	c.identitiesMu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	walletName := name
+	if name == DefaultIdentity {
+		walletName = getEnv("CLIENT_IDENTITY", "")
+	}
+
+	var loaded *signingIdentity
+	var err error
+	if walletName == "" {
+		loaded, err = loadMSPIdentity()
+	} else {
+		wallet, walletErr := c.openWallet()
+		if walletErr != nil {
+			return nil, walletErr
+		}
+		loaded, err = loadWalletIdentity(wallet, walletName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.identitiesMu.Lock()
+	defer c.identitiesMu.Unlock()
+	if cached, ok := c.identities[name]; ok {
+		// another caller loaded it first
+		_ = loaded.closeSign()
+		return cached, nil
+	}
+	c.identities[name] = loaded
+	return loaded, nil
+}
+
+// evictIdentity drops a cached identity and releases its signer. Gateways
+// opened for it are replaced on their next use.
+func (c *Connection) evictIdentity(name string, evicted *signingIdentity) {
+	c.identitiesMu.Lock()
+	defer c.identitiesMu.Unlock()
+	if c.identities[name] != evicted {
+		// another caller evicted it first
+		return
+	}
+	delete(c.identities, name)
+	if err := evicted.closeSign(); err != nil {
+		log.Printf("failed to close signer for %q: %v", name, err)
+	}
+}
+
+// gateway returns the gateway for an identity on a peer, connecting it on
+// first use and again whenever the identity was reloaded.
+func (c *Connection) gateway(peer *peerConnection, name string) (*client.Gateway, error) {
+	signer, err := c.signingIdentity(name)
+	if err != nil {
+		return nil, err
+	}
 
-func GetConnection() (*grpc.ClientConn, *client.Gateway, *client.Contract) {
-	clientConnection = newGrpcConnection()
-	id := newIdentity()
-	sign := newSign()
+	peer.mu.Lock()
+	defer peer.mu.Unlock()
+	cached, ok := peer.gateways[name]
+	if ok && cached.signer == signer {
+		return cached.gateway, nil
+	}
+	if ok {
+		_ = cached.gateway.Close()
+	}
 
 	// Create a Gateway connection for a specific client identity
-	gw, err := client.Connect(
-		id,
-		client.WithSign(sign),
+	gateway, err := client.Connect(
+		signer.id,
+		client.WithSign(signer.sign),
 		client.WithHash(hash.SHA256),
-		client.WithClientConnection(clientConnection),
+		client.WithClientConnection(peer.clientConn),
 		// Default timeouts for different gRPC calls
 		client.WithEvaluateTimeout(5*time.Second),
 		client.WithEndorseTimeout(15*time.Second),
@@ -36,87 +304,336 @@ func GetConnection() (*grpc.ClientConn, *client.Gateway, *client.Contract) {
 		client.WithCommitStatusTimeout(1*time.Minute),
 	)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("failed to connect to gateway on %s: %w", peer.config.Endpoint, err)
+	}
+
+	peer.gateways[name] = identityGateway{signer: signer, gateway: gateway}
+	return gateway, nil
+}
+
+// Contract returns the default identity's contract on the active peer.
+func (c *Connection) Contract() *client.Contract {
+	return c.Network().GetContract(ChaincodeName)
+}
+
+// Network returns the default identity's channel network on the active peer.
+func (c *Connection) Network() *client.Network {
+	peer := c.activePeer()
+	peer.mu.Lock()
+	defer peer.mu.Unlock()
+	return peer.gateways[DefaultIdentity].gateway.GetNetwork(ChannelName)
+}
+
+func (c *Connection) activePeer() *peerConnection {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.peers[c.active]
+}
+
+// Do runs fn against the active peer's contract as the default identity.
+func (c *Connection) Do(ctx context.Context, fn func(contract *client.Contract) error) error {
+	return c.DoAs(ctx, DefaultIdentity, fn)
+}
+
+// DoAs runs fn against the active peer's contract as the named identity. When
+// the peer is unavailable it fails over to the next peer and runs fn again,
+// so fn must be safe to repeat; submit transactions with SubmitAs instead.
+func (c *Connection) DoAs(ctx context.Context, identityName string, fn func(contract *client.Contract) error) error {
+	return c.retry(ctx, identityName, func(gateway *client.Gateway) error {
+		return fn(gateway.GetNetwork(ChannelName).GetContract(ChaincodeName))
+	})
+}
+
+// SubmitAs endorses a transaction as the named identity and submits it to the
+// orderer, failing over like DoAs. Only the endorsement is ever repeated: once
+// endorsed, the same signed transaction is resubmitted through the next peer,
+// so its ID stays the same and the ledger rejects it as a duplicate should an
+// earlier submission have reached the orderer after all.
+func (c *Connection) SubmitAs(ctx context.Context, identityName string, function string, args ...string) (*client.Transaction, *client.Commit, error) {
+	var transaction *client.Transaction
+	var commit *client.Commit
+	err := c.retry(ctx, identityName, func(gateway *client.Gateway) (err error) {
+		if transaction == nil {
+			contract := gateway.GetNetwork(ChannelName).GetContract(ChaincodeName)
+			proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+			if err != nil {
+				return err
+			}
+
+			start := time.Now()
+			endorsed, err := proposal.EndorseWithContext(ctx)
+			observeSince(fabricDuration.WithLabelValues("endorse"), start)
+			if err != nil {
+				return err
+			}
+			transaction = endorsed
+		} else {
+			// carry the endorsed transaction over to this peer's gateway
+			transactionBytes, err := transaction.Bytes()
+			if err != nil {
+				return err
+			}
+			if transaction, err = gateway.NewTransaction(transactionBytes); err != nil {
+				return err
+			}
+		}
+
+		start := time.Now()
+		commit, err = transaction.SubmitWithContext(ctx)
+		observeSince(fabricDuration.WithLabelValues("submit"), start)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return transaction, commit, nil
+}
+
+// retry runs fn with the active peer's gateway for the named identity,
+// failing over to the next peer while it is unavailable and backing off
+// between rounds.
+func (c *Connection) retry(ctx context.Context, identityName string, fn func(gateway *client.Gateway) error) error {
+	backoff := PeerRetryBackoff
+	var err error
+	for attempt := 0; attempt < PeerRetryRounds*len(c.peers); attempt++ {
+		peer := c.activePeer()
+
+		var gateway *client.Gateway
+		gateway, err = c.gateway(peer, identityName)
+		if err != nil {
+			return err
+		}
+
+		err = fn(gateway)
+		if !isUnavailable(err) {
+			return err
+		}
+
+		log.Printf("peer %s unavailable: %v", peer.config.Endpoint, err)
+		c.failover(peer)
+
+		// once every peer has been tried, wait before the next round
+		if (attempt+1)%len(c.peers) == 0 {
+			select {
+			case <-time.After(backoff):
+				backoff *= 2
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return err
+}
+
+// failover moves away from a failed peer, preferring one whose connection is ready.
+func (c *Connection) failover(failed *peerConnection) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.peers[c.active] != failed {
+		// another caller already failed over
+		return
+	}
+
+	next := (c.active + 1) % len(c.peers)
+	for i := 1; i < len(c.peers); i++ {
+		candidate := (c.active + i) % len(c.peers)
+		if c.peers[candidate].clientConn.GetState() == connectivity.Ready {
+			next = candidate
+			break
+		}
+	}
+
+	if next != c.active {
+		log.Printf("failing over from peer %s to %s", failed.config.Endpoint, c.peers[next].config.Endpoint)
+		peerFailovers.Inc()
+		c.active = next
+	}
+}
+
+// Monitor health-checks every peer until ctx is done, keeping idle
+// connections dialled and moving off an active peer that is no longer ready.
+func (c *Connection) Monitor(ctx context.Context) {
+	ticker := time.NewTicker(PeerHealthInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, peer := range c.peers {
+			if peer.clientConn.GetState() == connectivity.Idle {
+				peer.clientConn.Connect()
+			}
+		}
+
+		active := c.activePeer()
+		state := active.clientConn.GetState()
+		if state == connectivity.TransientFailure || state == connectivity.Shutdown {
+			c.failover(active)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// WaitForReady dials every peer and blocks until one of them is ready or ctx is done.
+func (c *Connection) WaitForReady(ctx context.Context) error {
+	for _, peer := range c.peers {
+		peer.clientConn.Connect()
 	}
-	gateway = gw
 
-	network := gateway.GetNetwork(ChannelName)
-	contract := network.GetContract(ChaincodeName)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		for i, peer := range c.peers {
+			if peer.clientConn.GetState() == connectivity.Ready {
+				c.mu.Lock()
+				if c.peers[c.active].clientConn.GetState() != connectivity.Ready {
+					c.active = i
+				}
+				c.mu.Unlock()
+				return nil
+			}
+		}
 
-	return clientConnection, gateway, contract
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("no peer is reachable: %w", ctx.Err())
+		}
+	}
+}
+
+// PeerStates reports the gRPC connectivity state of each peer and which one is active.
+func (c *Connection) PeerStates() (map[string]string, string) {
+	states := make(map[string]string, len(c.peers))
+	for _, peer := range c.peers {
+		states[peer.config.Endpoint] = strings.ToLower(peer.clientConn.GetState().String())
+	}
+	return states, c.activePeer().config.Endpoint
 }
 
-func CloseConnection() {
-	if err := clientConnection.Close(); err != nil {
-		log.Printf("failed to close gRPC connection: %v", err)
+// Close closes each peer's gateways before the gRPC connection they run on,
+// then releases the signers.
+func (c *Connection) Close() error {
+	if c == nil {
+		return nil
 	}
-	if err := gateway.Close(); err != nil {
-		log.Printf("failed to close gateway connection: %v", err)
+
+	var errs []error
+	for _, peer := range c.peers {
+		peer.mu.Lock()
+		for name, cached := range peer.gateways {
+			if err := cached.gateway.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("failed to close gateway connection to %s for %q: %w", peer.config.Endpoint, name, err))
+			}
+		}
+		peer.mu.Unlock()
+
+		if err := peer.clientConn.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close gRPC connection to %s: %w", peer.config.Endpoint, err))
+		}
+	}
+
+	c.identitiesMu.Lock()
+	defer c.identitiesMu.Unlock()
+	for name, signer := range c.identities {
+		if err := signer.closeSign(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close signer for %q: %w", name, err))
+		}
 	}
+	return errors.Join(errs...)
+}
+
+func isUnavailable(err error) bool {
+	return err != nil && status.Code(err) == codes.Unavailable
 }
 
 // newGrpcConnection creates a gRPC connection to the Gateway server.
-func newGrpcConnection() *grpc.ClientConn {
-	certificatePEM, err := os.ReadFile(TlsCertPath)
+func newGrpcConnection(config PeerConfig) (*grpc.ClientConn, error) {
+	certificatePEM, err := os.ReadFile(config.TlsCertPath)
 	if err != nil {
-		panic(fmt.Errorf("failed to read TLS certifcate file: %w", err))
+		return nil, fmt.Errorf("failed to read TLS certifcate file: %w", err)
 	}
 
 	certificate, err := identity.CertificateFromPEM(certificatePEM)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	certPool := x509.NewCertPool()
 	certPool.AddCert(certificate)
-	transportCredentials := credentials.NewClientTLSFromCert(certPool, GatewayPeer)
+	transportCredentials := credentials.NewClientTLSFromCert(certPool, config.HostName)
 
-	connection, err := grpc.NewClient(PeerEndpoint, grpc.WithTransportCredentials(transportCredentials))
+	connection, err := grpc.NewClient("dns:///"+config.Endpoint, grpc.WithTransportCredentials(transportCredentials))
 	if err != nil {
-		panic(fmt.Errorf("failed to create gRPC connection: %w", err))
+		return nil, fmt.Errorf("failed to create gRPC connection: %w", err)
 	}
 
-	return connection
+	return connection, nil
 }
 
-// newIdentity creates a client identity for this Gateway connection using an X.509 certificate.
-func newIdentity() *identity.X509Identity {
+// loadMSPIdentity loads the test network user from its MSP directory.
+func loadMSPIdentity() (*signingIdentity, error) {
 	certificatePEM, err := readFirstFile(CertPath)
 	if err != nil {
-		panic(fmt.Errorf("failed to read certificate file: %w", err))
+		return nil, fmt.Errorf("failed to read certificate file: %w", err)
 	}
 
-	certificate, err := identity.CertificateFromPEM(certificatePEM)
-	if err != nil {
-		panic(err)
+	// with an HSM configured the key never touches the disk
+	var privateKeyPEM []byte
+	keyID := ""
+	if config := HSMConfigFromEnv(); config != nil {
+		keyID = config.KeyID
+	} else {
+		privateKeyPEM, err = readFirstFile(KeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key file: %w", err)
+		}
 	}
 
-	id, err := identity.NewX509Identity(MspID, certificate)
+	return newSigningIdentity(MspID, certificatePEM, privateKeyPEM, keyID)
+}
+
+// loadWalletIdentity loads a named identity from the wallet.
+func loadWalletIdentity(wallet *Wallet, name string) (*signingIdentity, error) {
+	walletIdentity, err := wallet.Get(name)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	return id
+	var privateKeyPEM []byte
+	if walletIdentity.Credentials.PrivateKey != "" {
+		privateKeyPEM = []byte(walletIdentity.Credentials.PrivateKey)
+	}
+
+	loaded, err := newSigningIdentity(walletIdentity.MspID, []byte(walletIdentity.Credentials.Certificate), privateKeyPEM, walletIdentity.Credentials.HSMKeyID)
+	if err != nil {
+		return nil, err
+	}
+	loaded.stored = walletIdentity
+	return loaded, nil
 }
 
-// newSign creates a function that generates a digital signature from a message digest using a private key.
-func newSign() identity.Sign {
-	privateKeyPEM, err := readFirstFile(KeyPath)
+func newSigningIdentity(mspID string, certificatePEM []byte, privateKeyPEM []byte, keyID string) (*signingIdentity, error) {
+	certificate, err := identity.CertificateFromPEM(certificatePEM)
 	if err != nil {
-		panic(fmt.Errorf("failed to read private key file: %w", err))
+		return nil, err
 	}
 
-	privateKey, err := identity.PrivateKeyFromPEM(privateKeyPEM)
+	id, err := identity.NewX509Identity(mspID, certificate)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	sign, err := identity.NewPrivateKeySign(privateKey)
+	sign, closeSign, err := newSigner(certificate, privateKeyPEM, keyID)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	return sign
+	return &signingIdentity{id: id, sign: sign, closeSign: closeSign}, nil
 }
 
 func readFirstFile(dirPath string) ([]byte, error) {
@@ -0,0 +1,254 @@
+package internal
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// selfSignedIdentity creates a wallet identity with a fresh P-256 key.
+func selfSignedIdentity(t *testing.T, mspID string) *WalletIdentity {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := &WalletIdentity{MspID: mspID, Type: "X.509", Version: 1}
+	id.Credentials.Certificate = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}))
+	id.Credentials.PrivateKey = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateKey}))
+	return id
+}
+
+func TestConnectionIdentityCache(t *testing.T) {
+	wallet, err := NewWallet(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection := &Connection{
+		identities: map[string]*signingIdentity{},
+		resolved:   map[string]string{},
+		wallet:     wallet,
+	}
+	put := func(mspID string) func() error {
+		id := selfSignedIdentity(t, mspID)
+		return func() error { return wallet.Put("client1", id) }
+	}
+
+	// wallet changes only reach the running connection through LoadIdentity
+	steps := []struct {
+		name         string
+		change       func() error
+		reload       bool
+		wantLoadErr  error
+		wantMSP      string
+		wantIdentity string
+	}{
+		{name: "first use", change: put("Org1MSP"), wantMSP: "Org1MSP", wantIdentity: "client1"},
+		{name: "re-imported", change: put("Org2MSP"), wantMSP: "Org1MSP", wantIdentity: "client1"},
+		{name: "re-imported and reloaded", reload: true, wantMSP: "Org2MSP", wantIdentity: "client1"},
+		{name: "deleted", change: func() error { return wallet.Remove("client1") }, wantMSP: "Org2MSP", wantIdentity: "client1"},
+		{name: "deleted and reloaded", reload: true, wantLoadErr: ErrIdentityNotFound, wantIdentity: DefaultIdentity},
+	}
+
+	for _, step := range steps {
+		if step.change != nil {
+			if err := step.change(); err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+		}
+		if step.reload {
+			if err := connection.LoadIdentity("client1"); !errors.Is(err, step.wantLoadErr) {
+				t.Errorf("%s: LoadIdentity() error = %v, want %v", step.name, err, step.wantLoadErr)
+			}
+		}
+
+		if got := connection.IdentityForSource("client1"); got != step.wantIdentity {
+			t.Errorf("%s: IdentityForSource() = %q, want %q", step.name, got, step.wantIdentity)
+		}
+		signer, err := connection.signingIdentity("client1")
+		if step.wantMSP == "" {
+			if err == nil {
+				t.Errorf("%s: signingIdentity() signs as %s after it was revoked", step.name, signer.id.MspID())
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: signingIdentity() error = %v", step.name, err)
+		}
+		if signer.id.MspID() != step.wantMSP {
+			t.Errorf("%s: signingIdentity() MSP = %s, want %s", step.name, signer.id.MspID(), step.wantMSP)
+		}
+	}
+}
+
+// fakeGateway is a peer gateway that answers endorse and submit requests with
+// the configured status codes and records the transaction IDs it saw.
+type fakeGateway struct {
+	gateway.UnimplementedGatewayServer
+	envelope    *common.Envelope
+	endorseCode codes.Code
+	submitCode  codes.Code
+
+	mu        sync.Mutex
+	endorsed  []string
+	submitted []string
+}
+
+func (g *fakeGateway) Endorse(ctx context.Context, request *gateway.EndorseRequest) (*gateway.EndorseResponse, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.endorsed = append(g.endorsed, request.GetTransactionId())
+	if g.endorseCode != codes.OK {
+		return nil, status.Error(g.endorseCode, "endorse failed")
+	}
+	return &gateway.EndorseResponse{PreparedTransaction: g.envelope}, nil
+}
+
+func (g *fakeGateway) Submit(ctx context.Context, request *gateway.SubmitRequest) (*gateway.SubmitResponse, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.submitted = append(g.submitted, request.GetTransactionId())
+	if g.submitCode != codes.OK {
+		return nil, status.Error(g.submitCode, "submit failed")
+	}
+	return &gateway.SubmitResponse{}, nil
+}
+
+// serve starts the gateway on a local port and returns a peer connected to it.
+func (g *fakeGateway) serve(t *testing.T) *peerConnection {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	gateway.RegisterGatewayServer(server, g)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	clientConn, err := grpc.NewClient("passthrough:///"+listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = clientConn.Close() })
+	return &peerConnection{
+		config:     PeerConfig{Endpoint: listener.Addr().String()},
+		clientConn: clientConn,
+		gateways:   map[string]identityGateway{},
+	}
+}
+
+func TestConnectionSubmitAs(t *testing.T) {
+	stored := selfSignedIdentity(t, "Org1MSP")
+	signer, err := newSigningIdentity(stored.MspID, []byte(stored.Credentials.Certificate), []byte(stored.Credentials.PrivateKey), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope := endorserEnvelope(t, common.HeaderType_ENDORSER_TRANSACTION, ChaincodeName)
+
+	tests := []struct {
+		name          string
+		gateways      []*fakeGateway
+		wantCode      codes.Code
+		wantEndorsed  []int
+		wantSubmitted []int
+		wantActive    int
+	}{
+		{
+			name:          "active peer",
+			gateways:      []*fakeGateway{{}, {}},
+			wantEndorsed:  []int{1, 0},
+			wantSubmitted: []int{1, 0},
+		},
+		{
+			// the endorsed transaction moves to the next peer instead of a new proposal
+			name:          "submit unavailable",
+			gateways:      []*fakeGateway{{submitCode: codes.Unavailable}, {}},
+			wantEndorsed:  []int{1, 0},
+			wantSubmitted: []int{1, 1},
+			wantActive:    1,
+		},
+		{
+			name:          "endorse unavailable",
+			gateways:      []*fakeGateway{{endorseCode: codes.Unavailable}, {}},
+			wantEndorsed:  []int{1, 1},
+			wantSubmitted: []int{0, 1},
+			wantActive:    1,
+		},
+		{
+			name:          "submit rejected",
+			gateways:      []*fakeGateway{{submitCode: codes.Aborted}, {}},
+			wantCode:      codes.Aborted,
+			wantEndorsed:  []int{1, 0},
+			wantSubmitted: []int{1, 0},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			connection := &Connection{
+				identities: map[string]*signingIdentity{DefaultIdentity: signer},
+				resolved:   map[string]string{},
+			}
+			for _, g := range test.gateways {
+				g.envelope = envelope
+				connection.peers = append(connection.peers, g.serve(t))
+			}
+
+			transaction, _, err := connection.SubmitAs(context.Background(), DefaultIdentity, "CreateAsset", "1")
+			if status.Code(err) != test.wantCode {
+				t.Fatalf("SubmitAs() error = %v, want code %s", err, test.wantCode)
+			}
+
+			var txIDs []string
+			for i, g := range test.gateways {
+				if len(g.endorsed) != test.wantEndorsed[i] || len(g.submitted) != test.wantSubmitted[i] {
+					t.Errorf("peer %d endorsed %d and submitted %d, want %d and %d", i, len(g.endorsed), len(g.submitted), test.wantEndorsed[i], test.wantSubmitted[i])
+				}
+				txIDs = append(txIDs, g.submitted...)
+			}
+			// a resubmitted transaction keeps its ID so the ledger can reject a duplicate
+			for _, txID := range txIDs {
+				if txID != txIDs[0] || (transaction != nil && txID != transaction.TransactionID()) {
+					t.Errorf("submitted transaction IDs %v, want one", txIDs)
+					break
+				}
+			}
+			if connection.active != test.wantActive {
+				t.Errorf("active peer = %d, want %d", connection.active, test.wantActive)
+			}
+		})
+	}
+}
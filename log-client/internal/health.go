@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// HealthCheck reports an error when a dependency is not usable.
+type HealthCheck func(ctx context.Context) error
+
+// CheckResult is the outcome of a single health check.
+type CheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// HealthReport aggregates the outcome of a set of health checks.
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Healthy reports whether every check in the report passed.
+func (r HealthReport) Healthy() bool {
+	return r.Status == "ok"
+}
+
+// RunHealthChecks runs all checks concurrently, each bounded by HealthCheckTimeout.
+func RunHealthChecks(ctx context.Context, checks map[string]HealthCheck) HealthReport {
+	report := HealthReport{Status: "ok", Checks: make(map[string]CheckResult, len(checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check HealthCheck) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, HealthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(checkCtx)
+			result := CheckResult{Status: "ok", Duration: time.Since(start).String()}
+			if err != nil {
+				result.Status = "fail"
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if err != nil {
+				report.Status = "fail"
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	return report
+}
+
+// CheckPeers fails when none of the gateway peers has a usable connection.
+func CheckPeers(connection *Connection) HealthCheck {
+	return func(ctx context.Context) error {
+		if connection == nil {
+			return fmt.Errorf("no connection to peers")
+		}
+
+		states, active := connection.PeerStates()
+		var details []string
+		usable := false
+		for endpoint, state := range states {
+			switch state {
+			case "ready", "idle", "connecting":
+				usable = true
+			}
+			details = append(details, endpoint+"="+state)
+		}
+		sort.Strings(details)
+
+		if !usable {
+			return fmt.Errorf("no peer is reachable (%s)", strings.Join(details, ", "))
+		}
+		if state := states[active]; state == "transient_failure" || state == "shutdown" {
+			return fmt.Errorf("active peer %s is %s (%s)", active, states[active], strings.Join(details, ", "))
+		}
+		return nil
+	}
+}
+
+// CheckDatabase pings the off-chain database.
+func CheckDatabase() HealthCheck {
+	return func(ctx context.Context) error {
+		db, err := InitDB()
+		if err != nil {
+			return err
+		}
+
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+
+		return sqlDB.PingContext(ctx)
+	}
+}
+
+// CheckChaincode runs a cheap evaluate call to make sure the chaincode answers.
+func CheckChaincode(connection *Connection) HealthCheck {
+	return func(ctx context.Context) error {
+		if connection == nil {
+			return fmt.Errorf("no contract available")
+		}
+
+		return connection.Do(ctx, func(contract *client.Contract) error {
+			_, err := contract.EvaluateWithContext(ctx, "GetAssetsWithFilter", client.WithArguments("", "1", ""))
+			return err
+		})
+	}
+}
+
+// CheckWatchers fails when one of the expected file watchers is not running.
+func CheckWatchers(expected ...string) HealthCheck {
+	return func(ctx context.Context) error {
+		running := RunningWatchers()
+
+		var missing []string
+		for _, path := range expected {
+			if path == "" {
+				continue
+			}
+			if _, ok := running[path]; !ok {
+				missing = append(missing, path)
+			}
+		}
+
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			return fmt.Errorf("watchers not running: %s", strings.Join(missing, ", "))
+		}
+		return nil
+	}
+}
+
+// CheckSpool fails when more entries are waiting for anchoring than the limit allows.
+func CheckSpool(limit int64) HealthCheck {
+	return func(ctx context.Context) error {
+		if depth := SpoolDepth(); depth > limit {
+			return fmt.Errorf("spool backlog %d exceeds limit %d", depth, limit)
+		}
+		return nil
+	}
+}
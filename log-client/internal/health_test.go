@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunHealthChecks(t *testing.T) {
+	up := (&fakeGateway{}).serve(t)
+	down := (&fakeGateway{}).serve(t)
+	if err := down.clientConn.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bounded := func(ctx context.Context) error {
+		deadline, ok := ctx.Deadline()
+		if !ok || time.Until(deadline) > HealthCheckTimeout {
+			return errors.New("check is not bounded by HealthCheckTimeout")
+		}
+		return nil
+	}
+	depth := SpoolDepth()
+
+	tests := []struct {
+		name       string
+		checks     map[string]HealthCheck
+		wantStatus string
+		wantFailed []string
+	}{
+		{
+			name:       "all pass",
+			checks:     map[string]HealthCheck{"bounded": bounded, "spool": CheckSpool(depth), "watchers": CheckWatchers("")},
+			wantStatus: "ok",
+		},
+		{
+			name:       "spool over limit",
+			checks:     map[string]HealthCheck{"bounded": bounded, "spool": CheckSpool(depth - 1)},
+			wantStatus: "fail",
+			wantFailed: []string{"spool"},
+		},
+		{
+			name:       "watcher not running",
+			checks:     map[string]HealthCheck{"watchers": CheckWatchers("/var/log/missing.log")},
+			wantStatus: "fail",
+			wantFailed: []string{"watchers"},
+		},
+		{
+			name:       "no connection",
+			checks:     map[string]HealthCheck{"peers": CheckPeers(nil), "chaincode": CheckChaincode(nil)},
+			wantStatus: "fail",
+			wantFailed: []string{"peers", "chaincode"},
+		},
+		{
+			name:       "peer reachable",
+			checks:     map[string]HealthCheck{"peers": CheckPeers(&Connection{peers: []*peerConnection{up}})},
+			wantStatus: "ok",
+		},
+		{
+			// a standby peer keeps the client ready, a shut down active peer does not
+			name: "active peer shut down",
+			checks: map[string]HealthCheck{
+				"standby": CheckPeers(&Connection{peers: []*peerConnection{up, down}}),
+				"active":  CheckPeers(&Connection{peers: []*peerConnection{up, down}, active: 1}),
+			},
+			wantStatus: "fail",
+			wantFailed: []string{"active"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := RunHealthChecks(context.Background(), test.checks)
+			if report.Status != test.wantStatus || report.Healthy() != (test.wantStatus == "ok") {
+				t.Errorf("RunHealthChecks() status = %s, want %s", report.Status, test.wantStatus)
+			}
+			if len(report.Checks) != len(test.checks) {
+				t.Fatalf("RunHealthChecks() reported %d checks, want %d", len(report.Checks), len(test.checks))
+			}
+
+			failed := map[string]bool{}
+			for _, name := range test.wantFailed {
+				failed[name] = true
+			}
+			for name, result := range report.Checks {
+				if (result.Status == "fail") != failed[name] || (result.Error != "") != failed[name] {
+					t.Errorf("check %s = %+v", name, result)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	HoldLegal     = "legal"
+	HoldRetention = "retention"
+
+	holdKeyPrefix = "hold:"
+)
+
+// ErrHeld is returned when an operation would purge entries under an active hold.
+var ErrHeld = errors.New("entries are under hold")
+
+// Hold is the locally indexed copy of a legal or retention hold on the
+// ledger. It covers the entries of Source, or of every source when empty,
+// whose LogID lies between FromLogID and ToLogID, either bound being open
+// when empty. A legal hold is active until released, a retention hold until
+// RetainUntil.
+type Hold struct {
+	HoldID      string `gorm:"primaryKey" json:"HoldID"`
+	Kind        string `json:"Kind"`
+	Source      string `gorm:"index" json:"Source"`
+	FromLogID   string `json:"FromLogID,omitempty"`
+	ToLogID     string `json:"ToLogID,omitempty"`
+	RetainUntil string `json:"RetainUntil,omitempty"`
+	Reason      string `json:"Reason"`
+	CreatedBy   string `json:"CreatedBy"`
+	Timestamp   string `json:"Timestamp"`
+	ReleasedAt  string `json:"ReleasedAt,omitempty"`
+	ReleasedBy  string `json:"ReleasedBy,omitempty"`
+}
+
+// HoldRequest places a hold through PlaceHold. RetainUntil is required for
+// retention holds.
+type HoldRequest struct {
+	Kind        string     `json:"kind" binding:"required,oneof=legal retention"`
+	Source      string     `json:"source"`
+	FromLogID   string     `json:"fromLogId"`
+	ToLogID     string     `json:"toLogId"`
+	RetainUntil *time.Time `json:"retainUntil"`
+	Reason      string     `json:"reason" binding:"required"`
+}
+
+// HoldChange is one version of a hold in its ledger history. Hold is nil for
+// a deletion.
+type HoldChange struct {
+	TxID      string `json:"TxID"`
+	Timestamp string `json:"Timestamp"`
+	Hold      *Hold  `json:"Hold"`
+}
+
+// logIDCondition is the SQL condition on anchors.log_id of the hold's range.
+func (h Hold) logIDCondition() (string, []any) {
+	switch {
+	case h.FromLogID != "" && h.ToLogID != "":
+		return "anchors.log_id BETWEEN ? AND ?", []any{h.FromLogID, h.ToLogID}
+	case h.FromLogID != "":
+		return "anchors.log_id >= ?", []any{h.FromLogID}
+	case h.ToLogID != "":
+		return "anchors.log_id <= ?", []any{h.ToLogID}
+	}
+	return "TRUE", nil
+}
+
+// auditorIdentity names the wallet identity that manages holds, which the
+// chaincode requires to carry the role=auditor attribute.
+func auditorIdentity() string {
+	return getEnv("AUDITOR_IDENTITY", DefaultIdentity)
+}
+
+// PlaceHold submits a legal or retention hold and indexes it right away, so
+// that it applies before the indexer reaches its block.
+func PlaceHold(ctx context.Context, connection *Connection, request HoldRequest) (*Hold, error) {
+	var function string
+	var args []string
+	switch request.Kind {
+	case HoldLegal:
+		function = "PlaceLegalHold"
+		args = []string{request.Source, request.FromLogID, request.ToLogID, request.Reason}
+	case HoldRetention:
+		if request.RetainUntil == nil {
+			return nil, fmt.Errorf("a retention hold needs a retain-until date")
+		}
+		function = "SetRetainUntil"
+		args = []string{request.Source, request.FromLogID, request.ToLogID, request.RetainUntil.UTC().Format(time.RFC3339), request.Reason}
+	default:
+		return nil, fmt.Errorf("unknown hold kind %q", request.Kind)
+	}
+
+	transaction, commit, err := connection.SubmitAs(ctx, auditorIdentity(), function, args...)
+	if err == nil {
+		err = awaitCommit(ctx, commit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to place hold: %w", err)
+	}
+
+	return refreshHold(ctx, connection, string(transaction.Result()))
+}
+
+// ReleaseHold releases a legal hold on the ledger and in the index.
+func ReleaseHold(ctx context.Context, connection *Connection, holdID string) (*Hold, error) {
+	_, commit, err := connection.SubmitAs(ctx, auditorIdentity(), "ReleaseLegalHold", holdID)
+	if err == nil {
+		err = awaitCommit(ctx, commit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to release hold %s: %w", holdID, err)
+	}
+
+	return refreshHold(ctx, connection, holdID)
+}
+
+// refreshHold reads a hold from the ledger into the index.
+func refreshHold(ctx context.Context, connection *Connection, holdID string) (*Hold, error) {
+	var holdJSON []byte
+	err := connection.Do(ctx, func(contract *client.Contract) (err error) {
+		holdJSON, err = contract.EvaluateWithContext(ctx, "ReadHold", client.WithArguments(holdID))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hold %s: %w", holdID, err)
+	}
+
+	var hold Hold
+	if err := json.Unmarshal(holdJSON, &hold); err != nil {
+		return nil, err
+	}
+
+	if err := saveHolds([]Hold{hold}); err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// HoldHistory returns every version of a hold recorded on the ledger, oldest first.
+func HoldHistory(ctx context.Context, connection *Connection, holdID string) ([]HoldChange, error) {
+	var historyJSON []byte
+	err := connection.Do(ctx, func(contract *client.Contract) (err error) {
+		historyJSON, err = contract.EvaluateWithContext(ctx, "GetHoldHistory", client.WithArguments(holdID))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history of hold %s: %w", holdID, err)
+	}
+
+	history := []HoldChange{}
+	if len(historyJSON) > 0 {
+		if err := json.Unmarshal(historyJSON, &history); err != nil {
+			return nil, err
+		}
+	}
+	return history, nil
+}
+
+// ListHolds returns the indexed holds, only the active ones when activeOnly is set.
+func ListHolds(activeOnly bool) ([]Hold, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+
+	query := db.Order("timestamp")
+	if activeOnly {
+		query = whereActive(query, time.Now())
+	}
+	var holds []Hold
+	if err := query.Find(&holds).Error; err != nil {
+		return nil, fmt.Errorf("failed to list holds: %w", err)
+	}
+	return holds, nil
+}
+
+// LoadHold loads an indexed hold by its ledger key.
+func LoadHold(holdID string) (*Hold, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var hold Hold
+	if err := db.First(&hold, "hold_id = ?", holdID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load hold %s: %w", holdID, err)
+	}
+	return &hold, nil
+}
+
+// activeHoldsFor returns the active holds that cover source.
+func activeHoldsFor(db *gorm.DB, source string) ([]Hold, error) {
+	var holds []Hold
+	err := whereActive(db.Where("source = ? OR source = ''", source), time.Now()).Find(&holds).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load holds of %s: %w", source, err)
+	}
+	return holds, nil
+}
+
+func whereActive(query *gorm.DB, now time.Time) *gorm.DB {
+	return query.Where("(kind = ? AND released_at = '') OR (kind = ? AND retain_until > ?)",
+		HoldLegal, HoldRetention, now.UTC().Format(time.RFC3339))
+}
+
+// excludeHeld narrows a query of log entries to those no hold covers.
+func excludeHeld(db *gorm.DB, query *gorm.DB, holds []Hold) *gorm.DB {
+	for _, hold := range holds {
+		condition, args := hold.logIDCondition()
+		query = query.Where("log_entries.id NOT IN (?)", db.Model(&Anchor{}).Select("entry_id").Where(condition, args...))
+	}
+	return query
+}
+
+// checkHolds fails with ErrHeld when an active hold covers one of the
+// anchored entries selected by entryIDs, a query of entry IDs of source.
+func checkHolds(db *gorm.DB, source string, entryIDs *gorm.DB) error {
+	holds, err := activeHoldsFor(db, source)
+	if err != nil {
+		return err
+	}
+
+	for _, hold := range holds {
+		condition, args := hold.logIDCondition()
+		var held int64
+		err := db.Model(&Anchor{}).
+			Where("anchors.entry_id IN (?)", entryIDs).
+			Where(condition, args...).
+			Count(&held).Error
+		if err != nil {
+			return fmt.Errorf("failed to check hold %s: %w", hold.HoldID, err)
+		}
+		if held > 0 {
+			return fmt.Errorf("%w %s: %s", ErrHeld, hold.HoldID, hold.Reason)
+		}
+	}
+	return nil
+}
+
+// saveHolds indexes holds, replacing older versions of them. Holds are only
+// written by the maintenance login, so that the gateway's login cannot lift
+// them.
+func saveHolds(holds []Hold) error {
+	err := maintain(func(tx *gorm.DB) error {
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&holds).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to index holds: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !pkcs11
+
+package internal
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+func newHSMSign(config HSMConfig) (identity.Sign, func() error, error) {
+	return nil, nil, fmt.Errorf("HSM_LIBRARY is set but the client was built without PKCS#11 support, rebuild with -tags pkcs11")
+}
@@ -0,0 +1,108 @@
+//go:build pkcs11
+
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+	"github.com/miekg/pkcs11"
+)
+
+// a single factory must be shared by all HSM signers of the process
+var hsmFactory struct {
+	sync.Mutex
+	library string
+	factory *identity.HSMSignerFactory
+	labels  map[uint]string
+}
+
+func newHSMSign(config HSMConfig) (identity.Sign, func() error, error) {
+	if config.Slot != nil {
+		label, err := tokenLabelForSlot(config.Library, *config.Slot)
+		if err != nil {
+			return nil, nil, err
+		}
+		if config.Label != "" && config.Label != label {
+			return nil, nil, fmt.Errorf("token in slot %d is labelled %q, not %q", *config.Slot, label, config.Label)
+		}
+		config.Label = label
+	}
+
+	factory, err := getHSMFactory(config.Library)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sign, closeSign, err := factory.NewHSMSigner(identity.HSMSignerOptions{
+		Label:      config.Label,
+		Pin:        config.Pin,
+		Identifier: config.KeyID,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create HSM signer: %w", err)
+	}
+
+	return sign, closeSign, nil
+}
+
+func getHSMFactory(library string) (*identity.HSMSignerFactory, error) {
+	hsmFactory.Lock()
+	defer hsmFactory.Unlock()
+
+	if hsmFactory.factory != nil {
+		if hsmFactory.library != library {
+			return nil, fmt.Errorf("HSM library %s already loaded, cannot load %s", hsmFactory.library, library)
+		}
+		return hsmFactory.factory, nil
+	}
+
+	factory, err := identity.NewHSMSignerFactory(library)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load HSM library %s: %w", library, err)
+	}
+
+	hsmFactory.library = library
+	hsmFactory.factory = factory
+	return factory, nil
+}
+
+// tokenLabelForSlot reads the label of the token in a slot, since the signer
+// factory only selects tokens by label. Labels are resolved before the factory
+// loads the library and cached afterwards.
+func tokenLabelForSlot(library string, slot uint) (string, error) {
+	hsmFactory.Lock()
+	defer hsmFactory.Unlock()
+
+	if label, ok := hsmFactory.labels[slot]; ok {
+		return label, nil
+	}
+	if hsmFactory.factory != nil {
+		return "", fmt.Errorf("cannot resolve HSM slot %d after the HSM library is loaded", slot)
+	}
+
+	ctx := pkcs11.New(library)
+	if ctx == nil {
+		return "", fmt.Errorf("failed to load HSM library %s", library)
+	}
+	defer ctx.Destroy()
+
+	if err := ctx.Initialize(); err != nil {
+		return "", fmt.Errorf("failed to initialize HSM library: %w", err)
+	}
+	defer ctx.Finalize()
+
+	tokenInfo, err := ctx.GetTokenInfo(slot)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token in slot %d: %w", slot, err)
+	}
+
+	label := strings.TrimRight(tokenInfo.Label, " \x00")
+	if hsmFactory.labels == nil {
+		hsmFactory.labels = map[uint]string{}
+	}
+	hsmFactory.labels[slot] = label
+	return label, nil
+}
@@ -0,0 +1,9 @@
+//go:build !pkcs11
+
+package internal
+
+import "fmt"
+
+func newHSMKeyWrapper(config HSMConfig, label string) (KeyWrapper, error) {
+	return nil, fmt.Errorf("ENCRYPTION_HSM_KEY is set but the client was built without PKCS#11 support, rebuild with -tags pkcs11")
+}
@@ -0,0 +1,118 @@
+//go:build pkcs11
+
+package internal
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+)
+
+// hsmKeyWrapper wraps data keys with AES-GCM under a secret key that stays
+// in the token.
+type hsmKeyWrapper struct {
+	mu      sync.Mutex
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	key     pkcs11.ObjectHandle
+}
+
+func newHSMKeyWrapper(config HSMConfig, label string) (KeyWrapper, error) {
+	ctx := pkcs11.New(config.Library)
+	if ctx == nil {
+		return nil, fmt.Errorf("failed to load HSM library %s", config.Library)
+	}
+	// the library may already be initialized by the HSM signers
+	if err := ctx.Initialize(); err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED)) {
+		return nil, fmt.Errorf("failed to initialize HSM library: %w", err)
+	}
+
+	slot, err := findTokenSlot(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open HSM session: %w", err)
+	}
+	if err := ctx.Login(session, pkcs11.CKU_USER, config.Pin); err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN)) {
+		return nil, fmt.Errorf("failed to log in to HSM: %w", err)
+	}
+
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_SECRET_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_AES),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	if err := ctx.FindObjectsInit(session, template); err != nil {
+		return nil, fmt.Errorf("failed to search HSM for key %s: %w", label, err)
+	}
+	objects, _, err := ctx.FindObjects(session, 1)
+	ctx.FindObjectsFinal(session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search HSM for key %s: %w", label, err)
+	}
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("no AES key labelled %s in HSM", label)
+	}
+
+	return &hsmKeyWrapper{ctx: ctx, session: session, key: objects[0]}, nil
+}
+
+// findTokenSlot returns the slot of the token selected by slot ID or label.
+func findTokenSlot(ctx *pkcs11.Ctx, config HSMConfig) (uint, error) {
+	if config.Slot != nil {
+		return *config.Slot, nil
+	}
+
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list HSM slots: %w", err)
+	}
+	for _, slot := range slots {
+		tokenInfo, err := ctx.GetTokenInfo(slot)
+		if err == nil && strings.TrimRight(tokenInfo.Label, " \x00") == config.Label {
+			return slot, nil
+		}
+	}
+	return 0, fmt.Errorf("no HSM token labelled %q", config.Label)
+}
+
+func (w *hsmKeyWrapper) Wrap(key []byte) ([]byte, error) {
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	params := pkcs11.NewGCMParams(nonce, nil, 128)
+	defer params.Free()
+	if err := w.ctx.EncryptInit(w.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_GCM, params)}, w.key); err != nil {
+		return nil, err
+	}
+	sealed, err := w.ctx.Encrypt(w.session, key)
+	if err != nil {
+		return nil, err
+	}
+	return append(nonce, sealed...), nil
+}
+
+func (w *hsmKeyWrapper) Unwrap(wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 12 {
+		return nil, fmt.Errorf("wrapped key is too short")
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	params := pkcs11.NewGCMParams(wrapped[:12], nil, 128)
+	defer params.Free()
+	if err := w.ctx.DecryptInit(w.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_GCM, params)}, w.key); err != nil {
+		return nil, err
+	}
+	return w.ctx.Decrypt(w.session, wrapped[12:])
+}
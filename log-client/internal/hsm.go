@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+// HSMConfig locates the PKCS#11 token and key used to sign transactions.
+type HSMConfig struct {
+	Library string
+	Label   string
+	Pin     string
+	// Slot selects the token by slot ID instead of label when set.
+	Slot *uint
+	// KeyID is the hex encoded CKA_ID of the default identity's private key,
+	// defaulting to the certificate's subject key identifier.
+	KeyID string
+}
+
+// HSMConfigFromEnv reads the PKCS#11 configuration from HSM_* environment variables.
+// It returns nil when HSM_LIBRARY is not set and keys are read from disk.
+func HSMConfigFromEnv() *HSMConfig {
+	library := getEnv("HSM_LIBRARY", "")
+	if library == "" {
+		return nil
+	}
+
+	config := &HSMConfig{
+		Library: library,
+		Label:   getEnv("HSM_LABEL", ""),
+		Pin:     getEnv("HSM_PIN", ""),
+		KeyID:   getEnv("HSM_KEY_ID", ""),
+	}
+	if slot, err := strconv.ParseUint(getEnv("HSM_SLOT", ""), 10, 32); err == nil {
+		s := uint(slot)
+		config.Slot = &s
+	}
+	return config
+}
+
+// newSigner returns the signing function for an identity, using the given
+// private key or, when there is none, the key with the hex encoded CKA_ID
+// keyID in the HSM configured through HSM_*. An empty keyID selects the
+// certificate's subject key identifier. The returned close function releases
+// HSM resources.
+func newSigner(certificate *x509.Certificate, privateKeyPEM []byte, keyID string) (identity.Sign, func() error, error) {
+	if privateKeyPEM != nil {
+		privateKey, err := identity.PrivateKeyFromPEM(privateKeyPEM)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		sign, err := identity.NewPrivateKeySign(privateKey)
+		return sign, func() error { return nil }, err
+	}
+
+	config := HSMConfigFromEnv()
+	if config == nil {
+		return nil, nil, fmt.Errorf("identity has no private key and HSM_LIBRARY is not set")
+	}
+
+	ckaID, err := hex.DecodeString(keyID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid HSM key ID %q, expected hex: %w", keyID, err)
+	}
+	if len(ckaID) == 0 {
+		if ckaID, err = subjectKeyIdentifier(certificate); err != nil {
+			return nil, nil, err
+		}
+	}
+	// the signer looks the key up by the raw CKA_ID bytes
+	config.KeyID = string(ckaID)
+
+	return newHSMSign(*config)
+}
+
+// subjectKeyIdentifier computes the key identifier Fabric uses for ECDSA keys:
+// the SHA-256 hash of the uncompressed public key point.
+func subjectKeyIdentifier(certificate *x509.Certificate) ([]byte, error) {
+	publicKey, ok := certificate.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported public key type %T", certificate.PublicKey)
+	}
+
+	ecdhKey, err := publicKey.ECDH()
+	if err != nil {
+		return nil, err
+	}
+
+	ski := sha256.Sum256(ecdhKey.Bytes())
+	return ski[:], nil
+}
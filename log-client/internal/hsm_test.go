@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+func TestNewSigner(t *testing.T) {
+	stored := selfSignedIdentity(t, "Org1MSP")
+	certificate, err := identity.CertificateFromPEM([]byte(stored.Credentials.Certificate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		library    string
+		privateKey string
+		keyID      string
+		wantErr    string
+	}{
+		{name: "private key", privateKey: stored.Credentials.PrivateKey},
+		{name: "private key ignores the HSM", library: "/usr/lib/softhsm/libsofthsm2.so", privateKey: stored.Credentials.PrivateKey},
+		{name: "no key and no HSM", wantErr: "HSM_LIBRARY is not set"},
+		{name: "key ID not hex", library: "/usr/lib/softhsm/libsofthsm2.so", keyID: "not-hex", wantErr: "invalid HSM key ID"},
+		{name: "invalid private key", privateKey: "not a key", wantErr: "failed to parse private key PEM"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("HSM_LIBRARY", test.library)
+			var privateKeyPEM []byte
+			if test.privateKey != "" {
+				privateKeyPEM = []byte(test.privateKey)
+			}
+
+			sign, closeSign, err := newSigner(certificate, privateKeyPEM, test.keyID)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("newSigner() error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer closeSign()
+
+			digest := sha256.Sum256([]byte("transaction"))
+			signature, err := sign(digest[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ecdsa.VerifyASN1(certificate.PublicKey.(*ecdsa.PublicKey), digest[:], signature) {
+				t.Error("signature does not verify against the certificate")
+			}
+		})
+	}
+}
+
+func TestSubjectKeyIdentifier(t *testing.T) {
+	stored := selfSignedIdentity(t, "Org1MSP")
+	certificate, err := identity.CertificateFromPEM([]byte(stored.Credentials.Certificate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := certificate.PublicKey.(*ecdsa.PublicKey).ECDH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the uncompressed point, 0x04 || X || Y, as Fabric's BCCSP hashes it
+	point := publicKey.Bytes()
+	if len(point) != 65 || point[0] != 0x04 {
+		t.Fatalf("public key point is %d bytes starting %#x", len(point), point[0])
+	}
+	sum := sha256.Sum256(point)
+
+	tests := []struct {
+		name        string
+		certificate *x509.Certificate
+		want        string
+		wantErr     bool
+	}{
+		{name: "ECDSA certificate", certificate: certificate, want: hex.EncodeToString(sum[:])},
+		{name: "unsupported key", certificate: &x509.Certificate{PublicKey: "rsa"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ski, err := subjectKeyIdentifier(test.certificate)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("subjectKeyIdentifier() error = %v, want error %v", err, test.wantErr)
+			}
+			if got := hex.EncodeToString(ski); got != test.want {
+				t.Errorf("subjectKeyIdentifier() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHSMConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		wantNil  bool
+		wantSlot string
+	}{
+		{name: "keys on disk", env: map[string]string{"HSM_LABEL": "ForFabric"}, wantNil: true},
+		{name: "token by label", env: map[string]string{"HSM_LIBRARY": "/lib/softhsm.so", "HSM_LABEL": "ForFabric"}},
+		{name: "token by slot", env: map[string]string{"HSM_LIBRARY": "/lib/softhsm.so", "HSM_SLOT": "3"}, wantSlot: "3"},
+		{name: "invalid slot", env: map[string]string{"HSM_LIBRARY": "/lib/softhsm.so", "HSM_SLOT": "first"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, name := range []string{"HSM_LIBRARY", "HSM_LABEL", "HSM_PIN", "HSM_KEY_ID", "HSM_SLOT"} {
+				t.Setenv(name, test.env[name])
+			}
+
+			config := HSMConfigFromEnv()
+			if (config == nil) != test.wantNil {
+				t.Fatalf("HSMConfigFromEnv() = %+v, want nil %v", config, test.wantNil)
+			}
+			if config == nil {
+				return
+			}
+			if config.Library != test.env["HSM_LIBRARY"] || config.Label != test.env["HSM_LABEL"] {
+				t.Errorf("HSMConfigFromEnv() = %+v", config)
+			}
+			slot := ""
+			if config.Slot != nil {
+				slot = strconv.FormatUint(uint64(*config.Slot), 10)
+			}
+			if slot != test.wantSlot {
+				t.Errorf("HSMConfigFromEnv() slot = %q, want %q", slot, test.wantSlot)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IndexerCheckpoint records the next block the indexer expects for a channel.
+type IndexerCheckpoint struct {
+	Channel   string `gorm:"primaryKey"`
+	NextBlock uint64
+	UpdatedAt time.Time
+}
+
+// RunIndexer follows block events from the persisted checkpoint and keeps the
+// anchor index up to date until ctx is cancelled.
+func RunIndexer(ctx context.Context, connection *Connection) {
+	for {
+		// resume on whichever peer is currently active
+		err := indexBlocks(ctx, connection.Network())
+		if ctx.Err() != nil {
+			return
+		}
+		log.Println("indexer stopped, reconnecting:", err)
+
+		select {
+		case <-time.After(IndexerRetryDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func indexBlocks(ctx context.Context, network *client.Network) error {
+	checkpoint, err := loadCheckpoint(network.Name())
+	if err != nil {
+		return err
+	}
+
+	blocks, err := network.BlockEvents(ctx, client.WithStartBlock(checkpoint.NextBlock))
+	if err != nil {
+		return fmt.Errorf("failed to start block events: %w", err)
+	}
+
+	for block := range blocks {
+		if err := indexBlock(network.Name(), block); err != nil {
+			return err
+		}
+	}
+
+	return fmt.Errorf("block event stream closed")
+}
+
+func indexBlock(channel string, block *common.Block) error {
+	anchors, holds, err := parseBlock(block)
+	if err != nil {
+		return err
+	}
+
+	db, err := InitDB()
+	if err != nil {
+		return err
+	}
+
+	// holds are saved first, by the maintenance login; saving them again when
+	// the block is replayed is harmless
+	if len(holds) > 0 {
+		if err := saveHolds(holds); err != nil {
+			return err
+		}
+	}
+
+	// store the block's anchors and advance the checkpoint atomically
+	return db.Transaction(func(tx *gorm.DB) error {
+		if len(anchors) > 0 {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&anchors).Error; err != nil {
+				return fmt.Errorf("failed to index block %d: %w", block.GetHeader().GetNumber(), err)
+			}
+		}
+
+		checkpoint := IndexerCheckpoint{
+			Channel:   channel,
+			NextBlock: block.GetHeader().GetNumber() + 1,
+		}
+		return tx.Save(&checkpoint).Error
+	})
+}
+
+func loadCheckpoint(channel string) (*IndexerCheckpoint, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint := IndexerCheckpoint{Channel: channel}
+	if err := db.FirstOrInit(&checkpoint, IndexerCheckpoint{Channel: channel}).Error; err != nil {
+		return nil, fmt.Errorf("failed to load indexer checkpoint: %w", err)
+	}
+
+	return &checkpoint, nil
+}
@@ -0,0 +1,459 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/protobuf/proto"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Receipt statuses.
+const (
+	ReceiptCommitted = "committed"
+	ReceiptPending   = "pending"
+	ReceiptFailed    = "failed"
+)
+
+var (
+	ErrInvalidLogInput = errors.New("invalid log entry")
+	ErrReceiptNotFound = errors.New("receipt not found")
+)
+
+// LogInput is a log entry pushed through the ingestion API.
+type LogInput struct {
+	Source         string            `json:"source"`
+	Content        string            `json:"content"`
+	EventTime      *time.Time        `json:"eventTime,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	IdempotencyKey string            `json:"idempotencyKey,omitempty"`
+	// Parser names the parser that extracts the fields, DefaultParser when empty.
+	Parser string `json:"parser,omitempty"`
+}
+
+// Validate checks that the entry has a source, some content and a known parser.
+func (in LogInput) Validate() error {
+	if in.Source == "" {
+		return fmt.Errorf("%w: source is required", ErrInvalidLogInput)
+	}
+	if strings.TrimSpace(in.Content) == "" {
+		return fmt.Errorf("%w: content is required", ErrInvalidLogInput)
+	}
+	if _, err := LookupParser(in.Parser); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidLogInput, err)
+	}
+	return nil
+}
+
+// writeOptions returns how the entry is stored: with its parser and the
+// default redactor, like lines of watched files.
+func (in LogInput) writeOptions() (WriteOptions, error) {
+	parser, err := LookupParser(in.Parser)
+	if err != nil {
+		return WriteOptions{}, err
+	}
+	redactor, err := DefaultRedactor()
+	if err != nil {
+		return WriteOptions{}, err
+	}
+	return WriteOptions{Parser: parser, Redactor: redactor}, nil
+}
+
+// Receipt reports where an ingested entry was stored and anchored.
+type Receipt struct {
+	EntryID      uint   `json:"entryId,omitempty"`
+	Source       string `json:"source,omitempty"`
+	LogID        string `json:"logId,omitempty"`
+	TxID         string `json:"txId,omitempty"`
+	Status       string `json:"status"`
+	PendingToken string `json:"pendingToken,omitempty"`
+	Duplicate    bool   `json:"duplicate,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// PendingReceipt tracks an ingested entry until it is anchored. Its token is
+// handed out in async mode.
+type PendingReceipt struct {
+	Token     string `gorm:"primaryKey"`
+	EntryID   uint   `gorm:"index"`
+	Source    string
+	Status    string
+	LogID     string
+	TxID      string
+	Error     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (p PendingReceipt) receipt() *Receipt {
+	return &Receipt{
+		EntryID:      p.EntryID,
+		Source:       p.Source,
+		LogID:        p.LogID,
+		TxID:         p.TxID,
+		Status:       p.Status,
+		PendingToken: p.Token,
+		Error:        p.Error,
+	}
+}
+
+// DecodeLogInputs reads a batch either as a JSON array or, for ndjson, as one
+// JSON object per line.
+func DecodeLogInputs(body io.Reader, ndjson bool) ([]LogInput, error) {
+	var inputs []LogInput
+	if !ndjson {
+		if err := json.NewDecoder(body).Decode(&inputs); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidLogInput, err)
+		}
+		return inputs, nil
+	}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), IngestBodyLimit)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var input LogInput
+		if err := json.Unmarshal(scanner.Bytes(), &input); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidLogInput, line, err)
+		}
+		inputs = append(inputs, input)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return inputs, nil
+}
+
+// Ingest stores and anchors a pushed entry as the identity mapped to its
+// source. A repeated idempotency key returns the receipt of the first entry,
+// anchoring it again when the earlier attempt failed or was lost to a restart
+// and the ledger did not commit its transaction after all.
+// In async mode it returns as soon as the entry is stored, with a token to
+// look the receipt up once the entry is anchored. When the entry was stored
+// but not anchored, the failed receipt is returned along with the error.
+func (w *Writer) Ingest(input LogInput, async bool) (*Receipt, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := w.begin(); err != nil {
+		return nil, err
+	}
+	handedOff := false
+	defer func() {
+		if !handedOff {
+			w.inFlight.Done()
+		}
+	}()
+
+	logEntry, created, err := storeLogInput(input)
+	if err != nil {
+		return nil, err
+	}
+	var duplicate *Receipt
+	if !created {
+		if duplicate, err = receiptForEntry(logEntry.ID); err != nil {
+			return nil, err
+		}
+		duplicate.Duplicate = true
+		if duplicate.Status == ReceiptCommitted {
+			return duplicate, nil
+		}
+	}
+	if !w.claim(logEntry.ID) {
+		// an earlier request is still anchoring the entry
+		return duplicate, nil
+	}
+	claimed := true
+	defer func() {
+		if claimed {
+			w.release(logEntry.ID)
+		}
+	}()
+
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+	if duplicate != nil {
+		lookup := func(ctx context.Context, txID string) (string, error) {
+			return committedAsset(ctx, w.connection, txID)
+		}
+		if err := settleReceipt(w.ctx, duplicate, lookup); err != nil {
+			return nil, err
+		}
+		if duplicate.Status == ReceiptCommitted {
+			err := db.Model(&PendingReceipt{}).Where("token = ?", duplicate.PendingToken).
+				Updates(map[string]any{"status": ReceiptCommitted, "log_id": duplicate.LogID, "error": ""}).Error
+			if err != nil {
+				return nil, fmt.Errorf("failed to update pending receipt: %w", err)
+			}
+			return duplicate, nil
+		}
+	}
+	pending := PendingReceipt{
+		Token:   newPendingToken(),
+		EntryID: logEntry.ID,
+		Source:  logEntry.Source,
+		Status:  ReceiptPending,
+	}
+	if err := db.Create(&pending).Error; err != nil {
+		return nil, fmt.Errorf("failed to store pending receipt: %w", err)
+	}
+
+	identityName := w.connection.IdentityForSource(logEntry.Source)
+	if !async {
+		// the entry is stored either way, so a failed anchor still gets a receipt
+		err := w.anchorPending(db, &pending, identityName, *logEntry)
+		receipt := pending.receipt()
+		receipt.PendingToken = ""
+		receipt.Duplicate = !created
+		return receipt, err
+	}
+
+	// the submission stays in flight until anchored so that Drain waits for it
+	handedOff = true
+	claimed = false
+	go func() {
+		defer w.inFlight.Done()
+		defer w.release(logEntry.ID)
+
+		_ = w.anchorPending(db, &pending, identityName, *logEntry)
+	}()
+
+	receipt := pending.receipt()
+	receipt.Duplicate = !created
+	return receipt, nil
+}
+
+// anchorPending anchors a stored entry and records the outcome in its
+// pending receipt.
+func (w *Writer) anchorPending(db *gorm.DB, pending *PendingReceipt, identityName string, logEntry LogEntry) error {
+	// record the transaction before waiting for it, so that a retry can tell
+	// whether it committed
+	submitted := func(txID string) {
+		pending.TxID = txID
+		if err := db.Save(pending).Error; err != nil {
+			log.Println("Failed to update pending receipt: ", err)
+		}
+	}
+	receipt, err := anchorStoredEntry(w.ctx, w.connection, identityName, logEntry, submitted)
+	if err != nil {
+		pending.Status = ReceiptFailed
+		pending.Error = err.Error()
+	} else {
+		pending.Status = ReceiptCommitted
+		pending.LogID = receipt.LogID
+		pending.TxID = receipt.TxID
+	}
+	if err := db.Save(pending).Error; err != nil {
+		log.Println("Failed to update pending receipt: ", err)
+	}
+	return err
+}
+
+// IngestBatch ingests every entry of a batch, a few at a time. Entries fail
+// independently; their receipts carry the error.
+func (w *Writer) IngestBatch(inputs []LogInput, async bool) []Receipt {
+	receipts := make([]Receipt, len(inputs))
+
+	slots := make(chan struct{}, IngestConcurrency)
+	var wg sync.WaitGroup
+	for i, input := range inputs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, input LogInput) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			receipt, err := w.Ingest(input, async)
+			if receipt == nil {
+				receipt = &Receipt{Source: input.Source, Status: ReceiptFailed, Error: err.Error()}
+			}
+			receipts[i] = *receipt
+		}(i, input)
+	}
+	wg.Wait()
+
+	return receipts
+}
+
+// LoadReceipt looks up the receipt of an entry accepted in async mode.
+func LoadReceipt(token string) (*Receipt, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending PendingReceipt
+	if err := db.First(&pending, "token = ?", token).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrReceiptNotFound, token)
+	} else if err != nil {
+		return nil, err
+	}
+
+	// a restart loses the in-flight submission, but entries that did commit
+	// still show up in the anchor index
+	if pending.Status == ReceiptPending {
+		var anchor Anchor
+		if err := db.Where("entry_id = ?", pending.EntryID).First(&anchor).Error; err == nil {
+			pending.Status = ReceiptCommitted
+			pending.LogID = anchor.LogID
+			pending.TxID = anchor.TxID
+		}
+	}
+
+	return pending.receipt(), nil
+}
+
+// storeLogInput writes a pushed entry to the database. created is false when
+// an entry with the same source and idempotency key already exists, which is
+// then returned instead.
+func storeLogInput(input LogInput) (logEntry *LogEntry, created bool, err error) {
+	options, err := input.writeOptions()
+	if err != nil {
+		return nil, false, err
+	}
+	if logEntry, err = newLogEntry(input, options); err != nil {
+		return nil, false, err
+	}
+
+	if input.IdempotencyKey == "" {
+		return logEntry, true, logEntry.WriteToDB()
+	}
+	logEntry.IdempotencyKey = &input.IdempotencyKey
+
+	db, err := InitDB()
+	if err != nil {
+		return nil, false, err
+	}
+
+	start := time.Now()
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(logEntry)
+	observeSince(dbWriteDuration, start)
+	if result.Error != nil {
+		return nil, false, fmt.Errorf("failed to write log entry to database: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return logEntry, true, nil
+	}
+
+	var existing LogEntry
+	if err := db.Where("source = ? AND idempotency_key = ?", input.Source, input.IdempotencyKey).First(&existing).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to load entry for idempotency key %s: %w", input.IdempotencyKey, err)
+	}
+	return &existing, false, nil
+}
+
+// receiptForEntry rebuilds the receipt of an entry stored earlier.
+func receiptForEntry(entryID uint) (*Receipt, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+
+	// the latest attempt to anchor the entry tells how it went
+	var pending PendingReceipt
+	if err := db.Where("entry_id = ?", entryID).Order("created_at DESC").First(&pending).Error; err == nil {
+		return LoadReceipt(pending.Token)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// entries ingested before every attempt was recorded are committed once
+	// they reach the index
+	var logEntry LogEntry
+	if err := logEntry.LoadFromDB(entryID); err != nil {
+		return nil, err
+	}
+	receipt := &Receipt{EntryID: entryID, Source: logEntry.Source, Status: ReceiptPending}
+
+	var anchor Anchor
+	if err := db.Where("entry_id = ?", entryID).First(&anchor).Error; err == nil {
+		receipt.LogID = anchor.LogID
+		receipt.TxID = anchor.TxID
+		receipt.Status = ReceiptCommitted
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+func newPendingToken() string {
+	token := make([]byte, 16)
+	_, _ = rand.Read(token)
+	return hex.EncodeToString(token)
+}
+
+// settleReceipt settles the receipt of an earlier attempt to anchor an entry
+// whose transaction was submitted but not seen to commit, e.g. because
+// waiting for its commit status timed out. lookup returns the key of the asset
+// the transaction created, or "" when the ledger has not committed it.
+func settleReceipt(ctx context.Context, receipt *Receipt, lookup func(ctx context.Context, txID string) (string, error)) error {
+	if receipt.Status == ReceiptCommitted || receipt.TxID == "" {
+		return nil
+	}
+
+	logID, err := lookup(ctx, receipt.TxID)
+	if err != nil {
+		return fmt.Errorf("failed to look up transaction %s: %w", receipt.TxID, err)
+	}
+	if logID != "" {
+		receipt.Status = ReceiptCommitted
+		receipt.LogID = logID
+		receipt.Error = ""
+	}
+	return nil
+}
+
+// committedAsset returns the key of the asset created by an anchoring
+// transaction, or "" when the ledger has no valid transaction of that ID.
+func committedAsset(ctx context.Context, connection *Connection, txID string) (string, error) {
+	var processedBytes []byte
+	err := connection.retry(ctx, DefaultIdentity, func(gateway *client.Gateway) (err error) {
+		qscc := gateway.GetNetwork(ChannelName).GetContract("qscc")
+		processedBytes, err = qscc.EvaluateWithContext(ctx, "GetTransactionByID", client.WithArguments(ChannelName, txID))
+		return err
+	})
+	if err != nil {
+		// the peer only reports unknown transactions in its error message
+		if !isUnavailable(err) && strings.Contains(err.Error(), "no such transaction ID") {
+			return "", nil
+		}
+		return "", err
+	}
+
+	processed := &peer.ProcessedTransaction{}
+	if err := proto.Unmarshal(processedBytes, processed); err != nil {
+		return "", fmt.Errorf("failed to deserialize transaction %s: %w", txID, err)
+	}
+	if peer.TxValidationCode(processed.GetValidationCode()) != peer.TxValidationCode_VALID {
+		return "", nil
+	}
+
+	anchors, _, err := parseEnvelope(processed.GetTransactionEnvelope(), 0)
+	if err != nil {
+		return "", err
+	}
+	if len(anchors) == 0 {
+		return "", fmt.Errorf("transaction %s created no asset", txID)
+	}
+	return anchors[0].LogID, nil
+}
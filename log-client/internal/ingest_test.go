@@ -0,0 +1,209 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"testing"
+	"time"
+)
+
+func TestNewLogEntry(t *testing.T) {
+	redactor, err := NewRedactor(RedactionConfig{Detectors: []string{"email"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	none, err := LookupParser("none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventTime := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	line := `{"level":"error","user":"alice@example.com","time":"2024-03-01T09:00:00Z"}`
+
+	tests := []struct {
+		name          string
+		input         LogInput
+		options       WriteOptions
+		wantContent   string
+		wantFields    map[string]string
+		wantEventTime time.Time
+		wantLabels    map[string]string
+	}{
+		{
+			name:          "default parser",
+			input:         LogInput{Source: "app", Content: "  " + line + "\n"},
+			wantContent:   line,
+			wantFields:    map[string]string{"level": "error", "user": "alice@example.com", "time": "2024-03-01T09:00:00Z"},
+			wantEventTime: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:        "configured parser",
+			input:       LogInput{Source: "app", Content: line},
+			options:     WriteOptions{Parser: none},
+			wantContent: line,
+		},
+		{
+			name:          "configured redactor",
+			input:         LogInput{Source: "app", Content: line, Labels: map[string]string{"owner": "bob@example.com"}},
+			options:       WriteOptions{Redactor: redactor},
+			wantContent:   `{"level":"error","user":"[REDACTED:email]","time":"2024-03-01T09:00:00Z"}`,
+			wantFields:    map[string]string{"level": "error", "user": "[REDACTED:email]", "time": "2024-03-01T09:00:00Z"},
+			wantEventTime: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+			wantLabels:    map[string]string{"owner": "[REDACTED:email]"},
+		},
+		{
+			name:          "given event time wins",
+			input:         LogInput{Source: "app", Content: line, EventTime: &eventTime},
+			options:       WriteOptions{Parser: none},
+			wantContent:   line,
+			wantEventTime: eventTime,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entry, err := newLogEntry(test.input, test.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.Content != test.wantContent || entry.Source != test.input.Source {
+				t.Errorf("newLogEntry() = %q from %q, want %q", entry.Content, entry.Source, test.wantContent)
+			}
+			if !maps.Equal(entry.Fields, test.wantFields) || !maps.Equal(entry.Labels, test.wantLabels) {
+				t.Errorf("newLogEntry() fields = %v, labels = %v; want %v, %v", entry.Fields, entry.Labels, test.wantFields, test.wantLabels)
+			}
+			var gotEventTime time.Time
+			if entry.EventTime != nil {
+				gotEventTime = *entry.EventTime
+			}
+			if !gotEventTime.Equal(test.wantEventTime) {
+				t.Errorf("newLogEntry() event time = %v, want %v", gotEventTime, test.wantEventTime)
+			}
+			if entry.FieldSalt == nil || entry.RedactionVersion != test.options.Redactor.Version() {
+				t.Errorf("newLogEntry() salt = %v, redaction version = %q", entry.FieldSalt, entry.RedactionVersion)
+			}
+		})
+	}
+}
+
+func TestLogInputValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   LogInput
+		wantErr bool
+	}{
+		{name: "valid", input: LogInput{Source: "app", Content: "started"}},
+		{name: "known parser", input: LogInput{Source: "app", Content: "started", Parser: "logfmt"}},
+		{name: "no source", input: LogInput{Content: "started"}, wantErr: true},
+		{name: "blank content", input: LogInput{Source: "app", Content: " \n"}, wantErr: true},
+		{name: "unknown parser", input: LogInput{Source: "app", Content: "started", Parser: "xml"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.input.Validate()
+			if test.wantErr != errors.Is(err, ErrInvalidLogInput) {
+				t.Errorf("Validate() error = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestSettleReceipt(t *testing.T) {
+	errUnavailable := errors.New("no peer available")
+	ledger := map[string]string{"tx-committed": "asset:20240301T100000Z:1"}
+	lookup := func(ctx context.Context, txID string) (string, error) {
+		if txID == "tx-unreachable" {
+			return "", errUnavailable
+		}
+		return ledger[txID], nil
+	}
+
+	tests := []struct {
+		name       string
+		receipt    Receipt
+		wantStatus string
+		wantLogID  string
+		wantErr    error
+	}{
+		{
+			name:       "committed",
+			receipt:    Receipt{Status: ReceiptCommitted, TxID: "tx-1", LogID: "asset:1"},
+			wantStatus: ReceiptCommitted,
+			wantLogID:  "asset:1",
+		},
+		{
+			// nothing reached the orderer, so the entry is anchored again
+			name:       "endorsement failed",
+			receipt:    Receipt{Status: ReceiptFailed, Error: "endorsement failed"},
+			wantStatus: ReceiptFailed,
+		},
+		{
+			// anchoring again would create a second asset for the entry
+			name:       "commit status timed out but committed",
+			receipt:    Receipt{Status: ReceiptFailed, TxID: "tx-committed", Error: "context deadline exceeded"},
+			wantStatus: ReceiptCommitted,
+			wantLogID:  "asset:20240301T100000Z:1",
+		},
+		{
+			name:       "commit status timed out and never committed",
+			receipt:    Receipt{Status: ReceiptFailed, TxID: "tx-lost", Error: "context deadline exceeded"},
+			wantStatus: ReceiptFailed,
+		},
+		{
+			name:       "lost to a restart but committed",
+			receipt:    Receipt{Status: ReceiptPending, TxID: "tx-committed"},
+			wantStatus: ReceiptCommitted,
+			wantLogID:  "asset:20240301T100000Z:1",
+		},
+		{
+			name:       "ledger unreachable",
+			receipt:    Receipt{Status: ReceiptFailed, TxID: "tx-unreachable"},
+			wantStatus: ReceiptFailed,
+			wantErr:    errUnavailable,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			receipt := test.receipt
+			err := settleReceipt(context.Background(), &receipt, lookup)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("settleReceipt() error = %v, want %v", err, test.wantErr)
+			}
+			if receipt.Status != test.wantStatus || receipt.LogID != test.wantLogID {
+				t.Errorf("settleReceipt() = %s %q, want %s %q", receipt.Status, receipt.LogID, test.wantStatus, test.wantLogID)
+			}
+			if receipt.Status == ReceiptCommitted && receipt.Error != "" {
+				t.Errorf("committed receipt kept error %q", receipt.Error)
+			}
+		})
+	}
+}
+
+func TestWriterClaim(t *testing.T) {
+	writer := NewWriter(context.Background(), nil)
+
+	// a request repeating the key of one still anchoring its entry gets the
+	// receipt without anchoring it a second time
+	steps := []struct {
+		name    string
+		claim   uint
+		release uint
+		want    bool
+	}{
+		{name: "first request", claim: 1, want: true},
+		{name: "repeated key", claim: 1, want: false},
+		{name: "other entry", claim: 2, want: true},
+		{name: "retry after the first resolved", release: 1, claim: 1, want: true},
+	}
+
+	for _, step := range steps {
+		if step.release != 0 {
+			writer.release(step.release)
+		}
+		if got := writer.claim(step.claim); got != step.want {
+			t.Errorf("%s: claim(%d) = %v, want %v", step.name, step.claim, got, step.want)
+		}
+	}
+}
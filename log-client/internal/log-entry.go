@@ -1,81 +1,301 @@
 package internal
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"maps"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"time"
+
+	"gorm.io/gorm"
 )
 
+// LogEntry is an off-chain log line. Fields tagged hash:"omitempty" only
+// enter the hash when set, so entries written before they existed keep their
+// hash; fields tagged hash:"-" never do. Fields holds what ParseFields pulls
+// out of Content, which stays the raw line that is hashed, after redaction
+// by the rule set recorded in RedactionVersion. With encryption configured,
+// Content holds the line sealed under the data key DataKeyID, so the hash
+// covers the ciphertext. FieldSalt keys the field hashes anchored next to the
+// hash, and is itself covered by the hash.
 type LogEntry struct {
-	ID        uint `gorm:"primaryKey"`
-	Content   string
-	Timestamp time.Time
-	Source    string
+	ID               uint `gorm:"primaryKey"`
+	Content          string
+	Timestamp        time.Time
+	Source           string            `gorm:"uniqueIndex:idx_log_entries_idempotency,priority:1"`
+	EventTime        *time.Time        `hash:"omitempty"`
+	Labels           map[string]string `gorm:"type:jsonb;serializer:json" hash:"omitempty"`
+	IdempotencyKey   *string           `gorm:"uniqueIndex:idx_log_entries_idempotency,priority:2" hash:"-"`
+	Fields           map[string]string `gorm:"type:jsonb;serializer:json;index:idx_log_entries_fields,type:gin" hash:"-"`
+	RedactionVersion string            `hash:"omitempty"`
+	DataKeyID        *string           `gorm:"index" hash:"-"`
+	FieldSalt        *string           `hash:"omitempty"`
 }
 
 type DetailedLogEntry struct {
-	ID        uint
-	Content   string
-	Timestamp time.Time
-	IsValid   bool
-	Source    string
+	ID                 uint
+	Content            string
+	Timestamp          time.Time
+	IsValid            bool
+	TamperedFields     []string
+	Source             string
+	EventTime          *time.Time
+	Labels             map[string]string
+	Fields             map[string]string
+	RedactionVersion   string
+	Shredded           bool
+	LastVerifiedAt     *time.Time
+	VerificationResult string
 }
 
 func (l LogEntry) Hash() (string, error) {
+	// concatenate all exported field
+	data := ""
+	for _, field := range l.hashedFields() {
+		data += field.value
+	}
+
+	h := sha256.New()
+	h.Write([]byte(data))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// FieldHashes hashes every field that enters Hash on its own, keyed by field
+// name, so that a mismatch can be traced to the fields that changed. The
+// hashes are HMACs keyed by FieldSalt, so that the anchored hashes cannot be
+// matched against guessed values; entries written before salts existed keep
+// plain hashes.
+func (l LogEntry) FieldHashes() map[string]string {
+	hashes := map[string]string{}
+	for _, field := range l.hashedFields() {
+		// the salt keys the other hashes rather than getting one
+		if field.name == "FieldSalt" {
+			continue
+		}
+
+		message := []byte(field.name + "=" + field.value)
+		if l.FieldSalt == nil {
+			sum := sha256.Sum256(message)
+			hashes[field.name] = hex.EncodeToString(sum[:])
+			continue
+		}
+		mac := hmac.New(sha256.New, []byte(*l.FieldSalt))
+		mac.Write(message)
+		hashes[field.name] = hex.EncodeToString(mac.Sum(nil))
+	}
+	return hashes
+}
+
+// newFieldSalt returns a random salt for the field hashes of a new entry.
+func newFieldSalt() (*string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate field salt: %w", err)
+	}
+	encoded := hex.EncodeToString(salt)
+	return &encoded, nil
+}
+
+// TamperedFields compares the entry against the field hashes anchored with it
+// and returns the fields that differ, including fields added or removed. It
+// returns nil for anchors that carry no field hashes.
+func (l LogEntry) TamperedFields(anchored map[string]string) []string {
+	if len(anchored) == 0 {
+		return nil
+	}
+
+	actual := l.FieldHashes()
+	var tampered []string
+	for name, hash := range actual {
+		if anchored[name] != hash {
+			tampered = append(tampered, name)
+		}
+	}
+	for name := range anchored {
+		if _, ok := actual[name]; !ok {
+			tampered = append(tampered, name)
+		}
+	}
+	sort.Strings(tampered)
+	return tampered
+}
+
+type hashedField struct {
+	name  string
+	value string
+}
+
+// hashedFields serializes the exported fields that enter the hash, in order.
+func (l LogEntry) hashedFields() []hashedField {
 	v := reflect.ValueOf(l)
 	t := v.Type()
 
-	// concatenate all exported field
-	data := ""
+	var fields []hashedField
 	for i := 0; i < v.NumField(); i++ {
 		if !t.Field(i).IsExported() {
 			continue
 		}
 
+		switch t.Field(i).Tag.Get("hash") {
+		case "-":
+			continue
+		case "omitempty":
+			if v.Field(i).IsZero() || (v.Field(i).Kind() == reflect.Map && v.Field(i).Len() == 0) {
+				continue
+			}
+		}
+
 		field := v.Field(i).Interface()
 
+		var value string
 		switch val := field.(type) {
 		case time.Time:
-			data += val.UTC().Format(time.RFC3339Nano)
+			value = val.UTC().Format(time.RFC3339Nano)
+		case *time.Time:
+			value = val.UTC().Format(time.RFC3339Nano)
 		default:
-			data += fmt.Sprintf("%v", val)
+			value = fmt.Sprintf("%v", val)
 		}
+		fields = append(fields, hashedField{name: t.Field(i).Name, value: value})
 	}
+	return fields
+}
 
-	h := sha256.New()
-	h.Write([]byte(data))
-	return hex.EncodeToString(h.Sum(nil)), nil
+// ErrLogEntryMissing is reported for anchored entries that neither the
+// database nor the archive has.
+var ErrLogEntryMissing = errors.New("log entry is anchored but missing")
+
+// VerifiedEntry is the outcome of verifying one anchored entry, Err telling
+// why it could not be loaded or read.
+type VerifiedEntry struct {
+	Entry *DetailedLogEntry
+	Err   error
+}
+
+// VerifyLogEntries loads the entries of anchors with LoadLogEntries and
+// validates them against their anchored hash and, when the anchors have them,
+// field hashes on up to VerifyConcurrency workers.
+// The results are in the order of anchors, with ErrLogEntryMissing for
+// entries neither the database nor the archive has.
+func VerifyLogEntries(anchors []Anchor) ([]VerifiedEntry, error) {
+	ids := make([]uint, 0, len(anchors))
+	for _, anchor := range anchors {
+		ids = append(ids, anchor.EntryID)
+	}
+	entries, err := LoadLogEntries(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return verifyLoaded(anchors, entries), nil
 }
 
-func (l *LogEntry) GetDetailedLogEntry(hash string) (detailedLogEntry *DetailedLogEntry, err error) {
+// verifyLoaded validates the entries loaded for anchors, in the order of anchors.
+func verifyLoaded(anchors []Anchor, entries map[uint]LogEntry) []VerifiedEntry {
+	results := make([]VerifiedEntry, len(anchors))
+	runBounded(len(anchors), VerifyConcurrency, func(i int) {
+		anchor := anchors[i]
+		logEntry, ok := entries[anchor.EntryID]
+		if !ok {
+			logEntry = LogEntry{ID: anchor.EntryID, Source: anchor.Source}
+			logEntry.raiseMissing()
+			results[i].Err = fmt.Errorf("%w: %d", ErrLogEntryMissing, anchor.EntryID)
+			return
+		}
+		results[i].Entry, results[i].Err = logEntry.detail(anchor.Hash, anchor.FieldHashes)
+	})
+	return results
+}
+
+// runBounded calls work for every index below count on up to limit goroutines
+// and returns once all calls are done.
+func runBounded(count int, limit int, work func(i int)) {
+	slots := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			work(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func (l *LogEntry) raiseMissing() {
+	raiseAlert(Alert{
+		Kind:    AlertMissingRow,
+		Source:  l.Source,
+		EntryID: l.ID,
+		Message: fmt.Sprintf("log entry %d is anchored on the ledger but missing from the database", l.ID),
+	})
+}
+
+// detail validates the loaded entry and decrypts its content.
+func (l *LogEntry) detail(hash string, fieldHashes map[string]string) (*DetailedLogEntry, error) {
 	isValid, err := l.ValidateHash(hash)
 	if err != nil {
 		return nil, err
 	}
+	var tamperedFields []string
+	if !isValid {
+		message := fmt.Sprintf("log entry %d does not match its on-chain hash", l.ID)
+		if tamperedFields = l.TamperedFields(fieldHashes); len(tamperedFields) > 0 {
+			message += fmt.Sprintf(", changed fields: %s", strings.Join(tamperedFields, ", "))
+		}
+		raiseAlert(Alert{
+			Kind:    AlertTampered,
+			Source:  l.Source,
+			EntryID: l.ID,
+			Message: message,
+		})
+	}
+	// content whose data key was shredded is gone, though the entry still verifies
+	content, err := l.Plaintext()
+	shredded := errors.Is(err, ErrDataKeyShredded)
+	if err != nil && !shredded {
+		return nil, err
+	}
+	var labels map[string]string
+	if !shredded {
+		if labels, err = l.PlaintextLabels(); err != nil {
+			return nil, err
+		}
+	}
 	dle := DetailedLogEntry{
-		ID:        l.ID,
-		Content:   l.Content,
-		Timestamp: l.Timestamp,
-		Source:    l.Source,
-		IsValid:   isValid,
+		ID:               l.ID,
+		Content:          content,
+		Timestamp:        l.Timestamp,
+		Source:           l.Source,
+		EventTime:        l.EventTime,
+		Labels:           labels,
+		Fields:           l.Fields,
+		RedactionVersion: l.RedactionVersion,
+		Shredded:         shredded,
+		IsValid:          isValid,
+		TamperedFields:   tamperedFields,
 	}
 	return &dle, nil
 }
 
+// ValidateHash compares the entry, as already loaded, against its anchored hash.
 func (l *LogEntry) ValidateHash(hash string) (bool, error) {
-	err := l.LoadFromDB(l.ID)
-	if err != nil {
-		return false, err
-	}
-
 	actualHash, err := l.Hash()
 
 	if err != nil {
 		return false, err
 	}
 
+	recordVerification(actualHash == hash)
 	return actualHash == hash, nil
 }
 
@@ -85,11 +305,64 @@ func (l *LogEntry) LoadFromDB(id uint) error {
 		return err
 	}
 
-	if err := db.First(&l, id).Error; err != nil {
-		return err
+	err = db.First(&l, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// entries past their retention are read back from the archive
+		archived, archiveErr := loadArchivedEntry(db, id)
+		if errors.Is(archiveErr, gorm.ErrRecordNotFound) {
+			return err
+		} else if archiveErr != nil {
+			return archiveErr
+		}
+		*l = *archived
+		return nil
 	}
+	return err
+}
 
-	return nil
+// LoadLogEntries loads the entries with the given IDs, one query per
+// LoadBatchSize of them, and reads those past their retention back from the
+// archive. IDs found in neither are left out.
+func LoadLogEntries(ids []uint) (map[uint]LogEntry, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[uint]LogEntry, len(ids))
+	for start := 0; start < len(ids); start += LoadBatchSize {
+		batch := ids[start:min(start+LoadBatchSize, len(ids))]
+
+		var rows []LogEntry
+		if err := db.Where("id IN ?", batch).Find(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to load log entries: %w", err)
+		}
+		for _, row := range rows {
+			entries[row.ID] = row
+		}
+
+		var missing []uint
+		for _, id := range batch {
+			if _, ok := entries[id]; !ok {
+				missing = append(missing, id)
+			}
+		}
+		if len(missing) > 0 {
+			archived, err := loadArchivedEntries(db, missing)
+			if err != nil {
+				return nil, err
+			}
+			maps.Copy(entries, archived)
+		}
+	}
+	return entries, nil
+}
+
+// setEventTime records when the logged event happened. Postgres keeps
+// microseconds, so the entry hashes what will be read back.
+func (l *LogEntry) setEventTime(eventTime time.Time) {
+	eventTime = eventTime.UTC().Truncate(time.Microsecond)
+	l.EventTime = &eventTime
 }
 
 func (l *LogEntry) WriteToDB() error {
@@ -98,7 +371,8 @@ func (l *LogEntry) WriteToDB() error {
 		return err
 	}
 
-	if db.Create(&l).Error != nil {
+	defer observeSince(dbWriteDuration, time.Now())
+	if err := db.Create(&l).Error; err != nil {
 		return fmt.Errorf("failed to write log entry to database: %w", err)
 	}
 	return nil
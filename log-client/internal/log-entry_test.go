@@ -0,0 +1,230 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"maps"
+	"reflect"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testLogEntry() LogEntry {
+	return LogEntry{
+		ID:        7,
+		Content:   "level=error msg=boom",
+		Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+		Source:    "app",
+	}
+}
+
+func TestLogEntryHash(t *testing.T) {
+	sum := sha256.Sum256([]byte("7level=error msg=boom2024-01-02T03:04:05.000000006Zapp"))
+	legacyHash := hex.EncodeToString(sum[:])
+	idempotencyKey := "key"
+	salt := "salt"
+	eventTime := time.Date(2024, 1, 2, 3, 4, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		modify   func(*LogEntry)
+		wantSame bool
+	}{
+		{name: "unchanged", modify: func(*LogEntry) {}, wantSame: true},
+		{name: "unhashed fields", modify: func(l *LogEntry) {
+			l.IdempotencyKey = &idempotencyKey
+			l.Fields = map[string]string{"level": "error"}
+		}, wantSame: true},
+		{name: "empty labels", modify: func(l *LogEntry) { l.Labels = map[string]string{} }, wantSame: true},
+		{name: "content", modify: func(l *LogEntry) { l.Content += "!" }},
+		{name: "source", modify: func(l *LogEntry) { l.Source = "other" }},
+		{name: "event time", modify: func(l *LogEntry) { l.EventTime = &eventTime }},
+		{name: "labels", modify: func(l *LogEntry) { l.Labels = map[string]string{"env": "prod"} }},
+		{name: "redaction version", modify: func(l *LogEntry) { l.RedactionVersion = "abc" }},
+		{name: "field salt", modify: func(l *LogEntry) { l.FieldSalt = &salt }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entry := testLogEntry()
+			test.modify(&entry)
+			hash, err := entry.Hash()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// entries written before the optional fields existed keep their hash
+			if (hash == legacyHash) != test.wantSame {
+				t.Errorf("Hash() = %s, legacy hash %s, want same %v", hash, legacyHash, test.wantSame)
+			}
+		})
+	}
+}
+
+func TestLogEntryFieldHashes(t *testing.T) {
+	salt := "0123456789abcdef"
+	otherSalt := "fedcba9876543210"
+
+	unsalted := testLogEntry()
+	salted := testLogEntry()
+	salted.FieldSalt = &salt
+	resalted := testLogEntry()
+	resalted.FieldSalt = &otherSalt
+
+	sum := sha256.Sum256([]byte("Source=app"))
+	if got := unsalted.FieldHashes()["Source"]; got != hex.EncodeToString(sum[:]) {
+		t.Errorf("unsalted Source hash = %s, want a plain hash", got)
+	}
+
+	hashes := salted.FieldHashes()
+	if _, ok := hashes["FieldSalt"]; ok {
+		t.Error("FieldHashes() hashes the salt")
+	}
+	want := []string{"Content", "ID", "Source", "Timestamp"}
+	if got := slices.Sorted(maps.Keys(hashes)); !reflect.DeepEqual(got, want) {
+		t.Errorf("FieldHashes() names = %v, want %v", got, want)
+	}
+	for _, name := range want {
+		if hashes[name] == unsalted.FieldHashes()[name] || hashes[name] == resalted.FieldHashes()[name] {
+			t.Errorf("%s hash does not depend on the salt", name)
+		}
+	}
+}
+
+func TestLogEntryTamperedFields(t *testing.T) {
+	salt := "salt"
+	original := testLogEntry()
+	original.FieldSalt = &salt
+	original.Labels = map[string]string{"env": "prod"}
+	anchored := original.FieldHashes()
+
+	tests := []struct {
+		name     string
+		modify   func(*LogEntry)
+		anchored map[string]string
+		want     []string
+	}{
+		{name: "untouched", modify: func(*LogEntry) {}, anchored: anchored},
+		{name: "content", modify: func(l *LogEntry) { l.Content = "level=info" }, anchored: anchored, want: []string{"Content"}},
+		{name: "content and source", modify: func(l *LogEntry) {
+			l.Content = "level=info"
+			l.Source = "other"
+		}, anchored: anchored, want: []string{"Content", "Source"}},
+		{name: "field removed", modify: func(l *LogEntry) { l.Labels = nil }, anchored: anchored, want: []string{"Labels"}},
+		{name: "field added", modify: func(l *LogEntry) { l.RedactionVersion = "abc" }, anchored: anchored, want: []string{"RedactionVersion"}},
+		{name: "salt replaced", modify: func(l *LogEntry) {
+			other := "other"
+			l.FieldSalt = &other
+		}, anchored: anchored, want: []string{"Content", "ID", "Labels", "Source", "Timestamp"}},
+		{name: "anchor without field hashes", modify: func(l *LogEntry) { l.Content = "x" }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entry := original
+			test.modify(&entry)
+			if got := entry.TamperedFields(test.anchored); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("TamperedFields() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewFieldSalt(t *testing.T) {
+	first, err := newFieldSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := newFieldSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*first) != 32 || *first == *second {
+		t.Errorf("newFieldSalt() = %s, %s", *first, *second)
+	}
+}
+
+func TestRunBounded(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+		limit int
+	}{
+		{name: "nothing to do", count: 0, limit: 2},
+		{name: "fewer than the limit", count: 3, limit: 8},
+		{name: "many times the limit", count: 50, limit: 4},
+		{name: "one at a time", count: 5, limit: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var running, peak atomic.Int32
+			calls := make([]atomic.Int32, test.count)
+			runBounded(test.count, test.limit, func(i int) {
+				now := running.Add(1)
+				for {
+					seen := peak.Load()
+					if now <= seen || peak.CompareAndSwap(seen, now) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				calls[i].Add(1)
+				running.Add(-1)
+			})
+
+			if got := peak.Load(); got > int32(test.limit) {
+				t.Errorf("ran %d calls at once, limit %d", got, test.limit)
+			}
+			for i := range calls {
+				if got := calls[i].Load(); got != 1 {
+					t.Errorf("index %d ran %d times", i, got)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyLoaded(t *testing.T) {
+	stored := testLogEntry()
+	hash, err := stored.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		anchor    Anchor
+		wantValid bool
+		wantErr   error
+	}{
+		{name: "matching hash", anchor: Anchor{EntryID: stored.ID, Source: "app", Hash: hash}, wantValid: true},
+		{name: "tampered entry", anchor: Anchor{EntryID: stored.ID, Source: "app", Hash: "tampered"}},
+		{name: "missing entry", anchor: Anchor{EntryID: 8, Source: "app", Hash: hash}, wantErr: ErrLogEntryMissing},
+	}
+
+	// one batch of anchors, verified concurrently but reported in order
+	var anchors []Anchor
+	for range VerifyConcurrency {
+		for _, test := range tests {
+			anchors = append(anchors, test.anchor)
+		}
+	}
+	results := verifyLoaded(anchors, map[uint]LogEntry{stored.ID: stored})
+	if len(results) != len(anchors) {
+		t.Fatalf("verifyLoaded() returned %d results, want %d", len(results), len(anchors))
+	}
+
+	for i, result := range results {
+		test := tests[i%len(tests)]
+		if !errors.Is(result.Err, test.wantErr) || (test.wantErr == nil) != (result.Err == nil) {
+			t.Errorf("%s: result %d error = %v, want %v", test.name, i, result.Err, test.wantErr)
+			continue
+		}
+		if result.Err == nil && (result.Entry.IsValid != test.wantValid || result.Entry.ID != stored.ID) {
+			t.Errorf("%s: result %d = %+v", test.name, i, result.Entry)
+		}
+	}
+}
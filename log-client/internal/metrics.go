@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	linesRead = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "immutable_log",
+		Name:      "watcher_lines_read_total",
+		Help:      "Lines read from watched files.",
+	}, []string{"watcher"})
+
+	dbWriteDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "immutable_log",
+		Name:      "db_write_duration_seconds",
+		Help:      "Latency of writing log entries to the off-chain database.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	fabricDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "immutable_log",
+		Name:      "fabric_duration_seconds",
+		Help:      "Latency of Fabric transaction phases (endorse, submit, commit).",
+		Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"phase"})
+
+	commitFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "immutable_log",
+		Name:      "commit_failures_total",
+		Help:      "Transactions that failed to commit, by validation status code.",
+	}, []string{"code"})
+
+	spoolDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "immutable_log",
+		Name:      "spool_depth",
+		Help:      "Entries stored off-chain and still waiting for their ledger commit.",
+	})
+
+	verifiedEntries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "immutable_log",
+		Name:      "verified_entries_total",
+		Help:      "Entries checked against their on-chain hash, by result.",
+	}, []string{"result"})
+
+	alertsRaised = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "immutable_log",
+		Name:      "alerts_total",
+		Help:      "Integrity alerts raised, by kind and what happened to them.",
+	}, []string{"kind", "result"})
+
+	peerFailovers = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "immutable_log",
+		Name:      "peer_failovers_total",
+		Help:      "Times the client switched to another gateway peer.",
+	})
+)
+
+// MetricsHandler exposes every registered metric in the Prometheus text format.
+func MetricsHandler() http.Handler {
+	return promhttp.Handler()
+}
+
+// observeSince records the seconds elapsed since start in the given observer.
+func observeSince(observer prometheus.Observer, start time.Time) {
+	observer.Observe(time.Since(start).Seconds())
+}
+
+func recordVerification(valid bool) {
+	if valid {
+		verifiedEntries.WithLabelValues("valid").Inc()
+	} else {
+		verifiedEntries.WithLabelValues("invalid").Inc()
+	}
+}
@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"bufio"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scrape reads one sample from the metrics endpoint, zero when not exported yet.
+func scrape(t *testing.T, sample string) float64 {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	scanner := bufio.NewScanner(recorder.Body)
+	for scanner.Scan() {
+		value, found := strings.CutPrefix(scanner.Text(), sample+" ")
+		if !found {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	return 0
+}
+
+func TestMetrics(t *testing.T) {
+	entry := testLogEntry()
+	hash, err := entry.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		record    func()
+		sample    string
+		wantDelta float64
+	}{
+		{
+			name:      "matching hash",
+			record:    func() { _, _ = entry.ValidateHash(hash) },
+			sample:    `immutable_log_verified_entries_total{result="valid"}`,
+			wantDelta: 1,
+		},
+		{
+			name:      "tampered hash",
+			record:    func() { _, _ = entry.ValidateHash("tampered") },
+			sample:    `immutable_log_verified_entries_total{result="invalid"}`,
+			wantDelta: 1,
+		},
+		{
+			name:      "spooled entries",
+			record:    func() { spoolAdd(); spoolAdd(); spoolDone() },
+			sample:    "immutable_log_spool_depth",
+			wantDelta: 1,
+		},
+		{
+			name:      "anchored entries",
+			record:    func() { spoolDone() },
+			sample:    "immutable_log_spool_depth",
+			wantDelta: -1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := scrape(t, test.sample)
+			test.record()
+
+			if delta := scrape(t, test.sample) - before; delta != test.wantDelta {
+				t.Errorf("%s changed by %v, want %v", test.sample, delta, test.wantDelta)
+			}
+			// the gauge follows the depth the readiness check reads
+			if got, want := scrape(t, "immutable_log_spool_depth"), float64(SpoolDepth()); got != want {
+				t.Errorf("spool depth gauge = %v, SpoolDepth() = %v", got, want)
+			}
+		})
+	}
+}
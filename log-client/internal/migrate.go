@@ -0,0 +1,245 @@
+package internal
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// ErrSchemaMismatch is returned by InitDB when the database schema is not at
+// the version this build expects.
+var ErrSchemaMismatch = errors.New("database schema version mismatch")
+
+// Migration is one versioned step of the database schema, read from the
+// embedded migrations directory. Down is empty when the step cannot be undone.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// SchemaMigration records an applied migration in schema_migrations.
+type SchemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+const schemaMigrationsSQL = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version bigint PRIMARY KEY,
+	name text,
+	applied_at timestamptz
+)`
+
+// Migrations returns the embedded migrations in order.
+func Migrations() ([]Migration, error) {
+	files, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, file := range files {
+		match := migrationName.FindStringSubmatch(file.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", file.Name())
+		}
+		script, err := fs.ReadFile(migrationFiles, "migrations/"+file.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(script)
+		} else {
+			migration.Down = string(script)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up script", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// LatestSchemaVersion is the schema version this build expects.
+func LatestSchemaVersion() int {
+	migrations, err := Migrations()
+	if err != nil || len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// schemaVersion returns the version of the latest applied migration, 0 for a
+// database that was never migrated.
+func schemaVersion(db *gorm.DB) (int, error) {
+	var exists bool
+	if err := db.Raw("SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists).Error; err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	var version int
+	if err := db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error; err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// checkSchema fails with ErrSchemaMismatch unless every migration, and no
+// unknown one, has been applied.
+func checkSchema(db *gorm.DB) error {
+	version, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if latest := LatestSchemaVersion(); version != latest {
+		return fmt.Errorf("%w: database is at version %d, this build expects %d, run `go run cmd/migrate/main.go up`",
+			ErrSchemaMismatch, version, latest)
+	}
+	return nil
+}
+
+// SchemaVersion returns the version of the latest applied migration.
+func SchemaVersion() (int, error) {
+	db, err := openDB(DatabaseConfigFromEnv().MigrationDSN)
+	if err != nil {
+		return 0, err
+	}
+	defer closeDB(db)
+
+	return schemaVersion(db)
+}
+
+// MigrateUp applies the pending migrations up to and including target, or
+// all of them when target is 0. Each migration runs in its own transaction
+// and is passed to applied once committed.
+func MigrateUp(target int, applied func(Migration)) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	if target == 0 && len(migrations) > 0 {
+		target = migrations[len(migrations)-1].Version
+	}
+
+	return migrate(applied, func(tx *gorm.DB, version int) (*Migration, error) {
+		for _, migration := range migrations {
+			if migration.Version <= version {
+				continue
+			}
+			if migration.Version > target {
+				return nil, nil
+			}
+			if err := tx.Exec(migration.Up).Error; err != nil {
+				return nil, fmt.Errorf("failed to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			record := SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}
+			if err := tx.Create(&record).Error; err != nil {
+				return nil, fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+			}
+			return &migration, nil
+		}
+		return nil, nil
+	})
+}
+
+// MigrateDown reverts the applied migrations above target, newest first,
+// passing each to reverted once committed.
+func MigrateDown(target int, reverted func(Migration)) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	return migrate(reverted, func(tx *gorm.DB, version int) (*Migration, error) {
+		if version <= target {
+			return nil, nil
+		}
+		// refuse up front rather than stop halfway down
+		for _, migration := range migrations {
+			if migration.Version > target && migration.Version <= version && migration.Down == "" {
+				return nil, fmt.Errorf("migration %d_%s cannot be reverted", migration.Version, migration.Name)
+			}
+		}
+		for _, migration := range migrations {
+			if migration.Version != version {
+				continue
+			}
+			if err := tx.Exec(migration.Down).Error; err != nil {
+				return nil, fmt.Errorf("failed to revert migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			if err := tx.Delete(&SchemaMigration{}, "version = ?", version).Error; err != nil {
+				return nil, fmt.Errorf("failed to record migration %d: %w", version, err)
+			}
+			return &migration, nil
+		}
+		return nil, fmt.Errorf("database is at version %d, which this build does not know", version)
+	})
+}
+
+// migrate runs step, which applies or reverts one migration, in transactions
+// until it returns nil, and passes each committed migration to done. Each
+// transaction holds an advisory lock, so that concurrent runs take turns and
+// see each other's work.
+func migrate(done func(Migration), step func(tx *gorm.DB, version int) (*Migration, error)) error {
+	db, err := openDB(DatabaseConfigFromEnv().MigrationDSN)
+	if err != nil {
+		return err
+	}
+	defer closeDB(db)
+
+	for {
+		var migration *Migration
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('schema_migrations'))").Error; err != nil {
+				return err
+			}
+			if err := tx.Exec(schemaMigrationsSQL).Error; err != nil {
+				return fmt.Errorf("failed to create schema_migrations: %w", err)
+			}
+			version, err := schemaVersion(tx)
+			if err != nil {
+				return err
+			}
+			migration, err = step(tx, version)
+			return err
+		})
+		if err != nil || migration == nil {
+			return err
+		}
+		if done != nil {
+			done(*migration)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package internal
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	tests := []struct {
+		version    int
+		name       string
+		reversible bool
+	}{
+		{version: 1, name: "initial_schema"},
+		{version: 2, name: "append_only", reversible: true},
+		{version: 3, name: "field_salt"},
+		{version: 4, name: "archived_entry_filters", reversible: true},
+		{version: 5, name: "sealed_entry_fields"},
+	}
+
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != len(tests) {
+		t.Fatalf("Migrations() returned %d migrations, want %d", len(migrations), len(tests))
+	}
+	if got := LatestSchemaVersion(); got != tests[len(tests)-1].version {
+		t.Errorf("LatestSchemaVersion() = %d, want %d", got, tests[len(tests)-1].version)
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			migration := migrations[i]
+			if migration.Version != test.version || migration.Name != test.name {
+				t.Errorf("migration %d = %d_%s, want %d_%s", i, migration.Version, migration.Name, test.version, test.name)
+			}
+			if strings.TrimSpace(migration.Up) == "" {
+				t.Error("migration has no up script")
+			}
+			if reversible := migration.Down != ""; reversible != test.reversible {
+				t.Errorf("reversible = %v, want %v", reversible, test.reversible)
+			}
+		})
+	}
+}
+
+// Databases created by AutoMigrate adopt the initial schema in place, so every
+// column it creates has to be added to tables that predate the column.
+func TestInitialSchemaAddsColumns(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := migrations[0].Up
+
+	createTable := regexp.MustCompile(`(?s)CREATE TABLE IF NOT EXISTS (\w+) \((.*?)\n\);`)
+	tables := createTable.FindAllStringSubmatch(script, -1)
+	if len(tables) == 0 {
+		t.Fatal("initial schema creates no tables")
+	}
+
+	for _, table := range tables {
+		t.Run(table[1], func(t *testing.T) {
+			for _, line := range strings.Split(strings.TrimSpace(table[2]), "\n") {
+				column := strings.TrimSuffix(strings.TrimSpace(line), ",")
+				if strings.HasSuffix(column, "PRIMARY KEY") {
+					continue
+				}
+				alter := "ALTER TABLE " + table[1] + " ADD COLUMN IF NOT EXISTS " + column + ";"
+				if !strings.Contains(script, alter) {
+					t.Errorf("missing %q", alter)
+				}
+			}
+		})
+	}
+}
+
+var privilegeStatement = regexp.MustCompile(`(?s)(GRANT|REVOKE) (.+?) ON (.+?) (TO|FROM) (\w+);`)
+
+// privileges replays the GRANT and REVOKE statements of scripts into the
+// privileges of each role per object. Grants on every table in the schema are
+// kept under "*".
+func privileges(scripts ...string) map[string]map[string]map[string]bool {
+	granted := map[string]map[string]map[string]bool{}
+	for _, script := range scripts {
+		var lines []string
+		for _, line := range strings.Split(script, "\n") {
+			if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+				lines = append(lines, line)
+			}
+		}
+
+		for _, statement := range privilegeStatement.FindAllStringSubmatch(strings.Join(lines, "\n"), -1) {
+			var objects []string
+			switch target := strings.Join(strings.Fields(statement[3]), " "); {
+			case target == "TABLES" || target == "ALL TABLES IN SCHEMA public":
+				objects = []string{"*"}
+			case target == "ALL SEQUENCES IN SCHEMA public":
+				objects = []string{"sequences"}
+			case strings.HasPrefix(target, "FUNCTION "):
+				name, _, _ := strings.Cut(strings.TrimPrefix(target, "FUNCTION "), "(")
+				objects = []string{name}
+			default:
+				objects = regexp.MustCompile(`,\s*`).Split(target, -1)
+			}
+
+			role := statement[5]
+			if granted[role] == nil {
+				granted[role] = map[string]map[string]bool{}
+			}
+			for _, object := range objects {
+				if granted[role][object] == nil {
+					granted[role][object] = map[string]bool{}
+				}
+				for _, privilege := range regexp.MustCompile(`\w+(?: \([^)]*\))?`).FindAllString(statement[2], -1) {
+					switch {
+					case statement[1] == "GRANT":
+						granted[role][object][privilege] = true
+					case privilege == "ALL":
+						clear(granted[role][object])
+					default:
+						delete(granted[role][object], privilege)
+					}
+				}
+			}
+		}
+	}
+	return granted
+}
+
+// The gateway, maintenance and reader logins each hold only what their part
+// needs; in particular none of them may rewrite entries, anchors or holds.
+func TestRolePrivileges(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scripts []string
+	for _, migration := range migrations {
+		scripts = append(scripts, migration.Up)
+	}
+	granted := privileges(scripts...)
+
+	tests := []struct {
+		role      string
+		object    string
+		privilege string
+		want      bool
+	}{
+		{role: "log_ingest", object: "log_entries", privilege: "INSERT", want: true},
+		{role: "log_ingest", object: "log_entries", privilege: "UPDATE"},
+		{role: "log_ingest", object: "log_entries", privilege: "DELETE"},
+		{role: "log_ingest", object: "anchors", privilege: "INSERT", want: true},
+		{role: "log_ingest", object: "anchors", privilege: "UPDATE"},
+		{role: "log_ingest", object: "holds", privilege: "INSERT"},
+		{role: "log_ingest", object: "archived_entries", privilege: "INSERT"},
+		{role: "log_ingest", object: "archive_log_entries", privilege: "EXECUTE"},
+		{role: "log_maintenance", object: "log_entries", privilege: "UPDATE (fields)", want: true},
+		{role: "log_maintenance", object: "log_entries", privilege: "UPDATE"},
+		{role: "log_maintenance", object: "log_entries", privilege: "DELETE"},
+		{role: "log_maintenance", object: "archived_entries", privilege: "INSERT"},
+		{role: "log_maintenance", object: "anchors", privilege: "UPDATE"},
+		{role: "log_maintenance", object: "holds", privilege: "UPDATE", want: true},
+		{role: "log_maintenance", object: "data_keys", privilege: "UPDATE (wrapped_key, shredded_at)", want: true},
+		{role: "log_maintenance", object: "archive_log_entries", privilege: "EXECUTE", want: true},
+		{role: "PUBLIC", object: "archive_log_entries", privilege: "EXECUTE"},
+		{role: "log_reader", object: "log_entries", privilege: "SELECT", want: true},
+		{role: "log_reader", object: "archived_entries", privilege: "SELECT", want: true},
+		{role: "log_reader", object: "log_entries", privilege: "INSERT"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.role+" "+test.privilege+" "+test.object, func(t *testing.T) {
+			got := granted[test.role][test.object][test.privilege] || granted[test.role]["*"][test.privilege]
+			if got != test.want {
+				t.Errorf("granted = %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	// reverting append_only takes back everything it granted
+	for role, objects := range privileges(migrations[1].Up, migrations[1].Down) {
+		for object, privileges := range objects {
+			if len(privileges) > 0 {
+				t.Errorf("%s keeps %v on %s after reverting append_only", role, privileges, object)
+			}
+		}
+	}
+}
+
+func TestAppendOnlyTriggers(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	createTrigger := regexp.MustCompile(`CREATE TRIGGER \w+ BEFORE ([A-Z ]+) ON log_entries`)
+
+	protected := map[string]bool{}
+	for _, trigger := range createTrigger.FindAllStringSubmatch(migrations[1].Up, -1) {
+		for _, operation := range strings.Split(trigger[1], " OR ") {
+			protected[strings.TrimSpace(operation)] = true
+		}
+	}
+
+	tests := []struct {
+		operation string
+		want      bool
+	}{
+		{operation: "UPDATE", want: true},
+		{operation: "DELETE", want: true},
+		{operation: "TRUNCATE", want: true},
+		{operation: "INSERT"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.operation, func(t *testing.T) {
+			if protected[test.operation] != test.want {
+				t.Errorf("trigger on %s = %v, want %v", test.operation, protected[test.operation], test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+-- The schema AutoMigrate used to create. Databases it created adopt the
+-- versioned schema in place: tables are only created when missing, and the
+-- columns that later versions of AutoMigrate added are added to older ones
+-- before they are indexed. Not reversible, since reverting would drop the
+-- log.
+
+CREATE TABLE IF NOT EXISTS log_entries (
+	id bigserial PRIMARY KEY,
+	content text,
+	"timestamp" timestamptz,
+	source text,
+	event_time timestamptz,
+	labels jsonb,
+	idempotency_key text,
+	fields jsonb,
+	redaction_version text,
+	data_key_id text
+);
+ALTER TABLE log_entries ADD COLUMN IF NOT EXISTS content text;
+ALTER TABLE log_entries ADD COLUMN IF NOT EXISTS "timestamp" timestamptz;
+ALTER TABLE log_entries ADD COLUMN IF NOT EXISTS source text;
+ALTER TABLE log_entries ADD COLUMN IF NOT EXISTS event_time timestamptz;
+ALTER TABLE log_entries ADD COLUMN IF NOT EXISTS labels jsonb;
+ALTER TABLE log_entries ADD COLUMN IF NOT EXISTS idempotency_key text;
+ALTER TABLE log_entries ADD COLUMN IF NOT EXISTS fields jsonb;
+ALTER TABLE log_entries ADD COLUMN IF NOT EXISTS redaction_version text;
+ALTER TABLE log_entries ADD COLUMN IF NOT EXISTS data_key_id text;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_log_entries_idempotency ON log_entries (source, idempotency_key);
+CREATE INDEX IF NOT EXISTS idx_log_entries_fields ON log_entries USING gin (fields);
+CREATE INDEX IF NOT EXISTS idx_log_entries_data_key_id ON log_entries (data_key_id);
+
+CREATE TABLE IF NOT EXISTS anchors (
+	id bigserial PRIMARY KEY,
+	log_id text,
+	tx_id text,
+	block_number bigint,
+	entry_id bigint,
+	blob_path text,
+	hash text,
+	source text,
+	"timestamp" text,
+	field_hashes jsonb
+);
+ALTER TABLE anchors ADD COLUMN IF NOT EXISTS log_id text;
+ALTER TABLE anchors ADD COLUMN IF NOT EXISTS tx_id text;
+ALTER TABLE anchors ADD COLUMN IF NOT EXISTS block_number bigint;
+ALTER TABLE anchors ADD COLUMN IF NOT EXISTS entry_id bigint;
+ALTER TABLE anchors ADD COLUMN IF NOT EXISTS blob_path text;
+ALTER TABLE anchors ADD COLUMN IF NOT EXISTS hash text;
+ALTER TABLE anchors ADD COLUMN IF NOT EXISTS source text;
+ALTER TABLE anchors ADD COLUMN IF NOT EXISTS "timestamp" text;
+ALTER TABLE anchors ADD COLUMN IF NOT EXISTS field_hashes jsonb;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_anchors_log_id ON anchors (log_id);
+CREATE INDEX IF NOT EXISTS idx_anchors_tx_id ON anchors (tx_id);
+CREATE INDEX IF NOT EXISTS idx_anchors_block_number ON anchors (block_number);
+CREATE INDEX IF NOT EXISTS idx_anchors_entry_id ON anchors (entry_id);
+CREATE INDEX IF NOT EXISTS idx_anchors_source ON anchors (source);
+
+CREATE TABLE IF NOT EXISTS indexer_checkpoints (
+	channel text PRIMARY KEY,
+	next_block bigint,
+	updated_at timestamptz
+);
+ALTER TABLE indexer_checkpoints ADD COLUMN IF NOT EXISTS next_block bigint;
+ALTER TABLE indexer_checkpoints ADD COLUMN IF NOT EXISTS updated_at timestamptz;
+
+CREATE TABLE IF NOT EXISTS integrity_statuses (
+	anchor_id bigint PRIMARY KEY,
+	log_id text,
+	entry_id bigint,
+	source text,
+	result text,
+	last_verified_at timestamptz
+);
+ALTER TABLE integrity_statuses ADD COLUMN IF NOT EXISTS log_id text;
+ALTER TABLE integrity_statuses ADD COLUMN IF NOT EXISTS entry_id bigint;
+ALTER TABLE integrity_statuses ADD COLUMN IF NOT EXISTS source text;
+ALTER TABLE integrity_statuses ADD COLUMN IF NOT EXISTS result text;
+ALTER TABLE integrity_statuses ADD COLUMN IF NOT EXISTS last_verified_at timestamptz;
+CREATE INDEX IF NOT EXISTS idx_integrity_statuses_log_id ON integrity_statuses (log_id);
+CREATE INDEX IF NOT EXISTS idx_integrity_statuses_entry_id ON integrity_statuses (entry_id);
+CREATE INDEX IF NOT EXISTS idx_integrity_statuses_source ON integrity_statuses (source);
+CREATE INDEX IF NOT EXISTS idx_integrity_statuses_result ON integrity_statuses (result);
+CREATE INDEX IF NOT EXISTS idx_integrity_statuses_last_verified_at ON integrity_statuses (last_verified_at);
+
+CREATE TABLE IF NOT EXISTS scanner_checkpoints (
+	name text PRIMARY KEY,
+	last_anchor_id bigint,
+	updated_at timestamptz
+);
+ALTER TABLE scanner_checkpoints ADD COLUMN IF NOT EXISTS last_anchor_id bigint;
+ALTER TABLE scanner_checkpoints ADD COLUMN IF NOT EXISTS updated_at timestamptz;
+
+CREATE TABLE IF NOT EXISTS pending_receipts (
+	token text PRIMARY KEY,
+	entry_id bigint,
+	source text,
+	status text,
+	log_id text,
+	tx_id text,
+	error text,
+	created_at timestamptz,
+	updated_at timestamptz
+);
+ALTER TABLE pending_receipts ADD COLUMN IF NOT EXISTS entry_id bigint;
+ALTER TABLE pending_receipts ADD COLUMN IF NOT EXISTS source text;
+ALTER TABLE pending_receipts ADD COLUMN IF NOT EXISTS status text;
+ALTER TABLE pending_receipts ADD COLUMN IF NOT EXISTS log_id text;
+ALTER TABLE pending_receipts ADD COLUMN IF NOT EXISTS tx_id text;
+ALTER TABLE pending_receipts ADD COLUMN IF NOT EXISTS error text;
+ALTER TABLE pending_receipts ADD COLUMN IF NOT EXISTS created_at timestamptz;
+ALTER TABLE pending_receipts ADD COLUMN IF NOT EXISTS updated_at timestamptz;
+CREATE INDEX IF NOT EXISTS idx_pending_receipts_entry_id ON pending_receipts (entry_id);
+
+CREATE TABLE IF NOT EXISTS data_keys (
+	id text PRIMARY KEY,
+	source text,
+	period text,
+	wrapped_key bytea,
+	created_at timestamptz,
+	shredded_at timestamptz
+);
+ALTER TABLE data_keys ADD COLUMN IF NOT EXISTS source text;
+ALTER TABLE data_keys ADD COLUMN IF NOT EXISTS period text;
+ALTER TABLE data_keys ADD COLUMN IF NOT EXISTS wrapped_key bytea;
+ALTER TABLE data_keys ADD COLUMN IF NOT EXISTS created_at timestamptz;
+ALTER TABLE data_keys ADD COLUMN IF NOT EXISTS shredded_at timestamptz;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_data_keys_scope ON data_keys (source, period) WHERE shredded_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS archive_segments (
+	id bigserial PRIMARY KEY,
+	"key" text,
+	source text,
+	entries bigint,
+	first_entry_id bigint,
+	last_entry_id bigint,
+	oldest_timestamp timestamptz,
+	newest_timestamp timestamptz,
+	size bigint,
+	created_at timestamptz
+);
+ALTER TABLE archive_segments ADD COLUMN IF NOT EXISTS "key" text;
+ALTER TABLE archive_segments ADD COLUMN IF NOT EXISTS source text;
+ALTER TABLE archive_segments ADD COLUMN IF NOT EXISTS entries bigint;
+ALTER TABLE archive_segments ADD COLUMN IF NOT EXISTS first_entry_id bigint;
+ALTER TABLE archive_segments ADD COLUMN IF NOT EXISTS last_entry_id bigint;
+ALTER TABLE archive_segments ADD COLUMN IF NOT EXISTS oldest_timestamp timestamptz;
+ALTER TABLE archive_segments ADD COLUMN IF NOT EXISTS newest_timestamp timestamptz;
+ALTER TABLE archive_segments ADD COLUMN IF NOT EXISTS size bigint;
+ALTER TABLE archive_segments ADD COLUMN IF NOT EXISTS created_at timestamptz;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_archive_segments_key ON archive_segments ("key");
+CREATE INDEX IF NOT EXISTS idx_archive_segments_source ON archive_segments (source);
+
+CREATE TABLE IF NOT EXISTS archived_entries (
+	entry_id bigint PRIMARY KEY,
+	segment_id bigint,
+	data_key_id text
+);
+ALTER TABLE archived_entries ADD COLUMN IF NOT EXISTS segment_id bigint;
+ALTER TABLE archived_entries ADD COLUMN IF NOT EXISTS data_key_id text;
+CREATE INDEX IF NOT EXISTS idx_archived_entries_segment_id ON archived_entries (segment_id);
+CREATE INDEX IF NOT EXISTS idx_archived_entries_data_key_id ON archived_entries (data_key_id);
+
+CREATE TABLE IF NOT EXISTS holds (
+	hold_id text PRIMARY KEY,
+	kind text,
+	source text,
+	from_log_id text,
+	to_log_id text,
+	retain_until text,
+	reason text,
+	created_by text,
+	"timestamp" text,
+	released_at text,
+	released_by text
+);
+ALTER TABLE holds ADD COLUMN IF NOT EXISTS kind text;
+ALTER TABLE holds ADD COLUMN IF NOT EXISTS source text;
+ALTER TABLE holds ADD COLUMN IF NOT EXISTS from_log_id text;
+ALTER TABLE holds ADD COLUMN IF NOT EXISTS to_log_id text;
+ALTER TABLE holds ADD COLUMN IF NOT EXISTS retain_until text;
+ALTER TABLE holds ADD COLUMN IF NOT EXISTS reason text;
+ALTER TABLE holds ADD COLUMN IF NOT EXISTS created_by text;
+ALTER TABLE holds ADD COLUMN IF NOT EXISTS "timestamp" text;
+ALTER TABLE holds ADD COLUMN IF NOT EXISTS released_at text;
+ALTER TABLE holds ADD COLUMN IF NOT EXISTS released_by text;
+CREATE INDEX IF NOT EXISTS idx_holds_source ON holds (source);
@@ -0,0 +1,22 @@
+-- The roles are left in place, as they are shared by the whole cluster and
+-- may be granted to login roles.
+
+ALTER DEFAULT PRIVILEGES IN SCHEMA public REVOKE SELECT ON TABLES FROM log_reader;
+REVOKE SELECT ON ALL TABLES IN SCHEMA public FROM log_reader;
+
+REVOKE SELECT ON anchors FROM log_maintenance;
+REVOKE SELECT, INSERT, UPDATE ON holds FROM log_maintenance;
+REVOKE SELECT, UPDATE (wrapped_key, shredded_at) ON data_keys FROM log_maintenance;
+REVOKE SELECT ON archive_segments, archived_entries FROM log_maintenance;
+REVOKE SELECT, UPDATE (fields) ON log_entries FROM log_maintenance;
+
+REVOKE USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public FROM log_ingest;
+REVOKE SELECT ON holds, archive_segments, archived_entries, schema_migrations FROM log_ingest;
+REVOKE SELECT, INSERT ON anchors, data_keys FROM log_ingest;
+REVOKE SELECT, INSERT, UPDATE, DELETE ON pending_receipts, indexer_checkpoints,
+	integrity_statuses, scanner_checkpoints FROM log_ingest;
+REVOKE SELECT, INSERT ON log_entries FROM log_ingest;
+
+DROP TRIGGER IF EXISTS log_entries_no_truncate ON log_entries;
+DROP TRIGGER IF EXISTS log_entries_append_only ON log_entries;
+DROP FUNCTION IF EXISTS log_entries_append_only();
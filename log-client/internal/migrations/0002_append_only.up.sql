@@ -0,0 +1,71 @@
+-- Rejects updates, deletes and truncation of log_entries, so that tampering
+-- is blocked instead of only detected. Only rows already recorded in
+-- archived_entries may be deleted, which archive_log_entries does as the
+-- owner of the tables. Transactions of members of log_maintenance that set
+-- log_client.maintenance may clear the unhashed fields column, which
+-- shredding needs. Also sets up the roles of the database logins: the login
+-- that migrates owns the tables, the gateway's login is granted log_ingest
+-- and log_reader, and only the login of MAINTENANCE_DSN should be granted
+-- log_maintenance. The roles are created when missing, which needs the
+-- CREATEROLE privilege unless an administrator created them up front.
+
+CREATE OR REPLACE FUNCTION log_entries_append_only() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'DELETE' AND EXISTS (SELECT FROM archived_entries WHERE entry_id = OLD.id) THEN
+		RETURN OLD;
+	END IF;
+	IF TG_OP = 'UPDATE' AND current_setting('log_client.maintenance', true) = 'on'
+		AND pg_has_role(current_user, 'log_maintenance', 'MEMBER') THEN
+		IF to_jsonb(NEW) - 'fields' IS DISTINCT FROM to_jsonb(OLD) - 'fields' THEN
+			RAISE EXCEPTION 'log_entries: maintenance may only clear parsed fields';
+		END IF;
+		RETURN NEW;
+	END IF;
+	RAISE EXCEPTION 'log_entries is append-only, % is not allowed', TG_OP;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS log_entries_append_only ON log_entries;
+CREATE TRIGGER log_entries_append_only BEFORE UPDATE OR DELETE ON log_entries
+	FOR EACH ROW EXECUTE FUNCTION log_entries_append_only();
+DROP TRIGGER IF EXISTS log_entries_no_truncate ON log_entries;
+CREATE TRIGGER log_entries_no_truncate BEFORE TRUNCATE ON log_entries
+	FOR EACH STATEMENT EXECUTE FUNCTION log_entries_append_only();
+
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'log_ingest') THEN
+		CREATE ROLE log_ingest NOLOGIN;
+	END IF;
+	IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'log_reader') THEN
+		CREATE ROLE log_reader NOLOGIN;
+	END IF;
+	IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'log_maintenance') THEN
+		CREATE ROLE log_maintenance NOLOGIN;
+	END IF;
+END;
+$$;
+
+REVOKE ALL ON log_entries FROM PUBLIC;
+
+-- the gateway reads back the existing entry of a repeated idempotency key
+GRANT SELECT, INSERT ON log_entries TO log_ingest;
+GRANT SELECT, INSERT, UPDATE, DELETE ON pending_receipts, indexer_checkpoints,
+	integrity_statuses, scanner_checkpoints TO log_ingest;
+-- anchors vouch for entries and holds protect them, so neither may be changed
+-- by the gateway; holds are written by the maintenance login
+GRANT SELECT, INSERT ON anchors, data_keys TO log_ingest;
+GRANT SELECT ON holds, archive_segments, archived_entries, schema_migrations TO log_ingest;
+GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO log_ingest;
+
+-- shredding destroys data keys; archival goes through archive_log_entries,
+-- since a login that could record archived entries could delete any entry
+GRANT SELECT, UPDATE (fields) ON log_entries TO log_maintenance;
+GRANT SELECT ON archive_segments, archived_entries TO log_maintenance;
+GRANT SELECT, UPDATE (wrapped_key, shredded_at) ON data_keys TO log_maintenance;
+GRANT SELECT, INSERT, UPDATE ON holds TO log_maintenance;
+GRANT SELECT ON anchors TO log_maintenance;
+
+GRANT SELECT ON ALL TABLES IN SCHEMA public TO log_reader;
+-- and the tables of later migrations
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT ON TABLES TO log_reader;
@@ -0,0 +1,5 @@
+-- Adds the per-entry salt that keys the anchored field hashes. Entries
+-- written before it keep a NULL salt and their plain field hashes. Not
+-- reversible, since dropping the salts would leave the entries unverifiable.
+
+ALTER TABLE log_entries ADD COLUMN IF NOT EXISTS field_salt text;
@@ -0,0 +1,5 @@
+DROP FUNCTION IF EXISTS archive_log_entries(text, text, bigint, bigint[]);
+DROP INDEX IF EXISTS idx_archived_entries_fields;
+DROP INDEX IF EXISTS idx_archived_entries_timestamp;
+ALTER TABLE archived_entries DROP COLUMN IF EXISTS fields;
+ALTER TABLE archived_entries DROP COLUMN IF EXISTS "timestamp";
\ No newline at end of file
@@ -0,0 +1,62 @@
+-- Keeps the timestamp and parsed fields of archived entries next to the
+-- pointer to their segment, so that read filters still match them. Entries
+-- archived before this migration have neither and only match unfiltered
+-- reads. Archival moves entries through archive_log_entries.
+
+ALTER TABLE archived_entries ADD COLUMN IF NOT EXISTS "timestamp" timestamptz;
+ALTER TABLE archived_entries ADD COLUMN IF NOT EXISTS fields jsonb;
+CREATE INDEX IF NOT EXISTS idx_archived_entries_timestamp ON archived_entries ("timestamp");
+CREATE INDEX IF NOT EXISTS idx_archived_entries_fields ON archived_entries USING gin (fields);
+
+-- Archives entries of a segment already written to the archive store: records
+-- the segment and its entries, then deletes them from log_entries. It runs as
+-- the owner of the tables, so that the maintenance login, which may only
+-- execute it, cannot record archived entries to delete arbitrary ones. Only
+-- anchored entries of the segment's source that no active hold covers are
+-- archived; the parsed fields of encrypted entries are left out.
+CREATE OR REPLACE FUNCTION archive_log_entries(segment_key text, segment_source text,
+	segment_size bigint, entry_ids bigint[]) RETURNS bigint AS $$
+DECLARE
+	new_segment_id bigint;
+	archived bigint;
+BEGIN
+	-- holds placed meanwhile wait until the entries are gone
+	LOCK TABLE holds IN SHARE MODE;
+	IF EXISTS (
+		SELECT FROM anchors a JOIN holds h ON h.source IN (segment_source, '')
+		WHERE a.entry_id = ANY (entry_ids)
+			AND ((h.kind = 'legal' AND h.released_at = '')
+				OR (h.kind = 'retention'
+					AND h.retain_until > to_char(now() AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"')))
+			AND (h.from_log_id = '' OR a.log_id >= h.from_log_id)
+			AND (h.to_log_id = '' OR a.log_id <= h.to_log_id)
+	) THEN
+		RAISE EXCEPTION 'archive_log_entries: entries of % are under hold', segment_source;
+	END IF;
+
+	INSERT INTO archive_segments ("key", source, entries, first_entry_id, last_entry_id,
+		oldest_timestamp, newest_timestamp, size, created_at)
+	SELECT segment_key, segment_source, count(*), min(id), max(id), min("timestamp"), max("timestamp"),
+		segment_size, now()
+	FROM log_entries WHERE id = ANY (entry_ids)
+	RETURNING id INTO new_segment_id;
+
+	INSERT INTO archived_entries (entry_id, segment_id, data_key_id, "timestamp", fields)
+	SELECT e.id, new_segment_id, e.data_key_id, e."timestamp",
+		CASE WHEN e.data_key_id IS NULL THEN e.fields END
+	FROM log_entries e
+	WHERE e.id = ANY (entry_ids) AND e.source = segment_source
+		AND EXISTS (SELECT FROM anchors a WHERE a.entry_id = e.id);
+	GET DIAGNOSTICS archived = ROW_COUNT;
+	IF archived <> cardinality(entry_ids) THEN
+		RAISE EXCEPTION 'archive_log_entries: % of % entries are anchored entries of %',
+			archived, cardinality(entry_ids), segment_source;
+	END IF;
+
+	DELETE FROM log_entries WHERE id = ANY (entry_ids);
+	RETURN new_segment_id;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER SET search_path = public;
+
+REVOKE ALL ON FUNCTION archive_log_entries(text, text, bigint, bigint[]) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION archive_log_entries(text, text, bigint, bigint[]) TO log_maintenance;
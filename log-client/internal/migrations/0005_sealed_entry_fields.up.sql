@@ -0,0 +1,9 @@
+-- Clears the parsed fields of encrypted entries, which gave their sealed
+-- content away; encrypted entries are now stored without them. Not
+-- reversible, since the fields can only be parsed again from the decrypted
+-- content. The append-only trigger is suspended for the update, which only
+-- the owner of log_entries may do.
+
+ALTER TABLE log_entries DISABLE TRIGGER log_entries_append_only;
+UPDATE log_entries SET fields = NULL WHERE data_key_id IS NOT NULL AND fields IS NOT NULL;
+ALTER TABLE log_entries ENABLE TRIGGER log_entries_append_only;
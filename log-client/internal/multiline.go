@@ -0,0 +1,172 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MultilineConfig joins consecutive lines into one entry. A line matching
+// Start begins a new entry and any other line continues the current one;
+// without Start, only lines matching a Continuation pattern do. The entry is
+// emitted once the next one starts, FlushTimeout passes without a new line or
+// it reaches MaxLines.
+type MultilineConfig struct {
+	Start        string
+	Continuation []string
+	FlushTimeout time.Duration
+	MaxLines     int
+	// QuotedRecords keeps lines together while a CSV quoted field is open,
+	// as in PostgreSQL csvlog records whose message spans lines.
+	QuotedRecords bool
+}
+
+// MultilineConfigFromEnv reads the assembly settings from MULTILINE_*
+// variables. MULTILINE_CONTINUATION holds a single pattern.
+func MultilineConfigFromEnv() MultilineConfig {
+	config := MultilineConfig{
+		Start:        getEnv("MULTILINE_START", ""),
+		FlushTimeout: getEnvDuration("MULTILINE_FLUSH_TIMEOUT", MultilineFlush),
+		MaxLines:     getEnvInt("MULTILINE_MAX_LINES", MultilineMaxLines),
+	}
+	if continuation := getEnv("MULTILINE_CONTINUATION", ""); continuation != "" {
+		config.Continuation = []string{continuation}
+	}
+	return config
+}
+
+// Enabled reports whether lines are joined at all.
+func (c MultilineConfig) Enabled() bool {
+	return c.Start != "" || len(c.Continuation) > 0 || c.QuotedRecords
+}
+
+// LineAssembler joins lines into entries according to a MultilineConfig and
+// hands each entry to emit, in order.
+type LineAssembler struct {
+	start        *regexp.Regexp
+	continuation []*regexp.Regexp
+	quoted       bool
+	flushTimeout time.Duration
+	maxLines     int
+	emit         func(string)
+
+	mu         sync.Mutex
+	lines      []string
+	quotes     int
+	timer      *time.Timer
+	generation int
+}
+
+// NewLineAssembler compiles the patterns of config. When it is not enabled,
+// every line is emitted on its own.
+func NewLineAssembler(config MultilineConfig, emit func(string)) (*LineAssembler, error) {
+	a := &LineAssembler{
+		quoted:       config.QuotedRecords,
+		flushTimeout: config.FlushTimeout,
+		maxLines:     config.MaxLines,
+		emit:         emit,
+	}
+	if a.flushTimeout <= 0 {
+		a.flushTimeout = MultilineFlush
+	}
+	if a.maxLines <= 0 {
+		a.maxLines = MultilineMaxLines
+	}
+
+	if config.Start != "" {
+		start, err := regexp.Compile(config.Start)
+		if err != nil {
+			return nil, fmt.Errorf("invalid multiline start pattern: %w", err)
+		}
+		a.start = start
+	}
+	for _, pattern := range config.Continuation {
+		continuation, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid multiline continuation pattern: %w", err)
+		}
+		a.continuation = append(a.continuation, continuation)
+	}
+
+	return a, nil
+}
+
+// Add takes the next line of the file, with or without its newline.
+func (a *LineAssembler) Add(line string) {
+	line = strings.TrimRight(line, "\r\n")
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.start == nil && len(a.continuation) == 0 && !a.quoted {
+		a.emit(line)
+		return
+	}
+
+	if len(a.lines) > 0 && !a.continues(line) {
+		a.flushLocked()
+	}
+	a.lines = append(a.lines, line)
+	a.quotes += strings.Count(line, `"`)
+	if a.quoted && a.quotes%2 == 0 && a.start == nil && len(a.continuation) == 0 {
+		// the record is complete
+		a.flushLocked()
+		return
+	}
+	if len(a.lines) >= a.maxLines {
+		a.flushLocked()
+		return
+	}
+
+	// a quiet file ends the entry, since the next one may never arrive
+	a.generation++
+	generation := a.generation
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+	a.timer = time.AfterFunc(a.flushTimeout, func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if a.generation == generation {
+			a.flushLocked()
+		}
+	})
+}
+
+// Flush emits the entry being assembled, if any.
+func (a *LineAssembler) Flush() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.flushLocked()
+}
+
+func (a *LineAssembler) continues(line string) bool {
+	// escaped quotes are doubled, so an odd count leaves a quoted field open
+	if a.quoted && a.quotes%2 == 1 {
+		return true
+	}
+	for _, continuation := range a.continuation {
+		if continuation.MatchString(line) {
+			return true
+		}
+	}
+	return a.start != nil && !a.start.MatchString(line)
+}
+
+func (a *LineAssembler) flushLocked() {
+	a.generation++
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+	if len(a.lines) == 0 {
+		return
+	}
+
+	entry := strings.Join(a.lines, "\n")
+	a.lines = nil
+	a.quotes = 0
+	a.emit(entry)
+}
@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLineAssembler(t *testing.T) {
+	tests := []struct {
+		name   string
+		config MultilineConfig
+		lines  []string
+		want   []string
+	}{
+		{
+			name:  "disabled",
+			lines: []string{"first\n", "  second\r\n"},
+			want:  []string{"first", "  second"},
+		},
+		{
+			name:   "start pattern",
+			config: MultilineConfig{Start: `^\d{4}-`},
+			lines:  []string{"2024-01-01 panic", "goroutine 1", "\tmain.go:12", "2024-01-01 next"},
+			want:   []string{"2024-01-01 panic\ngoroutine 1\n\tmain.go:12", "2024-01-01 next"},
+		},
+		{
+			name:   "continuation pattern",
+			config: MultilineConfig{Continuation: []string{`^\s+at `, `^Caused by:`}},
+			lines:  []string{"Exception in thread", "    at Foo.bar", "Caused by: io", "next line", "other line"},
+			want:   []string{"Exception in thread\n    at Foo.bar\nCaused by: io", "next line", "other line"},
+		},
+		{
+			name:   "max lines",
+			config: MultilineConfig{Start: `^START`, MaxLines: 2},
+			lines:  []string{"START", "a", "b", "c", "START"},
+			want:   []string{"START\na", "b\nc", "START"},
+		},
+		{
+			name:   "quoted records",
+			config: MultilineConfig{QuotedRecords: true},
+			lines:  []string{`a,"one line"`, `b,"spans`, `two ""quoted"" lines"`, `c,done`},
+			want:   []string{`a,"one line"`, "b,\"spans\ntwo \"\"quoted\"\" lines\"", "c,done"},
+		},
+		{
+			name:   "quoted records with a start pattern",
+			config: MultilineConfig{Start: `^2024`, QuotedRecords: true},
+			lines:  []string{`2024 "open`, `2024 still quoted"`, `detail`, `2024 next`},
+			want:   []string{"2024 \"open\n2024 still quoted\"\ndetail", "2024 next"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.config.FlushTimeout = time.Hour
+			var entries []string
+			assembler, err := NewLineAssembler(test.config, func(entry string) {
+				entries = append(entries, entry)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, line := range test.lines {
+				assembler.Add(line)
+			}
+			assembler.Flush()
+
+			if !reflect.DeepEqual(entries, test.want) {
+				t.Errorf("entries = %q, want %q", entries, test.want)
+			}
+		})
+	}
+}
+
+func TestLineAssemblerInvalidPattern(t *testing.T) {
+	tests := []struct {
+		name   string
+		config MultilineConfig
+	}{
+		{name: "start", config: MultilineConfig{Start: "("}},
+		{name: "continuation", config: MultilineConfig{Continuation: []string{"["}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewLineAssembler(test.config, func(string) {}); err == nil {
+				t.Error("NewLineAssembler() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestLineAssemblerFlushTimeout(t *testing.T) {
+	emitted := make(chan string, 1)
+	assembler, err := NewLineAssembler(MultilineConfig{Start: `^START`, FlushTimeout: 10 * time.Millisecond}, func(entry string) {
+		emitted <- entry
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assembler.Add("START")
+	assembler.Add("trace")
+
+	select {
+	case entry := <-emitted:
+		if entry != "START\ntrace" {
+			t.Errorf("entry = %q", entry)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("entry was not flushed after the timeout")
+	}
+}
@@ -0,0 +1,345 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// OTLPConfig holds the settings of the OTLP/gRPC log receiver. OTLP/HTTP is
+// served by the API gateway on /v1/logs.
+type OTLPConfig struct {
+	GRPCAddr string
+}
+
+// OTLPConfigFromEnv reads the receiver settings from OTLP_* variables.
+func OTLPConfigFromEnv() OTLPConfig {
+	return OTLPConfig{GRPCAddr: getEnv("OTLP_GRPC_ADDR", "")}
+}
+
+// ExportOTLPLogs stores every log record of an export request and anchors it
+// in the background. Records from sources the caller may not write, or
+// without a body, are rejected and counted in the partial success.
+func ExportOTLPLogs(writer *Writer, request *collogspb.ExportLogsServiceRequest, principal *Principal) *collogspb.ExportLogsServiceResponse {
+	inputs := LogInputsFromOTLP(request)
+
+	accepted := make([]LogInput, 0, len(inputs))
+	var rejected int64
+	var reasons []string
+	for _, input := range inputs {
+		if !principal.Allows(RoleWriter, input.Source) {
+			rejected++
+			reasons = append(reasons, "not allowed to write source "+input.Source)
+			continue
+		}
+		accepted = append(accepted, input)
+	}
+
+	for _, receipt := range writer.IngestBatch(accepted, true) {
+		if receipt.Status == ReceiptFailed {
+			rejected++
+			reasons = append(reasons, receipt.Error)
+		}
+	}
+
+	response := &collogspb.ExportLogsServiceResponse{}
+	if rejected > 0 {
+		response.PartialSuccess = &collogspb.ExportLogsPartialSuccess{
+			RejectedLogRecords: rejected,
+			ErrorMessage:       strings.Join(dedupe(reasons), "; "),
+		}
+	}
+	return response
+}
+
+// LogInputsFromOTLP turns each LogRecord into an entry. The source is the
+// service.name resource attribute, falling back to host.name. Severity, trace
+// context, scope and attributes are kept as labels.
+func LogInputsFromOTLP(request *collogspb.ExportLogsServiceRequest) []LogInput {
+	var inputs []LogInput
+	for _, resourceLogs := range request.GetResourceLogs() {
+		resourceAttributes := resourceLogs.GetResource().GetAttributes()
+		source := attributeString(resourceAttributes, "service.name")
+		if source == "" {
+			source = attributeString(resourceAttributes, "host.name")
+		}
+		if source == "" {
+			source = "unknown_service"
+		}
+
+		for _, scopeLogs := range resourceLogs.GetScopeLogs() {
+			for _, record := range scopeLogs.GetLogRecords() {
+				labels := map[string]string{}
+				addAttributeLabels(labels, "resource.", resourceAttributes)
+				addAttributeLabels(labels, "attr.", record.GetAttributes())
+				if name := scopeLogs.GetScope().GetName(); name != "" {
+					labels["otel.scope.name"] = name
+				}
+				if text := record.GetSeverityText(); text != "" {
+					labels["otel.severity_text"] = text
+				}
+				if number := record.GetSeverityNumber(); number != 0 {
+					labels["otel.severity_number"] = strconv.Itoa(int(number))
+				}
+				if traceID := record.GetTraceId(); len(traceID) > 0 {
+					labels["otel.trace_id"] = hex.EncodeToString(traceID)
+				}
+				if spanID := record.GetSpanId(); len(spanID) > 0 {
+					labels["otel.span_id"] = hex.EncodeToString(spanID)
+				}
+
+				input := LogInput{
+					Source:  source,
+					Content: anyValueString(record.GetBody()),
+					Labels:  labels,
+				}
+
+				// prefer the time of the event over the time it was collected
+				timestamp := record.GetTimeUnixNano()
+				if timestamp == 0 {
+					timestamp = record.GetObservedTimeUnixNano()
+				}
+				if timestamp != 0 {
+					eventTime := time.Unix(0, int64(timestamp)).UTC()
+					input.EventTime = &eventTime
+				}
+
+				inputs = append(inputs, input)
+			}
+		}
+	}
+	return inputs
+}
+
+// DecodeOTLPRequest decodes an OTLP/HTTP body, either binary protobuf or
+// JSON, optionally gzip compressed.
+func DecodeOTLPRequest(body io.Reader, contentType string, contentEncoding string) (*collogspb.ExportLogsServiceRequest, error) {
+	if contentEncoding == "gzip" {
+		reader, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		body = reader
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, IngestBodyLimit+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > IngestBodyLimit {
+		return nil, fmt.Errorf("request body exceeds %d bytes", IngestBodyLimit)
+	}
+
+	request := &collogspb.ExportLogsServiceRequest{}
+	if strings.HasPrefix(contentType, "application/json") {
+		// OTLP/JSON encodes trace and span IDs as hex instead of base64
+		data, err = otlpHexIDsToBase64(data)
+		if err != nil {
+			return nil, err
+		}
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, request)
+	} else {
+		err = proto.Unmarshal(data, request)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode OTLP request: %w", err)
+	}
+	return request, nil
+}
+
+// RunOTLPReceiver serves the OTLP/gRPC logs service until ctx is cancelled.
+// Callers authenticate like on the HTTP API, with credentials in the request
+// metadata or a client certificate.
+func RunOTLPReceiver(ctx context.Context, config OTLPConfig, writer *Writer, auth *Auth, tlsConfig *tls.Config) error {
+	listener, err := net.Listen("tcp", config.GRPCAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for OTLP on %s: %w", config.GRPCAddr, err)
+	}
+
+	var options []grpc.ServerOption
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server := grpc.NewServer(options...)
+	collogspb.RegisterLogsServiceServer(server, &otlpLogsServer{writer: writer, auth: auth})
+
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+
+	if err := server.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return err
+	}
+	return nil
+}
+
+type otlpLogsServer struct {
+	collogspb.UnimplementedLogsServiceServer
+	writer *Writer
+	auth   *Auth
+}
+
+func (s *otlpLogsServer) Export(ctx context.Context, request *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	principal, err := s.auth.Authenticate(grpcAuthRequest(ctx))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if !principal.HasRole(RoleWriter) {
+		return nil, status.Error(codes.PermissionDenied, RoleWriter+" role required")
+	}
+
+	return ExportOTLPLogs(s.writer, request, principal), nil
+}
+
+// grpcAuthRequest presents gRPC metadata and the peer certificate as an HTTP
+// request so the HTTP authenticators apply unchanged.
+func grpcAuthRequest(ctx context.Context) *http.Request {
+	request := &http.Request{Header: http.Header{}}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for key, values := range md {
+			for _, value := range values {
+				request.Header.Add(key, value)
+			}
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			request.TLS = &info.State
+		}
+	}
+	return request
+}
+
+func attributeString(attributes []*commonpb.KeyValue, key string) string {
+	for _, attribute := range attributes {
+		if attribute.GetKey() == key {
+			return anyValueString(attribute.GetValue())
+		}
+	}
+	return ""
+}
+
+func addAttributeLabels(labels map[string]string, prefix string, attributes []*commonpb.KeyValue) {
+	for _, attribute := range attributes {
+		labels[prefix+attribute.GetKey()] = anyValueString(attribute.GetValue())
+	}
+}
+
+// anyValueString renders strings as they are and any other value as JSON.
+func anyValueString(value *commonpb.AnyValue) string {
+	if value == nil {
+		return ""
+	}
+	if s, ok := value.GetValue().(*commonpb.AnyValue_StringValue); ok {
+		return s.StringValue
+	}
+
+	data, err := json.Marshal(anyValueToGo(value))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func anyValueToGo(value *commonpb.AnyValue) any {
+	switch v := value.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return v.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return v.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		return v.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		return base64.StdEncoding.EncodeToString(v.BytesValue)
+	case *commonpb.AnyValue_ArrayValue:
+		values := make([]any, 0, len(v.ArrayValue.GetValues()))
+		for _, item := range v.ArrayValue.GetValues() {
+			values = append(values, anyValueToGo(item))
+		}
+		return values
+	case *commonpb.AnyValue_KvlistValue:
+		values := make(map[string]any, len(v.KvlistValue.GetValues()))
+		for _, item := range v.KvlistValue.GetValues() {
+			values[item.GetKey()] = anyValueToGo(item.GetValue())
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// otlpHexIDsToBase64 rewrites the traceId and spanId fields of an OTLP/JSON
+// body to the base64 encoding protojson expects for bytes.
+func otlpHexIDsToBase64(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("failed to decode OTLP request: %w", err)
+	}
+
+	var walk func(node any)
+	walk = func(node any) {
+		switch n := node.(type) {
+		case map[string]any:
+			for key, value := range n {
+				if key == "traceId" || key == "spanId" {
+					if id, ok := value.(string); ok {
+						if raw, err := hex.DecodeString(id); err == nil {
+							n[key] = base64.StdEncoding.EncodeToString(raw)
+						}
+					}
+					continue
+				}
+				walk(value)
+			}
+		case []any:
+			for _, value := range n {
+				walk(value)
+			}
+		}
+	}
+	walk(document)
+
+	return json.Marshal(document)
+}
+
+func dedupe(items []string) []string {
+	seen := make(map[string]bool, len(items))
+	var unique []string
+	for _, item := range items {
+		if !seen[item] {
+			seen[item] = true
+			unique = append(unique, item)
+		}
+	}
+	return unique
+}
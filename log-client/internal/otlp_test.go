@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"testing"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+func stringAttribute(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func TestLogInputsFromOTLP(t *testing.T) {
+	eventTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	observedTime := eventTime.Add(time.Second)
+
+	tests := []struct {
+		name       string
+		attributes []*commonpb.KeyValue
+		record     *logspb.LogRecord
+		want       LogInput
+	}{
+		{
+			name:       "service name",
+			attributes: []*commonpb.KeyValue{stringAttribute("service.name", "checkout"), stringAttribute("host.name", "web01")},
+			record: &logspb.LogRecord{
+				TimeUnixNano:   uint64(eventTime.UnixNano()),
+				SeverityText:   "ERROR",
+				SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_ERROR,
+				TraceId:        []byte{0x5b, 0x8e},
+				SpanId:         []byte{0xeb, 0x01},
+				Body:           &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "payment failed"}},
+				Attributes:     []*commonpb.KeyValue{stringAttribute("order", "42")},
+			},
+			want: LogInput{
+				Source:    "checkout",
+				Content:   "payment failed",
+				EventTime: &eventTime,
+				Labels: map[string]string{
+					"resource.service.name": "checkout",
+					"resource.host.name":    "web01",
+					"attr.order":            "42",
+					"otel.scope.name":       "scope",
+					"otel.severity_text":    "ERROR",
+					"otel.severity_number":  "17",
+					"otel.trace_id":         "5b8e",
+					"otel.span_id":          "eb01",
+				},
+			},
+		},
+		{
+			name:       "host name and observed time",
+			attributes: []*commonpb.KeyValue{stringAttribute("host.name", "web01")},
+			record: &logspb.LogRecord{
+				ObservedTimeUnixNano: uint64(observedTime.UnixNano()),
+				Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: 7}},
+			},
+			want: LogInput{
+				Source:    "web01",
+				Content:   "7",
+				EventTime: &observedTime,
+				Labels:    map[string]string{"resource.host.name": "web01", "otel.scope.name": "scope"},
+			},
+		},
+		{
+			name:   "unknown service",
+			record: &logspb.LogRecord{},
+			want:   LogInput{Source: "unknown_service", Labels: map[string]string{"otel.scope.name": "scope"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := &collogspb.ExportLogsServiceRequest{ResourceLogs: []*logspb.ResourceLogs{{
+				Resource: &resourcepb.Resource{Attributes: test.attributes},
+				ScopeLogs: []*logspb.ScopeLogs{{
+					Scope:      &commonpb.InstrumentationScope{Name: "scope"},
+					LogRecords: []*logspb.LogRecord{test.record},
+				}},
+			}}}
+
+			inputs := LogInputsFromOTLP(request)
+			if len(inputs) != 1 {
+				t.Fatalf("LogInputsFromOTLP() returned %d inputs", len(inputs))
+			}
+			if !reflect.DeepEqual(inputs[0], test.want) {
+				t.Errorf("LogInputsFromOTLP() = %+v, want %+v", inputs[0], test.want)
+			}
+		})
+	}
+}
+
+func TestAnyValueString(t *testing.T) {
+	tests := []struct {
+		name  string
+		value *commonpb.AnyValue
+		want  string
+	}{
+		{name: "nil", want: ""},
+		{name: "string", value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "a \"b\""}}, want: `a "b"`},
+		{name: "bool", value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: true}}, want: "true"},
+		{name: "double", value: &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: 1.5}}, want: "1.5"},
+		{name: "bytes", value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BytesValue{BytesValue: []byte("hi")}}, want: `"aGk="`},
+		{
+			name: "array",
+			value: &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: []*commonpb.AnyValue{
+				{Value: &commonpb.AnyValue_IntValue{IntValue: 1}},
+				{Value: &commonpb.AnyValue_StringValue{StringValue: "two"}},
+			}}}},
+			want: `[1,"two"]`,
+		},
+		{
+			name: "key value list",
+			value: &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: []*commonpb.KeyValue{
+				stringAttribute("user", "alice"),
+			}}}},
+			want: `{"user":"alice"}`,
+		},
+		{name: "empty", value: &commonpb.AnyValue{}, want: "null"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := anyValueString(test.value); got != test.want {
+				t.Errorf("anyValueString() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeOTLPRequest(t *testing.T) {
+	body := `{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"traceId":"5b8efff798038103d269b633813fc60c","body":{"stringValue":"hello"}}]}]}]}`
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte(body))
+	writer.Close()
+
+	tests := []struct {
+		name            string
+		body            []byte
+		contentEncoding string
+		wantErr         bool
+	}{
+		{name: "json", body: []byte(body)},
+		{name: "gzip json", body: compressed.Bytes(), contentEncoding: "gzip"},
+		{name: "malformed json", body: []byte(`{"resourceLogs":`), wantErr: true},
+		{name: "not gzip", body: []byte(body), contentEncoding: "gzip", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := DecodeOTLPRequest(bytes.NewReader(test.body), "application/json", test.contentEncoding)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("DecodeOTLPRequest() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeOTLPRequest() error = %v", err)
+			}
+			inputs := LogInputsFromOTLP(request)
+			if len(inputs) != 1 || inputs[0].Content != "hello" ||
+				inputs[0].Labels["otel.trace_id"] != "5b8efff798038103d269b633813fc60c" {
+				t.Errorf("decoded inputs = %+v", inputs)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package internal
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultParser is the parser of watchers that do not choose one.
+const DefaultParser = "auto"
+
+// Parser extracts the fields of a raw log line, or returns nil when the line
+// is not in its format. Parsers report the event time as an RFC 3339 "time"
+// field and the severity, lower cased, as "severity". The fields are stored
+// next to the raw line, which alone is hashed.
+type Parser func(line string) map[string]string
+
+var (
+	parsersMu sync.RWMutex
+	parsers   = map[string]Parser{
+		DefaultParser:  ParseFields,
+		"none":         func(string) map[string]string { return nil },
+		"json":         parseJSONFields,
+		"logfmt":       parseLogfmtFields,
+		"nginx":        parseCombinedLog,
+		"apache":       parseCombinedLog,
+		"docker":       parseDockerLog,
+		"cri":          parseCRILog,
+		"postgres-csv": parsePostgresCSVLog,
+	}
+)
+
+// RegisterParser adds a parser to the registry, replacing any parser of the
+// same name.
+func RegisterParser(name string, parser Parser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	parsers[name] = parser
+}
+
+// LookupParser returns the registered parser called name, or the default
+// parser when name is empty.
+func LookupParser(name string) (Parser, error) {
+	if name == "" {
+		name = DefaultParser
+	}
+
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	parser, ok := parsers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown parser %q, expected one of %s", name, strings.Join(parserNames(), ", "))
+	}
+	return parser, nil
+}
+
+// QuotedRecords reports whether records of the named parser's format quote
+// fields that may span lines, which a LineAssembler then has to keep together.
+func QuotedRecords(name string) bool {
+	return name == "postgres-csv"
+}
+
+func parserNames() []string {
+	names := make([]string, 0, len(parsers))
+	for name := range parsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NCSA combined log format shared by nginx and Apache:
+// host ident user [time] "request" status bytes "referer" "user-agent"
+var combinedLogPattern = regexp.MustCompile(`^(\S+) (\S+) (\S+) \[([^\]]+)\] "((?:[^"\\]|\\.)*)" (\d{3}) (\d+|-)(?: "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)")?`)
+
+func parseCombinedLog(line string) map[string]string {
+	match := combinedLogPattern.FindStringSubmatch(line)
+	if match == nil {
+		return nil
+	}
+
+	fields := map[string]string{
+		"remote_addr": match[1],
+		"status":      match[6],
+	}
+	setField(fields, "remote_user", nilValue(match[3]))
+	setField(fields, "bytes", nilValue(match[7]))
+	setField(fields, "referer", nilValue(match[8]))
+	setField(fields, "user_agent", nilValue(match[9]))
+
+	if timestamp, err := time.Parse("02/Jan/2006:15:04:05 -0700", match[4]); err == nil {
+		setTimeField(fields, timestamp)
+	}
+
+	// "GET /path HTTP/1.1", though malformed requests are logged as they came
+	request := strings.Fields(match[5])
+	if len(request) == 3 {
+		fields["method"] = request[0]
+		fields["path"] = request[1]
+		fields["protocol"] = request[2]
+	} else {
+		setField(fields, "request", match[5])
+	}
+
+	switch match[6][0] {
+	case '5':
+		fields["severity"] = "error"
+	case '4':
+		fields["severity"] = "warning"
+	default:
+		fields["severity"] = "info"
+	}
+	return fields
+}
+
+// parseDockerLog reads a line of Docker's json-file driver:
+// {"log":"message\n","stream":"stdout","time":"2024-01-01T00:00:00.000000000Z"}
+func parseDockerLog(line string) map[string]string {
+	var record struct {
+		Log    *string `json:"log"`
+		Stream string  `json:"stream"`
+		Time   string  `json:"time"`
+	}
+	if err := json.Unmarshal([]byte(line), &record); err != nil || record.Log == nil {
+		return nil
+	}
+	return containerLogFields(record.Time, record.Stream, *record.Log)
+}
+
+// parseCRILog reads a line of the Kubernetes CRI log format:
+// 2024-01-01T00:00:00.000000000Z stdout F message
+func parseCRILog(line string) map[string]string {
+	parts := strings.SplitN(line, " ", 4)
+	if len(parts) < 3 || (parts[1] != "stdout" && parts[1] != "stderr") || (parts[2] != "F" && parts[2] != "P") {
+		return nil
+	}
+
+	message := ""
+	if len(parts) == 4 {
+		message = parts[3]
+	}
+	fields := containerLogFields(parts[0], parts[1], message)
+	if fields == nil {
+		return nil
+	}
+	// P marks a partial line continued by the next one
+	fields["partial"] = fmt.Sprint(parts[2] == "P")
+	return fields
+}
+
+// containerLogFields also parses the message itself, so that JSON or logfmt
+// written by the container is queryable. Without a level of its own, stderr
+// is taken as an error.
+func containerLogFields(timestamp string, stream string, message string) map[string]string {
+	eventTime, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return nil
+	}
+
+	message = strings.TrimRight(message, "\r\n")
+	fields := ParseFields(message)
+	if fields == nil {
+		fields = map[string]string{}
+	}
+	fields["stream"] = stream
+	fields["message"] = message
+	setTimeField(fields, eventTime)
+
+	if severity := firstField(fields, "severity", "level", "lvl"); severity != "" {
+		fields["severity"] = strings.ToLower(severity)
+	} else if stream == "stderr" {
+		fields["severity"] = "error"
+	} else {
+		fields["severity"] = "info"
+	}
+	return fields
+}
+
+// postgresLocation is the log_timezone of the PostgreSQL server, which
+// resolves the zone abbreviations of its csvlog timestamps.
+var postgresLocation = sync.OnceValue(func() *time.Location {
+	name := getEnv("POSTGRES_LOG_TIMEZONE", "Local")
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("Unknown POSTGRES_LOG_TIMEZONE %q, using UTC: %v", name, err)
+		return time.UTC
+	}
+	return location
+})
+
+// PostgreSQL csvlog columns, in order. Later versions append columns, which
+// are ignored.
+var postgresCSVColumns = []string{
+	"time", "user", "database", "pid", "connection_from", "session_id",
+	"session_line", "command_tag", "session_start", "virtual_transaction_id",
+	"transaction_id", "severity", "sql_state", "message", "detail", "hint",
+	"internal_query", "internal_query_pos", "context", "query", "query_pos",
+	"location", "application_name",
+}
+
+func parsePostgresCSVLog(line string) map[string]string {
+	reader := csv.NewReader(strings.NewReader(line))
+	reader.FieldsPerRecord = -1
+	record, err := reader.Read()
+	if err != nil || len(record) < len(postgresCSVColumns) {
+		return nil
+	}
+
+	timestamp, ok := parsePostgresTime(record[0])
+	if !ok {
+		return nil
+	}
+
+	fields := map[string]string{}
+	for i, column := range postgresCSVColumns {
+		setField(fields, column, record[i])
+	}
+	setTimeField(fields, timestamp)
+	fields["severity"] = strings.ToLower(record[11])
+	return fields
+}
+
+// parsePostgresTime reads a csvlog timestamp, whose zone is a numeric offset
+// when log_timezone has no abbreviation for it.
+func parsePostgresTime(value string) (time.Time, bool) {
+	for _, layout := range []string{"2006-01-02 15:04:05.999 -07:00", "2006-01-02 15:04:05.999 -07"} {
+		if timestamp, err := time.Parse(layout, value); err == nil {
+			return timestamp, true
+		}
+	}
+
+	location := postgresLocation()
+	timestamp, err := time.ParseInLocation("2006-01-02 15:04:05.999 MST", value, location)
+	if err != nil {
+		return time.Time{}, false
+	}
+	// abbreviations the location does not know are parsed with a zero offset
+	zone, offset := timestamp.Zone()
+	if offset == 0 && timestamp.Location() != location && zone != "UTC" && zone != "GMT" {
+		return time.Time{}, false
+	}
+	return timestamp, true
+}
+
+// parsedEventTime returns the event time a parser reported as the "time"
+// field.
+func parsedEventTime(fields map[string]string) (time.Time, bool) {
+	eventTime, err := time.Parse(time.RFC3339Nano, fields["time"])
+	return eventTime, err == nil
+}
+
+func setField(fields map[string]string, key string, value string) {
+	if value != "" {
+		fields[key] = value
+	}
+}
+
+func setTimeField(fields map[string]string, timestamp time.Time) {
+	fields["time"] = timestamp.UTC().Format(time.RFC3339Nano)
+}
+
+func firstField(fields map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if value := fields[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
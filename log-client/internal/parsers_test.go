@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsers(t *testing.T) {
+	postgresLine := `2024-03-01 10:15:30.123 UTC,"app","orders",4242,"10.0.0.5:51234",65e1a2b3.1092,7,"SELECT",` +
+		`2024-03-01 10:00:00 UTC,3/17,0,ERROR,42P01,"relation ""users"" does not exist",,,,,,"SELECT * FROM users",15,,"psql"`
+
+	tests := []struct {
+		parser string
+		line   string
+		want   map[string]string
+	}{
+		{
+			parser: "nginx",
+			line:   `203.0.113.7 - alice [10/Oct/2024:13:55:36 +0200] "GET /index.html HTTP/1.1" 404 512 "https://example.com/" "curl/8.0"`,
+			want: map[string]string{
+				"remote_addr": "203.0.113.7", "remote_user": "alice", "time": "2024-10-10T11:55:36Z",
+				"method": "GET", "path": "/index.html", "protocol": "HTTP/1.1", "status": "404", "bytes": "512",
+				"referer": "https://example.com/", "user_agent": "curl/8.0", "severity": "warning",
+			},
+		},
+		{
+			parser: "apache",
+			line:   `203.0.113.7 - - [10/Oct/2024:13:55:36 +0000] "\x16\x03" 500 -`,
+			want: map[string]string{
+				"remote_addr": "203.0.113.7", "time": "2024-10-10T13:55:36Z", "request": `\x16\x03`,
+				"status": "500", "severity": "error",
+			},
+		},
+		{parser: "nginx", line: "not an access log"},
+		{
+			parser: "docker",
+			line:   `{"log":"level=WARN msg=slow\n","stream":"stdout","time":"2024-01-01T00:00:00.5Z"}`,
+			want: map[string]string{
+				"level": "WARN", "msg": "slow", "message": "level=WARN msg=slow", "stream": "stdout",
+				"time": "2024-01-01T00:00:00.5Z", "severity": "warn",
+			},
+		},
+		{
+			parser: "docker",
+			line:   `{"log":"panic: oops\n","stream":"stderr","time":"2024-01-01T00:00:00Z"}`,
+			want: map[string]string{
+				"message": "panic: oops", "stream": "stderr", "time": "2024-01-01T00:00:00Z", "severity": "error",
+			},
+		},
+		{parser: "docker", line: `{"stream":"stdout","time":"2024-01-01T00:00:00Z"}`},
+		{parser: "docker", line: `{"log":"x","stream":"stdout","time":"yesterday"}`},
+		{
+			parser: "cri",
+			line:   "2024-01-01T00:00:00.000000001Z stdout P first half",
+			want: map[string]string{
+				"message": "first half", "stream": "stdout", "time": "2024-01-01T00:00:00.000000001Z",
+				"severity": "info", "partial": "true",
+			},
+		},
+		{
+			parser: "cri",
+			line:   "2024-01-01T00:00:00Z stderr F",
+			want: map[string]string{
+				"message": "", "stream": "stderr", "time": "2024-01-01T00:00:00Z", "severity": "error", "partial": "false",
+			},
+		},
+		{parser: "cri", line: "2024-01-01T00:00:00Z stdin F message"},
+		{
+			parser: "postgres-csv",
+			line:   postgresLine,
+			want: map[string]string{
+				"time": "2024-03-01T10:15:30.123Z", "user": "app", "database": "orders", "pid": "4242",
+				"connection_from": "10.0.0.5:51234", "session_id": "65e1a2b3.1092", "session_line": "7",
+				"command_tag": "SELECT", "session_start": "2024-03-01 10:00:00 UTC", "virtual_transaction_id": "3/17",
+				"transaction_id": "0", "severity": "error", "sql_state": "42P01",
+				"message": `relation "users" does not exist`, "query": "SELECT * FROM users", "query_pos": "15",
+				"application_name": "psql",
+			},
+		},
+		{
+			parser: "postgres-csv",
+			line:   strings.Replace(postgresLine, `"relation ""users"" does not exist"`, "\"syntax error\nat line 2\"", 1),
+			want: map[string]string{
+				"time": "2024-03-01T10:15:30.123Z", "user": "app", "database": "orders", "pid": "4242",
+				"connection_from": "10.0.0.5:51234", "session_id": "65e1a2b3.1092", "session_line": "7",
+				"command_tag": "SELECT", "session_start": "2024-03-01 10:00:00 UTC", "virtual_transaction_id": "3/17",
+				"transaction_id": "0", "severity": "error", "sql_state": "42P01",
+				"message": "syntax error\nat line 2", "query": "SELECT * FROM users", "query_pos": "15",
+				"application_name": "psql",
+			},
+		},
+		{parser: "postgres-csv", line: "2024-03-01 10:15:30.123 UTC,app,orders"},
+		{parser: "none", line: `{"level":"info"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.parser, func(t *testing.T) {
+			parser, err := LookupParser(test.parser)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := parser(test.line); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parser(%q) = %v, want %v", test.line, got, test.want)
+			}
+		})
+	}
+}
+
+func TestLookupParser(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: ""},
+		{name: "auto"},
+		{name: "postgres-csv"},
+		{name: "syslog", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parser, err := LookupParser(test.name)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("LookupParser(%q) error = %v, want error %v", test.name, err, test.wantErr)
+			}
+			if !test.wantErr && parser == nil {
+				t.Errorf("LookupParser(%q) returned no parser", test.name)
+			}
+		})
+	}
+}
+
+func TestParsePostgresTime(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+	location := postgresLocation
+	postgresLocation = func() *time.Location { return newYork }
+	t.Cleanup(func() { postgresLocation = location })
+
+	tests := []struct {
+		value string
+		want  string
+		ok    bool
+	}{
+		{value: "2024-03-01 10:15:30.123 UTC", want: "2024-03-01T10:15:30.123Z", ok: true},
+		{value: "2024-03-01 10:15:30 GMT", want: "2024-03-01T10:15:30Z", ok: true},
+		{value: "2024-01-15 10:15:30 EST", want: "2024-01-15T15:15:30Z", ok: true},
+		{value: "2024-07-15 10:15:30 EDT", want: "2024-07-15T14:15:30Z", ok: true},
+		{value: "2024-03-01 10:15:30.5 +05:30", want: "2024-03-01T04:45:30.5Z", ok: true},
+		{value: "2024-03-01 10:15:30 -03", want: "2024-03-01T13:15:30Z", ok: true},
+		{value: "2024-03-01 10:15:30 CET"},
+		{value: "2024-03-01T10:15:30Z"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, ok := parsePostgresTime(test.value)
+			if ok != test.ok {
+				t.Fatalf("parsePostgresTime(%q) ok = %v, want %v", test.value, ok, test.ok)
+			}
+			if ok && got.UTC().Format(time.RFC3339Nano) != test.want {
+				t.Errorf("parsePostgresTime(%q) = %v, want %s", test.value, got.UTC(), test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type detector struct {
+	pattern string
+	// validate, if set, rejects matches that only look like the value
+	validate func(string) bool
+}
+
+// builtinDetectors are the built-in PII detectors. When a pattern has a group
+// named value, only that group is redacted.
+var builtinDetectors = map[string]detector{
+	"email":   {pattern: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`},
+	"card":    {pattern: `\b(?:\d[ -]?){12,18}\d\b`, validate: luhnValid},
+	"jwt":     {pattern: `\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`},
+	"bearer":  {pattern: `(?i)\bbearer\s+(?P<value>[A-Za-z0-9._~+/-]+=*)`},
+	"aws-key": {pattern: `\b(?:AKIA|ASIA)[A-Z0-9]{16}\b`},
+	"secret":  {pattern: `(?i)\b(?:password|passwd|pwd|secret|token|api[_-]?key)"?\s*[=:]\s*"?(?P<value>[^\s",;]+)`},
+}
+
+// RedactionRule redacts every match of Pattern, reported under Name.
+type RedactionRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
+
+// RedactionConfig selects built-in detectors and custom rules. With an
+// HMACKey, each redacted value is replaced by a keyed hash of it so that
+// events remain correlatable without revealing the value.
+type RedactionConfig struct {
+	Detectors []string        `json:"detectors,omitempty"`
+	Rules     []RedactionRule `json:"rules,omitempty"`
+	HMACKey   string          `json:"-"`
+}
+
+// RedactionConfigFromEnv reads REDACTION_DETECTORS (comma separated, or
+// "all"), the JSON rule list in REDACTION_RULES_FILE and REDACTION_HMAC_KEY.
+func RedactionConfigFromEnv() (RedactionConfig, error) {
+	config := RedactionConfig{
+		Detectors: getEnvList("REDACTION_DETECTORS"),
+		HMACKey:   getEnv("REDACTION_HMAC_KEY", ""),
+	}
+
+	if path := getEnv("REDACTION_RULES_FILE", ""); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return config, fmt.Errorf("failed to read redaction rules: %w", err)
+		}
+		if err := json.Unmarshal(data, &config.Rules); err != nil {
+			return config, fmt.Errorf("failed to parse redaction rules: %w", err)
+		}
+	}
+	return config, nil
+}
+
+type redactionRule struct {
+	name     string
+	pattern  *regexp.Regexp
+	value    int
+	validate func(string) bool
+}
+
+// Redactor replaces sensitive values in log lines before they are stored.
+// A nil Redactor leaves lines as they are.
+type Redactor struct {
+	rules   []redactionRule
+	key     []byte
+	version string
+}
+
+// NewRedactor compiles the rules of config, returning nil when there are none.
+func NewRedactor(config RedactionConfig) (*Redactor, error) {
+	detectors := config.Detectors
+	if len(detectors) == 1 && detectors[0] == "all" {
+		detectors = make([]string, 0, len(builtinDetectors))
+		for name := range builtinDetectors {
+			detectors = append(detectors, name)
+		}
+		sort.Strings(detectors)
+	}
+
+	rules := make([]RedactionRule, 0, len(detectors)+len(config.Rules))
+	validators := make([]func(string) bool, 0, cap(rules))
+	for _, name := range detectors {
+		detector, ok := builtinDetectors[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown redaction detector %q", name)
+		}
+		rules = append(rules, RedactionRule{Name: name, Pattern: detector.pattern})
+		validators = append(validators, detector.validate)
+	}
+	for _, rule := range config.Rules {
+		rules = append(rules, rule)
+		validators = append(validators, nil)
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	r := &Redactor{key: []byte(config.HMACKey)}
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("redaction rule %q has no name", rule.Pattern)
+		}
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern of redaction rule %s: %w", rule.Name, err)
+		}
+		r.rules = append(r.rules, redactionRule{
+			name:     rule.Name,
+			pattern:  pattern,
+			value:    pattern.SubexpIndex("value"),
+			validate: validators[i],
+		})
+	}
+
+	// the version identifies the rule set, so entries record what they were
+	// redacted with
+	fingerprint, err := json.Marshal(struct {
+		Rules []RedactionRule
+		HMAC  bool
+	}{rules, len(r.key) > 0})
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(fingerprint)
+	r.version = hex.EncodeToString(sum[:])[:12]
+
+	return r, nil
+}
+
+// Version identifies the rule set, empty for a nil Redactor.
+func (r *Redactor) Version() string {
+	if r == nil {
+		return ""
+	}
+	return r.version
+}
+
+// Redact replaces every match of the rules in s by [REDACTED:<rule>], or
+// [REDACTED:<rule>:<hmac>] when a key is configured.
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+
+	for _, rule := range r.rules {
+		matches := rule.pattern.FindAllStringSubmatchIndex(s, -1)
+		if matches == nil {
+			continue
+		}
+
+		var redacted strings.Builder
+		last := 0
+		for _, match := range matches {
+			start, end := match[0], match[1]
+			if rule.value > 0 {
+				start, end = match[2*rule.value], match[2*rule.value+1]
+			}
+			if start < 0 || (rule.validate != nil && !rule.validate(s[start:end])) {
+				continue
+			}
+
+			redacted.WriteString(s[last:start])
+			redacted.WriteString(r.replacement(rule.name, s[start:end]))
+			last = end
+		}
+		redacted.WriteString(s[last:])
+		s = redacted.String()
+	}
+	return s
+}
+
+// RedactLabels redacts the values of labels into a new map.
+func (r *Redactor) RedactLabels(labels map[string]string) map[string]string {
+	if r == nil || labels == nil {
+		return labels
+	}
+
+	redacted := make(map[string]string, len(labels))
+	for key, value := range labels {
+		redacted[key] = r.Redact(value)
+	}
+	return redacted
+}
+
+func (r *Redactor) replacement(rule string, value string) string {
+	if len(r.key) == 0 {
+		return "[REDACTED:" + rule + "]"
+	}
+
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(value))
+	return "[REDACTED:" + rule + ":" + hex.EncodeToString(mac.Sum(nil))[:16] + "]"
+}
+
+// luhnValid tells card numbers from other long digit runs.
+func luhnValid(number string) bool {
+	sum := 0
+	double := false
+	digits := 0
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		digit := int(c - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+		digits++
+	}
+	return digits >= 13 && sum%10 == 0
+}
+
+var defaultRedactor = struct {
+	once     sync.Once
+	redactor *Redactor
+	err      error
+}{}
+
+// DefaultRedactor returns the redactor configured by the environment, which
+// applies wherever no other one is chosen.
+func DefaultRedactor() (*Redactor, error) {
+	defaultRedactor.once.Do(func() {
+		config, err := RedactionConfigFromEnv()
+		if err != nil {
+			defaultRedactor.err = err
+			return
+		}
+		defaultRedactor.redactor, defaultRedactor.err = NewRedactor(config)
+	})
+	return defaultRedactor.redactor, defaultRedactor.err
+}
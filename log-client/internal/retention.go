@@ -0,0 +1,507 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultRetentionPolicy is the policy key that applies to sources without a
+// policy of their own.
+const DefaultRetentionPolicy = "*"
+
+// ArchiveSegment is a compressed batch of entries of one source moved out of
+// log_entries. Key is the SHA-256 of the stored segment, which addresses it
+// in the archive store.
+type ArchiveSegment struct {
+	ID              uint   `gorm:"primaryKey"`
+	Key             string `gorm:"uniqueIndex"`
+	Source          string `gorm:"index"`
+	Entries         int
+	FirstEntryID    uint
+	LastEntryID     uint
+	OldestTimestamp time.Time
+	NewestTimestamp time.Time
+	Size            int64
+	CreatedAt       time.Time
+}
+
+// ArchivedEntry locates an archived entry, so that anchors keep resolving.
+// DataKeyID is kept so that shredding can check the entries of a key, and the
+// timestamp and parsed fields so that reads can still filter on them. Like in
+// segments, the fields of encrypted entries are left out.
+type ArchivedEntry struct {
+	EntryID   uint              `gorm:"primaryKey;autoIncrement:false"`
+	SegmentID uint              `gorm:"index"`
+	DataKeyID *string           `gorm:"index"`
+	Timestamp *time.Time        `gorm:"index"`
+	Fields    map[string]string `gorm:"type:jsonb;serializer:json;index:idx_archived_entries_fields,type:gin"`
+}
+
+// RetentionConfig maps sources to how long their entries stay in the
+// database, with DefaultRetentionPolicy covering the others. Only anchored
+// entries are archived.
+type RetentionConfig struct {
+	Policies    map[string]time.Duration
+	Interval    time.Duration
+	SegmentSize int
+}
+
+// RetentionConfigFromEnv reads RETENTION_POLICIES as source=age pairs, such
+// as "client1=30d,*=90d", along with RETENTION_INTERVAL and
+// RETENTION_SEGMENT_SIZE.
+func RetentionConfigFromEnv() (RetentionConfig, error) {
+	config := RetentionConfig{
+		Policies:    map[string]time.Duration{},
+		Interval:    getEnvDuration("RETENTION_INTERVAL", RetentionInterval),
+		SegmentSize: getEnvInt("RETENTION_SEGMENT_SIZE", ArchiveSegmentSize),
+	}
+	for _, policy := range getEnvList("RETENTION_POLICIES") {
+		source, age, ok := strings.Cut(policy, "=")
+		if !ok {
+			return config, fmt.Errorf("invalid retention policy %q, expected source=age", policy)
+		}
+		duration, err := parseRetentionAge(age)
+		if err != nil {
+			return config, fmt.Errorf("invalid age of retention policy %q: %w", policy, err)
+		}
+		config.Policies[strings.TrimSpace(source)] = duration
+	}
+	return config, nil
+}
+
+// parseRetentionAge accepts Go durations as well as whole days, like "90d".
+func parseRetentionAge(age string) (time.Duration, error) {
+	age = strings.TrimSpace(age)
+	if days, ok := strings.CutSuffix(age, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(age)
+}
+
+// policyFor returns the retention age of a source and whether it has one.
+func (c RetentionConfig) policyFor(source string) (time.Duration, bool) {
+	if age, ok := c.Policies[source]; ok {
+		return age, true
+	}
+	age, ok := c.Policies[DefaultRetentionPolicy]
+	return age, ok
+}
+
+var retentionRun struct {
+	sync.Mutex
+	lastRunAt *time.Time
+	lastError string
+	archived  int
+}
+
+// RunRetention archives entries past their retention age into store until
+// ctx is cancelled.
+func RunRetention(ctx context.Context, config RetentionConfig, store ArchiveStore) {
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+
+	for {
+		archived, err := archiveOnce(ctx, config, store)
+		if err != nil {
+			log.Println("retention run failed:", err)
+		}
+
+		now := time.Now()
+		retentionRun.Lock()
+		retentionRun.lastRunAt = &now
+		retentionRun.archived = archived
+		retentionRun.lastError = ""
+		if err != nil {
+			retentionRun.lastError = err.Error()
+		}
+		retentionRun.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// archiveOnce archives every expired entry, a segment at a time, and returns
+// how many it archived.
+func archiveOnce(ctx context.Context, config RetentionConfig, store ArchiveStore) (int, error) {
+	db, err := InitDB()
+	if err != nil {
+		return 0, err
+	}
+
+	var sources []string
+	if err := db.Model(&LogEntry{}).Distinct("source").Pluck("source", &sources).Error; err != nil {
+		return 0, fmt.Errorf("failed to list sources: %w", err)
+	}
+
+	archived := 0
+	for _, source := range sources {
+		age, ok := config.policyFor(source)
+		if !ok {
+			continue
+		}
+		cutoff := time.Now().Add(-age)
+
+		// held entries stay in the database until their holds end
+		holds, err := activeHoldsFor(db, source)
+		if err != nil {
+			return archived, err
+		}
+
+		for ctx.Err() == nil {
+			// entries are only archived once their anchor proves them
+			query := db.Where("source = ? AND timestamp < ?", source, cutoff).
+				Where("log_entries.id IN (?)", db.Model(&Anchor{}).Select("entry_id"))
+
+			var entries []LogEntry
+			err := excludeHeld(db, query, holds).
+				Order("id").
+				Limit(config.SegmentSize).
+				Find(&entries).Error
+			if err != nil {
+				return archived, fmt.Errorf("failed to load expired entries of %s: %w", source, err)
+			}
+			if len(entries) == 0 {
+				break
+			}
+
+			if err := archiveSegment(ctx, store, source, entries); err != nil {
+				return archived, err
+			}
+			archived += len(entries)
+		}
+	}
+	return archived, nil
+}
+
+// archiveSegment stores entries as one segment, then replaces their rows by
+// pointers to it. A segment stored by a failed run is overwritten by the
+// identical segment of the next one.
+func archiveSegment(ctx context.Context, store ArchiveStore, source string, entries []LogEntry) error {
+	data, err := encodeSegment(entries)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	key := hex.EncodeToString(sum[:])
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, strconv.FormatUint(uint64(entry.ID), 10))
+	}
+
+	if err := store.Put(ctx, segmentPath(key), data); err != nil {
+		return fmt.Errorf("failed to store archive segment: %w", err)
+	}
+
+	// archive_log_entries records the segment and deletes the rows as the
+	// owner of the tables, after checking that they are anchored and unheld
+	err = maintain(func(tx *gorm.DB) error {
+		var segmentID uint
+		return tx.Raw("SELECT archive_log_entries(?, ?, ?, ?::bigint[])",
+			key, source, int64(len(data)), "{"+strings.Join(ids, ",")+"}").Scan(&segmentID).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record archive segment %s: %w", key, err)
+	}
+	return nil
+}
+
+func segmentPath(key string) string {
+	return "segments/" + key + ".jsonl.gz"
+}
+
+// encodeSegment writes entries as gzip compressed JSON lines. The parsed
+// fields of encrypted entries are left out, so that shredding their data key
+// leaves nothing readable behind.
+func encodeSegment(entries []LogEntry) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range entries {
+		if entry.DataKeyID != nil {
+			entry.Fields = nil
+		}
+		if err := encoder.Encode(entry); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// archiveCache keeps the most recently read segments decoded, since entries
+// of a segment tend to be read together.
+var archiveCache struct {
+	sync.Mutex
+	order    []uint
+	segments map[uint]map[uint]LogEntry
+}
+
+// loadArchivedEntry reads an entry moved to the archive. It returns
+// gorm.ErrRecordNotFound when the entry was never archived.
+func loadArchivedEntry(db *gorm.DB, id uint) (*LogEntry, error) {
+	var archived ArchivedEntry
+	if err := db.First(&archived, "entry_id = ?", id).Error; err != nil {
+		return nil, err
+	}
+
+	entries, err := loadSegment(db, archived.SegmentID)
+	if err != nil {
+		return nil, err
+	}
+	entry, ok := entries[id]
+	if !ok {
+		return nil, fmt.Errorf("entry %d is missing from archive segment %d", id, archived.SegmentID)
+	}
+	return &entry, nil
+}
+
+// loadArchivedEntries reads the archived ones of the given entries, a
+// segment at a time, leaving out those that were never archived.
+func loadArchivedEntries(db *gorm.DB, ids []uint) (map[uint]LogEntry, error) {
+	var archived []ArchivedEntry
+	if err := db.Where("entry_id IN ?", ids).Order("segment_id").Find(&archived).Error; err != nil {
+		return nil, fmt.Errorf("failed to load archived entries: %w", err)
+	}
+
+	entries := make(map[uint]LogEntry, len(archived))
+	for _, a := range archived {
+		segment, err := loadSegment(db, a.SegmentID)
+		if err != nil {
+			return nil, err
+		}
+		entry, ok := segment[a.EntryID]
+		if !ok {
+			return nil, fmt.Errorf("entry %d is missing from archive segment %d", a.EntryID, a.SegmentID)
+		}
+		entries[a.EntryID] = entry
+	}
+	return entries, nil
+}
+
+func loadSegment(db *gorm.DB, segmentID uint) (map[uint]LogEntry, error) {
+	archiveCache.Lock()
+	entries, ok := archiveCache.segments[segmentID]
+	archiveCache.Unlock()
+	if ok {
+		return entries, nil
+	}
+
+	store, err := DefaultArchiveStore()
+	if err != nil {
+		return nil, err
+	}
+	if store == nil {
+		return nil, fmt.Errorf("entries are archived but no archive store is configured")
+	}
+
+	var segment ArchiveSegment
+	if err := db.First(&segment, segmentID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load archive segment %d: %w", segmentID, err)
+	}
+	data, err := store.Get(context.Background(), segmentPath(segment.Key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch archive segment %s: %w", segment.Key, err)
+	}
+	// the key is the hash of the segment, so a replaced segment is detected here
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != segment.Key {
+		raiseAlert(Alert{
+			Kind:    AlertTampered,
+			Source:  segment.Source,
+			Message: fmt.Sprintf("archive segment %s does not match its hash", segment.Key),
+		})
+		return nil, fmt.Errorf("archive segment %s does not match its hash", segment.Key)
+	}
+
+	entries, err = decodeSegment(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode archive segment %s: %w", segment.Key, err)
+	}
+
+	archiveCache.Lock()
+	defer archiveCache.Unlock()
+	if archiveCache.segments == nil {
+		archiveCache.segments = map[uint]map[uint]LogEntry{}
+	}
+	if len(archiveCache.order) >= ArchiveCacheSegments {
+		delete(archiveCache.segments, archiveCache.order[0])
+		archiveCache.order = archiveCache.order[1:]
+	}
+	archiveCache.segments[segmentID] = entries
+	archiveCache.order = append(archiveCache.order, segmentID)
+	return entries, nil
+}
+
+func decodeSegment(data []byte) (map[uint]LogEntry, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	entries := map[uint]LogEntry{}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), IngestBodyLimit)
+	for scanner.Scan() {
+		var entry LogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+		entries[entry.ID] = entry
+	}
+	return entries, scanner.Err()
+}
+
+var defaultArchiveStore = struct {
+	once  sync.Once
+	store ArchiveStore
+	err   error
+}{}
+
+// DefaultArchiveStore returns the archive store configured by the environment,
+// or nil when there is none.
+func DefaultArchiveStore() (ArchiveStore, error) {
+	defaultArchiveStore.once.Do(func() {
+		defaultArchiveStore.store, defaultArchiveStore.err = NewArchiveStore(ArchiveStoreConfigFromEnv())
+	})
+	return defaultArchiveStore.store, defaultArchiveStore.err
+}
+
+// ArchiveSourceState summarizes the archive of one source.
+type ArchiveSourceState struct {
+	Source          string     `json:"source"`
+	Retention       string     `json:"retention,omitempty"`
+	LiveEntries     int64      `json:"liveEntries"`
+	ArchivedEntries int64      `json:"archivedEntries"`
+	Segments        int64      `json:"segments"`
+	Bytes           int64      `json:"bytes"`
+	ArchivedUntil   *time.Time `json:"archivedUntil"`
+}
+
+// ArchiveState reports the archive store, the last retention run and the
+// archive of every source.
+type ArchiveState struct {
+	Store        string               `json:"store"`
+	LastRunAt    *time.Time           `json:"lastRunAt"`
+	LastArchived int                  `json:"lastArchived"`
+	LastError    string               `json:"lastError,omitempty"`
+	Sources      []ArchiveSourceState `json:"sources"`
+}
+
+// GetArchiveState summarizes the archive per source under the given policies.
+func GetArchiveState(config RetentionConfig) (*ArchiveState, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+
+	state := ArchiveState{Sources: []ArchiveSourceState{}}
+	store, err := DefaultArchiveStore()
+	if err != nil {
+		return nil, err
+	}
+	if store != nil {
+		state.Store = store.String()
+	}
+
+	retentionRun.Lock()
+	state.LastRunAt = retentionRun.lastRunAt
+	state.LastArchived = retentionRun.archived
+	state.LastError = retentionRun.lastError
+	retentionRun.Unlock()
+
+	bySource := map[string]*ArchiveSourceState{}
+	sourceState := func(source string) *ArchiveSourceState {
+		if s, ok := bySource[source]; ok {
+			return s
+		}
+		s := &ArchiveSourceState{Source: source}
+		if age, ok := config.policyFor(source); ok {
+			s.Retention = age.String()
+		}
+		bySource[source] = s
+		return s
+	}
+
+	var live []struct {
+		Source string
+		Count  int64
+	}
+	if err := db.Model(&LogEntry{}).Select("source, count(*) AS count").Group("source").Scan(&live).Error; err != nil {
+		return nil, fmt.Errorf("failed to count live entries: %w", err)
+	}
+	for _, l := range live {
+		sourceState(l.Source).LiveEntries = l.Count
+	}
+
+	var archived []struct {
+		Source   string
+		Segments int64
+		Entries  int64
+		Bytes    int64
+		Newest   time.Time
+	}
+	err = db.Model(&ArchiveSegment{}).
+		Select("source, count(*) AS segments, sum(entries) AS entries, sum(size) AS bytes, max(newest_timestamp) AS newest").
+		Group("source").
+		Scan(&archived).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize archive segments: %w", err)
+	}
+	for _, a := range archived {
+		s := sourceState(a.Source)
+		s.Segments = a.Segments
+		s.ArchivedEntries = a.Entries
+		s.Bytes = a.Bytes
+		newest := a.Newest
+		s.ArchivedUntil = &newest
+	}
+
+	for _, s := range bySource {
+		state.Sources = append(state.Sources, *s)
+	}
+	sort.Slice(state.Sources, func(i, j int) bool { return state.Sources[i].Source < state.Sources[j].Source })
+	return &state, nil
+}
+
+// ListArchiveSegments returns the segments of a source, or of every source
+// when source is empty, oldest first.
+func ListArchiveSegments(source string) ([]ArchiveSegment, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+
+	query := db.Order("id")
+	if source != "" {
+		query = query.Where("source = ?", source)
+	}
+	var segments []ArchiveSegment
+	if err := query.Find(&segments).Error; err != nil {
+		return nil, fmt.Errorf("failed to list archive segments: %w", err)
+	}
+	return segments, nil
+}
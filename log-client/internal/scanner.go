@@ -0,0 +1,239 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	IntegrityValid    = "valid"
+	IntegrityTampered = "tampered"
+	IntegrityMissing  = "missing"
+	// IntegrityError marks entries that could not be read, e.g. while the
+	// archive store was unreachable. They are verified again on every pass.
+	IntegrityError = "error"
+)
+
+// IntegrityStatus is the latest verification result of an anchored entry.
+type IntegrityStatus struct {
+	AnchorID       uint      `gorm:"primaryKey;autoIncrement:false"`
+	LogID          string    `gorm:"index"`
+	EntryID        uint      `gorm:"index"`
+	Source         string    `gorm:"index"`
+	Result         string    `gorm:"index"`
+	LastVerifiedAt time.Time `gorm:"index"`
+}
+
+// ScannerCheckpoint records how far the incremental scan has progressed.
+type ScannerCheckpoint struct {
+	Name         string `gorm:"primaryKey"`
+	LastAnchorID uint
+	UpdatedAt    time.Time
+}
+
+// ScannerConfig controls how often and how much the integrity scanner verifies.
+type ScannerConfig struct {
+	Interval      time.Duration
+	BatchSize     int
+	ReverifyAfter time.Duration
+}
+
+// ScannerConfigFromEnv reads the scanner configuration from SCANNER_* environment variables.
+func ScannerConfigFromEnv() ScannerConfig {
+	return ScannerConfig{
+		Interval:      getEnvDuration("SCANNER_INTERVAL", time.Minute),
+		BatchSize:     getEnvInt("SCANNER_BATCH_SIZE", 500),
+		ReverifyAfter: getEnvDuration("SCANNER_REVERIFY_AFTER", 24*time.Hour),
+	}
+}
+
+// IntegritySummary counts entries by their latest verification result.
+type IntegritySummary struct {
+	Results        map[string]int64 `json:"results"`
+	Unverified     int64            `json:"unverified"`
+	LastAnchorID   uint             `json:"lastAnchorId"`
+	OldestVerified *time.Time       `json:"oldestVerified"`
+}
+
+const scannerCheckpointName = "integrity"
+
+// RunIntegrityScanner verifies new anchors from the persisted checkpoint and
+// re-verifies older ones on rotation until ctx is cancelled. Entries are
+// verified against their assets on the ledger, since the anchor index is
+// written by the gateway's own login.
+func RunIntegrityScanner(ctx context.Context, connection *Connection, config ScannerConfig) {
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := scanOnce(ctx, connection, config); err != nil {
+			log.Println("integrity scan failed:", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func scanOnce(ctx context.Context, connection *Connection, config ScannerConfig) error {
+	db, err := InitDB()
+	if err != nil {
+		return err
+	}
+
+	checkpoint := ScannerCheckpoint{Name: scannerCheckpointName}
+	if err := db.FirstOrInit(&checkpoint, ScannerCheckpoint{Name: scannerCheckpointName}).Error; err != nil {
+		return fmt.Errorf("failed to load scanner checkpoint: %w", err)
+	}
+
+	// incremental pass over anchors indexed since the last scan
+	var anchors []Anchor
+	if err := db.Where("id > ?", checkpoint.LastAnchorID).Order("id").Limit(config.BatchSize).Find(&anchors).Error; err != nil {
+		return fmt.Errorf("failed to load anchors: %w", err)
+	}
+	if err := verifyAnchors(ctx, connection, db, anchors); err != nil {
+		return err
+	}
+	if len(anchors) > 0 {
+		checkpoint.LastAnchorID = anchors[len(anchors)-1].ID
+		if err := db.Save(&checkpoint).Error; err != nil {
+			return fmt.Errorf("failed to save scanner checkpoint: %w", err)
+		}
+	}
+
+	// rotation pass over the entries verified longest ago
+	var stale []Anchor
+	err = db.Joins("JOIN integrity_statuses ON integrity_statuses.anchor_id = anchors.id").
+		Where("integrity_statuses.last_verified_at < ? OR integrity_statuses.result = ?",
+			time.Now().Add(-config.ReverifyAfter), IntegrityError).
+		Order("integrity_statuses.last_verified_at").
+		Limit(config.BatchSize).
+		Find(&stale).Error
+	if err != nil {
+		return fmt.Errorf("failed to load stale anchors: %w", err)
+	}
+	return verifyAnchors(ctx, connection, db, stale)
+}
+
+// verifyAnchors records the result of verifying the entries of anchors
+// against their assets, which also decide the entry an anchor stands for. The
+// pass fails while the ledger cannot be read, so that the anchors are
+// verified again on the next one.
+func verifyAnchors(ctx context.Context, connection *Connection, db *gorm.DB, anchors []Anchor) error {
+	if len(anchors) == 0 {
+		return nil
+	}
+
+	anchors, err := ChainAnchors(ctx, connection, anchors)
+	if err != nil {
+		return err
+	}
+	results, err := VerifyLogEntries(anchors)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	statuses := make([]IntegrityStatus, 0, len(anchors))
+	for i, anchor := range anchors {
+		status := IntegrityStatus{
+			AnchorID:       anchor.ID,
+			LogID:          anchor.LogID,
+			EntryID:        anchor.EntryID,
+			Source:         anchor.Source,
+			LastVerifiedAt: now,
+		}
+
+		switch {
+		case errors.Is(results[i].Err, ErrLogEntryMissing):
+			status.Result = IntegrityMissing
+		case results[i].Err != nil:
+			log.Printf("Failed to verify log entry %d: %v", anchor.EntryID, results[i].Err)
+			status.Result = IntegrityError
+		case results[i].Entry.IsValid:
+			status.Result = IntegrityValid
+		default:
+			status.Result = IntegrityTampered
+		}
+		statuses = append(statuses, status)
+	}
+
+	err = db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&statuses).Error
+	if err != nil {
+		return fmt.Errorf("failed to record integrity status: %w", err)
+	}
+	return nil
+}
+
+// LoadIntegrityStatuses returns the latest verification result for each of the given entries.
+func LoadIntegrityStatuses(entryIDs []uint) (map[uint]IntegrityStatus, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []IntegrityStatus
+	if err := db.Where("entry_id IN ?", entryIDs).Find(&statuses).Error; err != nil {
+		return nil, fmt.Errorf("failed to load integrity status: %w", err)
+	}
+
+	byEntry := make(map[uint]IntegrityStatus, len(statuses))
+	for _, status := range statuses {
+		byEntry[status.EntryID] = status
+	}
+	return byEntry, nil
+}
+
+// GetIntegritySummary reports scanner progress and result counts.
+func GetIntegritySummary() (*IntegritySummary, error) {
+	db, err := InitDB()
+	if err != nil {
+		return nil, err
+	}
+
+	summary := IntegritySummary{Results: map[string]int64{}}
+
+	var counts []struct {
+		Result string
+		Count  int64
+	}
+	if err := db.Model(&IntegrityStatus{}).Select("result, count(*) AS count").Group("result").Scan(&counts).Error; err != nil {
+		return nil, fmt.Errorf("failed to count integrity status: %w", err)
+	}
+	var verified int64
+	for _, c := range counts {
+		summary.Results[c.Result] = c.Count
+		verified += c.Count
+	}
+
+	var anchors int64
+	if err := db.Model(&Anchor{}).Count(&anchors).Error; err != nil {
+		return nil, err
+	}
+	summary.Unverified = anchors - verified
+
+	var checkpoint ScannerCheckpoint
+	if err := db.FirstOrInit(&checkpoint, ScannerCheckpoint{Name: scannerCheckpointName}).Error; err != nil {
+		return nil, err
+	}
+	summary.LastAnchorID = checkpoint.LastAnchorID
+
+	var oldest IntegrityStatus
+	if err := db.Order("last_verified_at").Limit(1).Find(&oldest).Error; err != nil {
+		return nil, err
+	}
+	if !oldest.LastVerifiedAt.IsZero() {
+		summary.OldestVerified = &oldest.LastVerifiedAt
+	}
+
+	return &summary, nil
+}
@@ -0,0 +1,21 @@
+package internal
+
+import "sync/atomic"
+
+// pendingAnchors counts entries stored off-chain whose ledger commit is still outstanding.
+var pendingAnchors atomic.Int64
+
+func spoolAdd() {
+	pendingAnchors.Add(1)
+	spoolDepth.Inc()
+}
+
+func spoolDone() {
+	pendingAnchors.Add(-1)
+	spoolDepth.Dec()
+}
+
+// SpoolDepth returns the number of entries waiting for their ledger commit.
+func SpoolDepth() int64 {
+	return pendingAnchors.Load()
+}
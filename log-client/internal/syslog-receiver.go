@@ -0,0 +1,286 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	errFrameTooLong = errors.New("syslog frame exceeds the maximum message size")
+	errInvalidFrame = errors.New("invalid syslog frame length")
+)
+
+// maxFrameLengthDigits bounds the length field of an octet counted frame.
+const maxFrameLengthDigits = 10
+
+// SyslogConfig selects the listeners of the syslog receiver. Empty addresses
+// are not served.
+type SyslogConfig struct {
+	UDPAddr     string
+	TCPAddr     string
+	TLSAddr     string
+	TLSCertPath string
+	TLSKeyPath  string
+}
+
+// SyslogConfigFromEnv reads the receiver settings from SYSLOG_* variables.
+func SyslogConfigFromEnv() SyslogConfig {
+	return SyslogConfig{
+		UDPAddr:     getEnv("SYSLOG_UDP_ADDR", ""),
+		TCPAddr:     getEnv("SYSLOG_TCP_ADDR", ""),
+		TLSAddr:     getEnv("SYSLOG_TLS_ADDR", ""),
+		TLSCertPath: getEnv("SYSLOG_TLS_CERT", ""),
+		TLSKeyPath:  getEnv("SYSLOG_TLS_KEY", ""),
+	}
+}
+
+// Enabled reports whether any listener is configured.
+func (c SyslogConfig) Enabled() bool {
+	return c.UDPAddr != "" || c.TCPAddr != "" || c.TLSAddr != ""
+}
+
+// RunSyslogReceiver accepts syslog messages on the configured listeners and
+// anchors each one through writer until ctx is cancelled.
+func RunSyslogReceiver(ctx context.Context, config SyslogConfig, writer *Writer) error {
+	receiver := &syslogReceiver{ctx: ctx, writer: writer, queue: make(chan syslogPacket, SyslogQueueSize)}
+
+	var listeners []io.Closer
+	closeAll := func() {
+		for _, listener := range listeners {
+			_ = listener.Close()
+		}
+	}
+
+	if config.UDPAddr != "" {
+		conn, err := net.ListenPacket("udp", config.UDPAddr)
+		if err != nil {
+			closeAll()
+			return fmt.Errorf("failed to listen for syslog on udp %s: %w", config.UDPAddr, err)
+		}
+		listeners = append(listeners, conn)
+		receiver.serve(func() { receiver.serveUDP(conn) })
+	}
+
+	if config.TCPAddr != "" {
+		listener, err := net.Listen("tcp", config.TCPAddr)
+		if err != nil {
+			closeAll()
+			return fmt.Errorf("failed to listen for syslog on tcp %s: %w", config.TCPAddr, err)
+		}
+		listeners = append(listeners, listener)
+		receiver.serve(func() { receiver.serveStream(listener) })
+	}
+
+	if config.TLSAddr != "" {
+		certificate, err := tls.LoadX509KeyPair(config.TLSCertPath, config.TLSKeyPath)
+		if err != nil {
+			closeAll()
+			return fmt.Errorf("failed to load syslog TLS key pair: %w", err)
+		}
+		listener, err := tls.Listen("tcp", config.TLSAddr, &tls.Config{
+			Certificates: []tls.Certificate{certificate},
+			MinVersion:   tls.VersionTLS12,
+		})
+		if err != nil {
+			closeAll()
+			return fmt.Errorf("failed to listen for syslog on tls %s: %w", config.TLSAddr, err)
+		}
+		listeners = append(listeners, listener)
+		receiver.serve(func() { receiver.serveStream(listener) })
+	}
+
+	// a fixed set of workers anchors messages so that slow commits apply
+	// backpressure instead of piling up goroutines
+	var workers sync.WaitGroup
+	for i := 0; i < IngestConcurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for packet := range receiver.queue {
+				receiver.ingest(packet)
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	closeAll()
+	receiver.connections.Range(func(conn, _ any) bool {
+		_ = conn.(net.Conn).Close()
+		return true
+	})
+	receiver.listeners.Wait()
+	close(receiver.queue)
+	workers.Wait()
+	return nil
+}
+
+type syslogPacket struct {
+	data []byte
+	host string
+}
+
+type syslogReceiver struct {
+	ctx         context.Context
+	writer      *Writer
+	queue       chan syslogPacket
+	listeners   sync.WaitGroup
+	connections sync.Map
+}
+
+func (r *syslogReceiver) serve(fn func()) {
+	r.listeners.Add(1)
+	go func() {
+		defer r.listeners.Done()
+		fn()
+	}()
+}
+
+func (r *syslogReceiver) serveUDP(conn net.PacketConn) {
+	buffer := make([]byte, 64*1024)
+	for {
+		n, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Println("syslog udp listener stopped: ", err)
+			}
+			return
+		}
+		r.queue <- syslogPacket{data: append([]byte(nil), buffer[:n]...), host: remoteHost(addr)}
+	}
+}
+
+func (r *syslogReceiver) serveStream(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Println("syslog listener stopped: ", err)
+			}
+			return
+		}
+
+		r.connections.Store(conn, struct{}{})
+		if r.ctx.Err() != nil {
+			// accepted while shutting down, after open connections were closed
+			_ = conn.Close()
+		}
+		r.serve(func() {
+			defer r.connections.Delete(conn)
+			defer conn.Close()
+			r.readFrames(conn)
+		})
+	}
+}
+
+// readFrames reads messages from a stream until it fails or stays idle for
+// SyslogReadTimeout. Oversized frames are dropped.
+func (r *syslogReceiver) readFrames(conn net.Conn) {
+	host := remoteHost(conn.RemoteAddr())
+	// the buffer holds the longest message along with its newline
+	reader := bufio.NewReaderSize(conn, SyslogMaxMessage+1)
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(SyslogReadTimeout)); err != nil {
+			return
+		}
+		frame, err := readFrame(reader)
+		if errors.Is(err, errFrameTooLong) {
+			log.Println("syslog: dropping oversized frame from ", host)
+			continue
+		}
+		if errors.Is(err, errInvalidFrame) {
+			log.Println("syslog: invalid frame length from ", host)
+			return
+		}
+		if err != nil {
+			return
+		}
+
+		if len(bytes.TrimSpace(frame)) > 0 {
+			r.queue <- syslogPacket{data: frame, host: host}
+		}
+	}
+}
+
+// readFrame reads one message using octet counting (RFC 6587 3.4.1) when it
+// starts with a length, else newline delimited framing. A frame longer than
+// SyslogMaxMessage is skipped and reported as errFrameTooLong, so that reads
+// stay within the reader's buffer.
+func readFrame(reader *bufio.Reader) ([]byte, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if first[0] >= '1' && first[0] <= '9' {
+		length := 0
+		for digits := 0; ; digits++ {
+			c, err := reader.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if c == ' ' {
+				break
+			}
+			if c < '0' || c > '9' || digits == maxFrameLengthDigits {
+				return nil, errInvalidFrame
+			}
+			length = length*10 + int(c-'0')
+		}
+		if length > SyslogMaxMessage {
+			if _, err := reader.Discard(length); err != nil {
+				return nil, err
+			}
+			return nil, errFrameTooLong
+		}
+		frame := make([]byte, length)
+		if _, err := io.ReadFull(reader, frame); err != nil {
+			return nil, err
+		}
+		return frame, nil
+	}
+
+	frame, err := reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		for errors.Is(err, bufio.ErrBufferFull) {
+			_, err = reader.ReadSlice('\n')
+		}
+		if err != nil {
+			return nil, err
+		}
+		return nil, errFrameTooLong
+	}
+	if len(frame) == 0 && err != nil {
+		return nil, err
+	}
+	// the slice is only valid until the next read
+	return append([]byte(nil), frame...), nil
+}
+
+func (r *syslogReceiver) ingest(packet syslogPacket) {
+	msg, err := ParseSyslog(packet.data)
+	if err != nil {
+		log.Printf("syslog: dropping message from %s: %v", packet.host, err)
+		return
+	}
+
+	if _, err := r.writer.Ingest(msg.LogInput(packet.host), false); err != nil {
+		log.Println("Failed to write syslog message: ", err)
+	}
+}
+
+func remoteHost(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestReadFrame(t *testing.T) {
+	oversized := strings.Repeat("x", SyslogMaxMessage+1)
+
+	tests := []struct {
+		name   string
+		stream string
+		frames []string
+		errs   []error
+	}{
+		{
+			name:   "octet counting",
+			stream: "11 <13>1 - - -5 <13>x",
+			frames: []string{"<13>1 - - -", "<13>x"},
+		},
+		{
+			name:   "newline framing",
+			stream: "<13>first\n<13>second\n<13>last",
+			frames: []string{"<13>first\n", "<13>second\n", "<13>last"},
+		},
+		{
+			name:   "oversized octet counted frame",
+			stream: strconv.Itoa(len(oversized)) + " " + oversized + "5 <13>x",
+			frames: []string{"", "<13>x"},
+			errs:   []error{errFrameTooLong, nil},
+		},
+		{
+			name:   "oversized newline frame",
+			stream: oversized + "\n<13>x\n",
+			frames: []string{"", "<13>x\n"},
+			errs:   []error{errFrameTooLong, nil},
+		},
+		{
+			name:   "non-digit length",
+			stream: "12a <13>x",
+			frames: []string{""},
+			errs:   []error{errInvalidFrame},
+		},
+		{
+			name:   "too many length digits",
+			stream: "12345678901 <13>x",
+			frames: []string{""},
+			errs:   []error{errInvalidFrame},
+		},
+		{
+			name:   "truncated frame",
+			stream: "20 <13>x",
+			frames: []string{""},
+			errs:   []error{io.ErrUnexpectedEOF},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader := bufio.NewReaderSize(strings.NewReader(test.stream), SyslogMaxMessage+1)
+			for i, want := range test.frames {
+				var wantErr error
+				if test.errs != nil {
+					wantErr = test.errs[i]
+				}
+				frame, err := readFrame(reader)
+				if !errors.Is(err, wantErr) {
+					t.Fatalf("frame %d: readFrame() error = %v, want %v", i, err, wantErr)
+				}
+				if string(frame) != want {
+					t.Errorf("frame %d: readFrame() = %q, want %q", i, frame, want)
+				}
+			}
+			if test.errs == nil {
+				if _, err := readFrame(reader); err != io.EOF {
+					t.Errorf("readFrame() at end of stream error = %v, want io.EOF", err)
+				}
+			}
+		})
+	}
+}
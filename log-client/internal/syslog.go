@@ -0,0 +1,243 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSyslog = errors.New("invalid syslog message")
+
+var syslogSeverities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// SyslogMessage is a parsed RFC 5424 or RFC 3164 message. Absent fields are empty.
+type SyslogMessage struct {
+	Facility       int
+	Severity       int
+	Version        int
+	Timestamp      *time.Time
+	Hostname       string
+	AppName        string
+	ProcID         string
+	MsgID          string
+	StructuredData map[string]map[string]string
+	Message        string
+}
+
+// ParseSyslog parses an RFC 5424 message, falling back to the BSD format of
+// RFC 3164 when the version field is missing.
+func ParseSyslog(data []byte) (*SyslogMessage, error) {
+	data = bytes.TrimRight(data, "\r\n\x00")
+
+	if len(data) < 3 || data[0] != '<' {
+		return nil, fmt.Errorf("%w: missing priority", ErrInvalidSyslog)
+	}
+	end := bytes.IndexByte(data, '>')
+	if end < 2 || end > 4 {
+		return nil, fmt.Errorf("%w: malformed priority", ErrInvalidSyslog)
+	}
+	priority, err := strconv.Atoi(string(data[1:end]))
+	if err != nil || priority > 191 {
+		return nil, fmt.Errorf("%w: malformed priority", ErrInvalidSyslog)
+	}
+
+	msg := &SyslogMessage{Facility: priority / 8, Severity: priority % 8}
+	rest := string(data[end+1:])
+
+	// RFC 5424 puts a version right after the priority, RFC 3164 a timestamp
+	if len(rest) > 1 && rest[0] >= '1' && rest[0] <= '9' && (rest[1] == ' ' || (len(rest) > 2 && rest[1] >= '0' && rest[1] <= '9' && rest[2] == ' ')) {
+		return msg, parseRFC5424(msg, rest)
+	}
+	parseRFC3164(msg, rest, time.Now())
+	return msg, nil
+}
+
+func parseRFC5424(msg *SyslogMessage, rest string) error {
+	fields := make([]string, 0, 6)
+	for i := 0; i < 6; i++ {
+		field, remaining, ok := strings.Cut(rest, " ")
+		if !ok && i < 5 {
+			return fmt.Errorf("%w: truncated header", ErrInvalidSyslog)
+		}
+		fields = append(fields, field)
+		rest = remaining
+	}
+
+	msg.Version, _ = strconv.Atoi(fields[0])
+	if fields[1] != "-" {
+		timestamp, err := time.Parse(time.RFC3339Nano, fields[1])
+		if err != nil {
+			return fmt.Errorf("%w: timestamp: %v", ErrInvalidSyslog, err)
+		}
+		msg.Timestamp = &timestamp
+	}
+	msg.Hostname = nilValue(fields[2])
+	msg.AppName = nilValue(fields[3])
+	msg.ProcID = nilValue(fields[4])
+	msg.MsgID = nilValue(fields[5])
+
+	structuredData, rest, err := parseStructuredData(rest)
+	if err != nil {
+		return err
+	}
+	msg.StructuredData = structuredData
+
+	rest = strings.TrimPrefix(rest, " ")
+	msg.Message = strings.TrimPrefix(rest, "\ufeff")
+	return nil
+}
+
+// parseStructuredData reads either "-" or a run of [id param="value" ...]
+// elements and returns the text after them.
+func parseStructuredData(s string) (map[string]map[string]string, string, error) {
+	if strings.HasPrefix(s, "-") {
+		return nil, s[1:], nil
+	}
+
+	data := map[string]map[string]string{}
+	for strings.HasPrefix(s, "[") {
+		s = s[1:]
+
+		idEnd := strings.IndexAny(s, " ]")
+		if idEnd <= 0 {
+			return nil, "", fmt.Errorf("%w: malformed structured data", ErrInvalidSyslog)
+		}
+		params := map[string]string{}
+		data[s[:idEnd]] = params
+		s = s[idEnd:]
+
+		for strings.HasPrefix(s, " ") {
+			s = s[1:]
+			name, remaining, ok := strings.Cut(s, `="`)
+			if !ok || name == "" {
+				return nil, "", fmt.Errorf("%w: malformed structured data parameter", ErrInvalidSyslog)
+			}
+			s = remaining
+
+			// values escape '"', '\' and ']' with a backslash
+			var value strings.Builder
+			closed := false
+			for i := 0; i < len(s); i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`"\]`, s[i+1]) >= 0 {
+					value.WriteByte(s[i+1])
+					i++
+				} else if s[i] == '"' {
+					s = s[i+1:]
+					closed = true
+					break
+				} else {
+					value.WriteByte(s[i])
+				}
+			}
+			if !closed {
+				return nil, "", fmt.Errorf("%w: unterminated structured data value", ErrInvalidSyslog)
+			}
+			params[name] = value.String()
+		}
+
+		if !strings.HasPrefix(s, "]") {
+			return nil, "", fmt.Errorf("%w: unterminated structured data element", ErrInvalidSyslog)
+		}
+		s = s[1:]
+	}
+
+	if len(data) == 0 {
+		return nil, "", fmt.Errorf("%w: missing structured data", ErrInvalidSyslog)
+	}
+	return data, s, nil
+}
+
+// parseRFC3164 is lenient since BSD syslog was never strictly specified:
+// the timestamp and hostname are optional and the tag ends at '[' or ':'.
+func parseRFC3164(msg *SyslogMessage, rest string, now time.Time) {
+	if len(rest) >= 16 && rest[15] == ' ' {
+		// the timestamp carries no year, so pick the one that keeps it out of the future
+		timestamp, err := time.ParseInLocation(time.Stamp, rest[:15], time.Local)
+		if err == nil {
+			timestamp = timestamp.AddDate(now.Year(), 0, 0)
+			if timestamp.After(now.Add(24 * time.Hour)) {
+				timestamp = timestamp.AddDate(-1, 0, 0)
+			}
+			msg.Timestamp = &timestamp
+			rest = rest[16:]
+
+			if hostname, remaining, ok := strings.Cut(rest, " "); ok && !strings.ContainsAny(hostname, ":[") {
+				msg.Hostname = hostname
+				rest = remaining
+			}
+		}
+	}
+
+	// TAG[PID]: MSG
+	tagEnd := strings.IndexAny(rest, "[: ")
+	if tagEnd > 0 && tagEnd <= 48 && rest[tagEnd] != ' ' {
+		msg.AppName = rest[:tagEnd]
+		rest = rest[tagEnd:]
+		if strings.HasPrefix(rest, "[") {
+			if pid, remaining, ok := strings.Cut(rest[1:], "]"); ok {
+				msg.ProcID = pid
+				rest = remaining
+			}
+		}
+		rest = strings.TrimPrefix(rest, ":")
+	}
+
+	msg.Message = strings.TrimPrefix(rest, " ")
+}
+
+// Source maps the message to a log source as "hostname/app-name", using
+// fallback when the message names no host.
+func (m *SyslogMessage) Source(fallback string) string {
+	hostname := m.Hostname
+	if hostname == "" {
+		hostname = fallback
+	}
+	if m.AppName == "" {
+		return hostname
+	}
+	return hostname + "/" + m.AppName
+}
+
+// LogInput turns the message into an entry for the ingestion path, keeping the
+// header fields and structured data as labels.
+func (m *SyslogMessage) LogInput(fallbackHost string) LogInput {
+	labels := map[string]string{
+		"syslog.facility": strconv.Itoa(m.Facility),
+		"syslog.severity": syslogSeverities[m.Severity],
+	}
+	for key, value := range map[string]string{
+		"syslog.hostname": m.Hostname,
+		"syslog.appname":  m.AppName,
+		"syslog.procid":   m.ProcID,
+		"syslog.msgid":    m.MsgID,
+	} {
+		if value != "" {
+			labels[key] = value
+		}
+	}
+	for id, params := range m.StructuredData {
+		if len(params) == 0 {
+			labels["sd."+id] = ""
+		}
+		for name, value := range params {
+			labels["sd."+id+"."+name] = value
+		}
+	}
+
+	return LogInput{
+		Source:    m.Source(fallbackHost),
+		Content:   m.Message,
+		EventTime: m.Timestamp,
+		Labels:    labels,
+	}
+}
+
+func nilValue(field string) string {
+	if field == "-" {
+		return ""
+	}
+	return field
+}
@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSyslog(t *testing.T) {
+	timestamp := time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC)
+
+	tests := []struct {
+		name    string
+		data    string
+		want    *SyslogMessage
+		wantErr bool
+	}{
+		{
+			name: "rfc 5424",
+			data: "<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - 'su root' failed for lonvick on /dev/pts/8\n",
+			want: &SyslogMessage{
+				Facility: 4, Severity: 2, Version: 1, Timestamp: &timestamp,
+				Hostname: "mymachine.example.com", AppName: "su", MsgID: "ID47",
+				Message: "'su root' failed for lonvick on /dev/pts/8",
+			},
+		},
+		{
+			name: "rfc 5424 structured data",
+			data: `<165>1 2003-10-11T22:14:15.003Z host app 1234 - [exampleSDID@32473 iut="3" eventID="10\]11"][origin] ` + "\ufeffstarted",
+			want: &SyslogMessage{
+				Facility: 20, Severity: 5, Version: 1, Timestamp: &timestamp,
+				Hostname: "host", AppName: "app", ProcID: "1234",
+				StructuredData: map[string]map[string]string{
+					"exampleSDID@32473": {"iut": "3", "eventID": "10]11"},
+					"origin":            {},
+				},
+				Message: "started",
+			},
+		},
+		{
+			name: "rfc 5424 nil values",
+			data: "<14>1 - - - - - -",
+			want: &SyslogMessage{Facility: 1, Severity: 6, Version: 1},
+		},
+		{
+			name: "rfc 3164 without header",
+			data: "<13>sshd[42]: Accepted publickey",
+			want: &SyslogMessage{Facility: 1, Severity: 5, AppName: "sshd", ProcID: "42", Message: "Accepted publickey"},
+		},
+		{
+			name: "rfc 3164 plain text",
+			data: "<13>just some text",
+			want: &SyslogMessage{Facility: 1, Severity: 5, Message: "just some text"},
+		},
+		{name: "missing priority", data: "hello", wantErr: true},
+		{name: "priority out of range", data: "<192>1 - - - - - -", wantErr: true},
+		{name: "unterminated priority", data: "<13345 hello", wantErr: true},
+		{name: "truncated header", data: "<14>1 - host app", wantErr: true},
+		{name: "bad timestamp", data: "<14>1 yesterday host app - - - msg", wantErr: true},
+		{name: "unterminated structured data", data: `<14>1 - host app - - [id a="1" msg`, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseSyslog([]byte(test.data))
+			if test.wantErr {
+				if !errors.Is(err, ErrInvalidSyslog) {
+					t.Fatalf("ParseSyslog() error = %v, want ErrInvalidSyslog", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSyslog() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseSyslog() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseRFC3164Timestamp(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name     string
+		rest     string
+		want     time.Time
+		hostname string
+		appName  string
+		message  string
+	}{
+		{
+			name:     "this year",
+			rest:     "Jan  1 10:00:00 web01 nginx: GET /",
+			want:     time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local),
+			hostname: "web01",
+			appName:  "nginx",
+			message:  "GET /",
+		},
+		{
+			name:    "last year",
+			rest:    "Dec 31 23:59:59 cron: done",
+			want:    time.Date(2023, 12, 31, 23, 59, 59, 0, time.Local),
+			appName: "cron",
+			message: "done",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg := &SyslogMessage{}
+			parseRFC3164(msg, test.rest, now)
+			if msg.Timestamp == nil || !msg.Timestamp.Equal(test.want) {
+				t.Errorf("Timestamp = %v, want %v", msg.Timestamp, test.want)
+			}
+			if msg.Hostname != test.hostname || msg.AppName != test.appName || msg.Message != test.message {
+				t.Errorf("parseRFC3164() = %+v", msg)
+			}
+		})
+	}
+}
+
+func TestSyslogMessageLogInput(t *testing.T) {
+	msg := &SyslogMessage{
+		Facility: 4, Severity: 2, AppName: "su", MsgID: "ID47",
+		StructuredData: map[string]map[string]string{"origin": {}, "meta": {"seq": "7"}},
+		Message:        "failed",
+	}
+
+	input := msg.LogInput("10.0.0.1")
+	if input.Source != "10.0.0.1/su" || input.Content != "failed" {
+		t.Errorf("LogInput() = %+v", input)
+	}
+	want := map[string]string{
+		"syslog.facility": "4",
+		"syslog.severity": "crit",
+		"syslog.appname":  "su",
+		"syslog.msgid":    "ID47",
+		"sd.origin":       "",
+		"sd.meta.seq":     "7",
+	}
+	if !reflect.DeepEqual(input.Labels, want) {
+		t.Errorf("Labels = %v, want %v", input.Labels, want)
+	}
+}
@@ -2,30 +2,61 @@ package internal
 
 import (
 	"bufio"
+	"context"
+	"io"
 	"log"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
 
-func WatchFile(filePath string, processLine func(string), stop chan struct{}) {
+var runningWatchers = struct {
+	sync.Mutex
+	count map[string]int
+}{count: map[string]int{}}
+
+// RunningWatchers returns the files currently being watched.
+func RunningWatchers() map[string]int {
+	runningWatchers.Lock()
+	defer runningWatchers.Unlock()
+
+	running := make(map[string]int, len(runningWatchers.count))
+	for path, count := range runningWatchers.count {
+		running[path] = count
+	}
+	return running
+}
+
+// WatchFile calls processLine for every line appended to the file until ctx is done.
+func WatchFile(ctx context.Context, filePath string, processLine func(string)) error {
+	// a replaced watcher may still be shutting down, so keep a count per file
+	runningWatchers.Lock()
+	runningWatchers.count[filePath]++
+	runningWatchers.Unlock()
+	defer func() {
+		runningWatchers.Lock()
+		if runningWatchers.count[filePath]--; runningWatchers.count[filePath] == 0 {
+			delete(runningWatchers.count, filePath)
+		}
+		runningWatchers.Unlock()
+	}()
+
 	// open the file
 	file, err := os.Open(filePath)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer func() {
 		if err := file.Close(); err != nil {
-			log.Printf("failed to close gRPC connection: %v", err)
+			log.Printf("failed to close watched file: %v", err)
 		}
 	}()
 
 	// start reading from the end of file
-	info, _ := file.Stat()
-	_, err = file.Seek(info.Size(), 0)
-	if err != nil {
-		panic(err)
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		return err
 	}
 
 	reader := bufio.NewReader(file)
@@ -33,37 +64,42 @@ func WatchFile(filePath string, processLine func(string), stop chan struct{}) {
 	// setup fsnotify watcher
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer func() {
 		if err := watcher.Close(); err != nil {
-			log.Printf("failed to close gRPC connection: %v", err)
+			log.Printf("failed to close file watcher: %v", err)
 		}
 	}()
 
-	err = watcher.Add(filePath)
-	if err != nil {
-		log.Fatal(err)
+	if err := watcher.Add(filePath); err != nil {
+		return err
 	}
 
+	partial := ""
 	for {
 		select {
 		case event := <-watcher.Events:
 			if event.Op&fsnotify.Write == fsnotify.Write {
-				for {
+				for ctx.Err() == nil {
 					line, err := reader.ReadString('\n')
 
-					// no more new lines yet
+					// no more new lines yet, keep the unterminated part for the next write
 					if err != nil {
+						partial += line
 						break
 					}
+					line = partial + line
+					partial = ""
+
+					linesRead.WithLabelValues(filePath).Inc()
 					processLine(line)
 				}
 			}
 		case err := <-watcher.Errors:
 			log.Println("error:", err)
-		case <-stop:
-			return
+		case <-ctx.Done():
+			return nil
 		}
 	}
 }
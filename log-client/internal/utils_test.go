@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWatchFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		writes   []string
+		want     []string
+	}{
+		{name: "appended lines", writes: []string{"first\nsecond\n"}, want: []string{"first\n", "second\n"}},
+		{name: "existing content is skipped", existing: "old\n", writes: []string{"new\n"}, want: []string{"new\n"}},
+		{name: "line split across writes", writes: []string{"par", "tial\nnext\n"}, want: []string{"partial\n", "next\n"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app.log")
+			if err := os.WriteFile(path, []byte(test.existing), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			lines := make(chan string, 16)
+			done := make(chan error, 1)
+			go func() { done <- WatchFile(ctx, path, func(line string) { lines <- line }) }()
+
+			// give the watcher time to seek to the end and subscribe
+			deadline := time.Now().Add(2 * time.Second)
+			for RunningWatchers()[path] == 0 && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			time.Sleep(50 * time.Millisecond)
+
+			file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			for _, write := range test.writes {
+				if _, err := file.WriteString(write); err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			var got []string
+			for len(got) < len(test.want) {
+				select {
+				case line := <-lines:
+					got = append(got, line)
+				case <-time.After(2 * time.Second):
+					t.Fatalf("read %q, want %q", got, test.want)
+				}
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("read %q, want %q", got, test.want)
+			}
+
+			// cancelling stops the watcher and unregisters it
+			cancel()
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Errorf("WatchFile() error = %v", err)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("WatchFile() did not return after cancel")
+			}
+			if count, ok := RunningWatchers()[path]; ok {
+				t.Errorf("watcher still registered %d times after it returned", count)
+			}
+		})
+	}
+}
+
+func TestWatchFileMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.log")
+	if err := WatchFile(context.Background(), path, func(string) {}); err == nil {
+		t.Error("WatchFile() of a missing file returned no error")
+	}
+	if _, ok := RunningWatchers()[path]; ok {
+		t.Error("failed watcher is still registered")
+	}
+}
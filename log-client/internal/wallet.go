@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+const walletFileSuffix = ".id"
+
+var identityNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@-]*$`)
+
+var ErrIdentityNotFound = errors.New("identity not found in wallet")
+
+// WalletIdentity is an X.509 identity stored in the wallet, in the same layout
+// as the Fabric SDK filesystem wallets. Identities without a private key sign
+// through the configured HSM, with the key whose hex encoded CKA_ID is
+// HSMKeyID, or by default the certificate's subject key identifier.
+type WalletIdentity struct {
+	Credentials struct {
+		Certificate string `json:"certificate"`
+		PrivateKey  string `json:"privateKey,omitempty"`
+		HSMKeyID    string `json:"hsmKeyId,omitempty"`
+	} `json:"credentials"`
+	MspID   string `json:"mspId"`
+	Type    string `json:"type"`
+	Version int    `json:"version"`
+}
+
+// Wallet is a directory holding one file per named identity.
+type Wallet struct {
+	dir string
+}
+
+// NewWallet opens the wallet directory, creating it when missing.
+func NewWallet(dir string) (*Wallet, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create wallet directory: %w", err)
+	}
+	return &Wallet{dir: dir}, nil
+}
+
+// OpenWallet opens the wallet configured through WALLET_PATH.
+func OpenWallet() (*Wallet, error) {
+	return NewWallet(getEnv("WALLET_PATH", DefaultWalletPath))
+}
+
+// NewWalletIdentity builds a wallet identity from PEM files. An empty keyPath
+// creates an identity whose key lives in the HSM.
+func NewWalletIdentity(mspID string, certPath string, keyPath string) (*WalletIdentity, error) {
+	certificatePEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate file: %w", err)
+	}
+	if _, err := identity.CertificateFromPEM(certificatePEM); err != nil {
+		return nil, fmt.Errorf("invalid certificate: %w", err)
+	}
+
+	id := &WalletIdentity{MspID: mspID, Type: "X.509", Version: 1}
+	id.Credentials.Certificate = string(certificatePEM)
+
+	if keyPath != "" {
+		privateKeyPEM, err := os.ReadFile(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key file: %w", err)
+		}
+		if _, err := identity.PrivateKeyFromPEM(privateKeyPEM); err != nil {
+			return nil, fmt.Errorf("invalid private key: %w", err)
+		}
+		id.Credentials.PrivateKey = string(privateKeyPEM)
+	}
+
+	return id, nil
+}
+
+// Put stores an identity under name, replacing any existing one.
+func (w *Wallet) Put(name string, id *WalletIdentity) error {
+	path, err := w.path(name)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(id, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write then rename so a crash never leaves a truncated identity behind
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write identity %s: %w", name, err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// Get loads the identity stored under name.
+func (w *Wallet) Get(name string) (*WalletIdentity, error) {
+	path, err := w.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrIdentityNotFound, name)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var id WalletIdentity
+	if err := json.Unmarshal(data, &id); err != nil {
+		return nil, fmt.Errorf("failed to decode identity %s: %w", name, err)
+	}
+	return &id, nil
+}
+
+// List returns the names of every identity in the wallet.
+func (w *Wallet) List() ([]string, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), walletFileSuffix) {
+			names = append(names, strings.TrimSuffix(entry.Name(), walletFileSuffix))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Remove deletes the identity stored under name.
+func (w *Wallet) Remove(name string) error {
+	path, err := w.path(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrIdentityNotFound, name)
+	} else {
+		return err
+	}
+}
+
+func (w *Wallet) path(name string) (string, error) {
+	if !identityNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid identity name %q", name)
+	}
+	return filepath.Join(w.dir, name+walletFileSuffix), nil
+}
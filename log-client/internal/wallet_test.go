@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestWallet(t *testing.T) {
+	dir := t.TempDir()
+	wallet, err := NewWallet(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := selfSignedIdentity(t, "Org1MSP")
+	for _, name := range []string{"client2", "client1"} {
+		if err := wallet.Put(name, stored); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// neither a leftover temporary file nor a directory is an identity
+	if err := os.WriteFile(filepath.Join(dir, "client3.id.tmp"), []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "nested.id"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := wallet.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"client1", "client2"}; !slices.Equal(names, want) {
+		t.Errorf("List() = %v, want %v", names, want)
+	}
+
+	tests := []struct {
+		name      string
+		wantErr   error
+		wantValid bool
+	}{
+		{name: "client1", wantValid: true},
+		{name: "org1.admin@example.com", wantErr: ErrIdentityNotFound, wantValid: true},
+		{name: "../client1", wantValid: false},
+		{name: "nested/client1", wantValid: false},
+		{name: ".hidden", wantValid: false},
+		{name: "", wantValid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := wallet.Get(test.name)
+			switch {
+			case !test.wantValid:
+				if err == nil || errors.Is(err, ErrIdentityNotFound) {
+					t.Errorf("Get() error = %v, want an invalid name", err)
+				}
+			case !errors.Is(err, test.wantErr) || (test.wantErr == nil) != (err == nil):
+				t.Errorf("Get() error = %v, want %v", err, test.wantErr)
+			case err == nil && *got != *stored:
+				t.Errorf("Get() = %+v, want %+v", got, stored)
+			}
+
+			if err := wallet.Put(test.name, stored); (err == nil) != test.wantValid {
+				t.Errorf("Put() error = %v, want valid name %v", err, test.wantValid)
+			}
+		})
+	}
+
+	if err := wallet.Remove("client2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := wallet.Remove("client2"); !errors.Is(err, ErrIdentityNotFound) {
+		t.Errorf("Remove() of a removed identity error = %v, want %v", err, ErrIdentityNotFound)
+	}
+	if _, err := wallet.Get("client2"); !errors.Is(err, ErrIdentityNotFound) {
+		t.Errorf("Get() of a removed identity error = %v, want %v", err, ErrIdentityNotFound)
+	}
+}
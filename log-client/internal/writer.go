@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrWriterClosed = errors.New("log writer is closed")
+
+// Writer anchors log lines and keeps track of submissions still in flight so
+// that they can be drained before shutdown.
+type Writer struct {
+	ctx        context.Context
+	connection *Connection
+
+	mu       sync.Mutex
+	closed   bool
+	inFlight sync.WaitGroup
+
+	// anchoring holds the IDs of ingested entries being anchored
+	anchoring sync.Map
+}
+
+// NewWriter creates a writer whose submissions are bound to ctx. Cancelling ctx
+// aborts submissions that are still waiting on the ledger.
+func NewWriter(ctx context.Context, connection *Connection) *Writer {
+	return &Writer{ctx: ctx, connection: connection}
+}
+
+// Write stores and anchors a log line as the identity mapped to its source,
+// waiting for its commit status.
+func (w *Writer) Write(content string, source string) error {
+	return w.WriteAs(content, source, w.connection.IdentityForSource(source))
+}
+
+// WriteAs stores and anchors a log line as the named identity, waiting for its
+// commit status.
+func (w *Writer) WriteAs(content string, source string, identityName string) error {
+	if err := w.begin(); err != nil {
+		return err
+	}
+	defer w.inFlight.Done()
+
+	return WriteLogAs(w.ctx, w.connection, content, source, identityName)
+}
+
+// WriteWith stores a log line as options configure and anchors it as the
+// named identity, waiting for its commit status.
+func (w *Writer) WriteWith(content string, source string, identityName string, options WriteOptions) error {
+	if err := w.begin(); err != nil {
+		return err
+	}
+	defer w.inFlight.Done()
+
+	return WriteLogWith(w.ctx, w.connection, content, source, identityName, options)
+}
+
+// begin registers a submission so that Drain waits for it. The caller must
+// call inFlight.Done once the submission is resolved.
+func (w *Writer) begin() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return ErrWriterClosed
+	}
+	w.inFlight.Add(1)
+	return nil
+}
+
+// claim marks an entry as being anchored, failing when it already is.
+func (w *Writer) claim(entryID uint) bool {
+	_, claimed := w.anchoring.LoadOrStore(entryID, struct{}{})
+	return !claimed
+}
+
+func (w *Writer) release(entryID uint) {
+	w.anchoring.Delete(entryID)
+}
+
+// Drain stops accepting new lines and waits until every in-flight submission
+// has received its commit status or ctx is done.
+func (w *Writer) Drain(ctx context.Context) error {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		w.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,310 @@
+// Package sdk lets Go applications send log entries to the immutable log,
+// either through the API gateway or directly to Fabric. Entries are batched in
+// the background and every entry gets a delivery receipt.
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Receipt statuses.
+const (
+	StatusCommitted = "committed"
+	StatusPending   = "pending"
+	StatusFailed    = "failed"
+)
+
+const (
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = time.Second
+	DefaultQueueSize     = 1024
+	DefaultSendTimeout   = 30 * time.Second
+)
+
+var ErrClientClosed = errors.New("log client is closed")
+
+// Entry is a log entry to anchor.
+type Entry struct {
+	Source         string            `json:"source"`
+	Content        string            `json:"content"`
+	EventTime      *time.Time        `json:"eventTime,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	IdempotencyKey string            `json:"idempotencyKey,omitempty"`
+	// Parser names the parser that extracts the entry's fields, the
+	// gateway's default when empty.
+	Parser string `json:"parser,omitempty"`
+}
+
+// Receipt reports where an entry was stored and anchored. Entries sent in
+// async mode are pending until looked up again by their PendingToken.
+type Receipt struct {
+	EntryID      uint   `json:"entryId,omitempty"`
+	Source       string `json:"source,omitempty"`
+	LogID        string `json:"logId,omitempty"`
+	TxID         string `json:"txId,omitempty"`
+	Status       string `json:"status"`
+	PendingToken string `json:"pendingToken,omitempty"`
+	Duplicate    bool   `json:"duplicate,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// Transport delivers batches of entries.
+type Transport interface {
+	// Send delivers a batch and returns one receipt per entry, in order.
+	Send(ctx context.Context, entries []Entry) ([]Receipt, error)
+	// Receipt looks up the receipt of an entry sent in async mode.
+	Receipt(ctx context.Context, token string) (Receipt, error)
+	Close() error
+}
+
+// Options configures the batching of a client. Zero values use the defaults.
+type Options struct {
+	// BatchSize is the number of entries sent at most in one batch.
+	BatchSize int
+	// FlushInterval is how long an entry waits for its batch to fill up.
+	FlushInterval time.Duration
+	// QueueSize is the number of entries buffered before Send blocks.
+	QueueSize int
+	// SendTimeout bounds the delivery of one batch.
+	SendTimeout time.Duration
+	// OnReceipt, if set, is called with the receipt of every entry.
+	OnReceipt func(Entry, Receipt)
+}
+
+// Delivery is an entry handed to a client, resolved once its batch is sent.
+type Delivery struct {
+	Entry Entry
+
+	done    chan struct{}
+	receipt Receipt
+	err     error
+}
+
+// Done is closed once the entry is delivered or has failed.
+func (d *Delivery) Done() <-chan struct{} {
+	return d.done
+}
+
+// Wait blocks until the entry is delivered and returns its receipt.
+func (d *Delivery) Wait(ctx context.Context) (Receipt, error) {
+	select {
+	case <-d.done:
+		return d.receipt, d.err
+	case <-ctx.Done():
+		return Receipt{}, ctx.Err()
+	}
+}
+
+func (d *Delivery) resolve(receipt Receipt, err error) {
+	d.receipt = receipt
+	d.err = err
+	close(d.done)
+}
+
+// Client batches entries and sends them through a transport.
+type Client struct {
+	transport Transport
+	options   Options
+
+	mu      sync.RWMutex
+	closed  bool
+	senders sync.WaitGroup
+	queue   chan *Delivery
+	flushes chan chan struct{}
+	closing chan struct{}
+	stopped chan struct{}
+}
+
+// NewClient starts a client that sends batches through transport.
+func NewClient(transport Transport, options Options) *Client {
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultBatchSize
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = DefaultFlushInterval
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = DefaultQueueSize
+	}
+	if options.SendTimeout <= 0 {
+		options.SendTimeout = DefaultSendTimeout
+	}
+
+	c := &Client{
+		transport: transport,
+		options:   options,
+		queue:     make(chan *Delivery, options.QueueSize),
+		flushes:   make(chan chan struct{}),
+		closing:   make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+// Send queues an entry for the next batch, blocking while the queue is full.
+func (c *Client) Send(entry Entry) *Delivery {
+	delivery := &Delivery{Entry: entry, done: make(chan struct{})}
+
+	c.mu.RLock()
+	if c.closed {
+		c.mu.RUnlock()
+		delivery.resolve(closedReceipt(entry), ErrClientClosed)
+		return delivery
+	}
+	// Close waits for senders before draining the queue
+	c.senders.Add(1)
+	c.mu.RUnlock()
+	defer c.senders.Done()
+
+	select {
+	case c.queue <- delivery:
+	case <-c.closing:
+		delivery.resolve(closedReceipt(entry), ErrClientClosed)
+	}
+	return delivery
+}
+
+func closedReceipt(entry Entry) Receipt {
+	return Receipt{Source: entry.Source, Status: StatusFailed, Error: ErrClientClosed.Error()}
+}
+
+// Log sends an entry and waits for its receipt.
+func (c *Client) Log(ctx context.Context, entry Entry) (Receipt, error) {
+	return c.Send(entry).Wait(ctx)
+}
+
+// Receipt looks up the receipt of an entry sent in async mode.
+func (c *Client) Receipt(ctx context.Context, token string) (Receipt, error) {
+	return c.transport.Receipt(ctx, token)
+}
+
+// Flush sends every queued entry without waiting for the flush interval and
+// returns once they are delivered.
+func (c *Client) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	select {
+	case c.flushes <- flushed:
+	case <-c.closing:
+		return ErrClientClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close sends the remaining entries, waiting until they are delivered or ctx
+// is done, and closes the transport.
+func (c *Client) Close(ctx context.Context) error {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.closing)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-c.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return c.transport.Close()
+}
+
+func (c *Client) run() {
+	defer close(c.stopped)
+
+	ticker := time.NewTicker(c.options.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Delivery, 0, c.options.BatchSize)
+	send := func() {
+		if len(batch) > 0 {
+			c.send(batch)
+			batch = make([]*Delivery, 0, c.options.BatchSize)
+		}
+	}
+	drain := func() {
+		for {
+			select {
+			case delivery := <-c.queue:
+				batch = append(batch, delivery)
+				if len(batch) >= c.options.BatchSize {
+					send()
+				}
+			default:
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case delivery := <-c.queue:
+			batch = append(batch, delivery)
+			if len(batch) >= c.options.BatchSize {
+				send()
+			}
+
+		case <-ticker.C:
+			send()
+
+		case flushed := <-c.flushes:
+			// entries queued before the flush are already buffered
+			drain()
+			send()
+			close(flushed)
+
+		case <-c.closing:
+			// senders blocked on a full queue give up once closing is closed
+			c.senders.Wait()
+			drain()
+			send()
+			return
+		}
+	}
+}
+
+func (c *Client) send(batch []*Delivery) {
+	entries := make([]Entry, len(batch))
+	for i, delivery := range batch {
+		entries[i] = delivery.Entry
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.SendTimeout)
+	defer cancel()
+
+	receipts, err := c.transport.Send(ctx, entries)
+	if err == nil && len(receipts) != len(batch) {
+		err = fmt.Errorf("expected %d receipts, got %d", len(batch), len(receipts))
+	}
+
+	for i, delivery := range batch {
+		var receipt Receipt
+		var entryErr error
+		if err != nil {
+			receipt = Receipt{Source: delivery.Entry.Source, Status: StatusFailed, Error: err.Error()}
+			entryErr = err
+		} else {
+			receipt = receipts[i]
+			if receipt.Status == StatusFailed {
+				entryErr = errors.New(receipt.Error)
+			}
+		}
+
+		if c.options.OnReceipt != nil {
+			c.options.OnReceipt(delivery.Entry, receipt)
+		}
+		delivery.resolve(receipt, entryErr)
+	}
+}
@@ -0,0 +1,198 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTransport records the batches it is sent and commits every entry,
+// failing the ones whose content is "fail".
+type fakeTransport struct {
+	mu      sync.Mutex
+	batches [][]Entry
+	err     error
+	closed  bool
+}
+
+func (t *fakeTransport) Send(ctx context.Context, entries []Entry) ([]Receipt, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.batches = append(t.batches, entries)
+	if t.err != nil {
+		return nil, t.err
+	}
+
+	receipts := make([]Receipt, len(entries))
+	for i, entry := range entries {
+		receipts[i] = Receipt{Source: entry.Source, LogID: entry.Content, Status: StatusCommitted}
+		if entry.Content == "fail" {
+			receipts[i] = Receipt{Source: entry.Source, Status: StatusFailed, Error: "rejected"}
+		}
+	}
+	return receipts, nil
+}
+
+func (t *fakeTransport) Receipt(ctx context.Context, token string) (Receipt, error) {
+	return Receipt{Status: StatusPending, PendingToken: token}, nil
+}
+
+func (t *fakeTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	return nil
+}
+
+func (t *fakeTransport) batchSizes() []int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sizes := make([]int, len(t.batches))
+	for i, batch := range t.batches {
+		sizes[i] = len(batch)
+	}
+	return sizes
+}
+
+func TestClientBatching(t *testing.T) {
+	tests := []struct {
+		name      string
+		batchSize int
+		entries   int
+		want      []int
+	}{
+		{name: "full batches", batchSize: 2, entries: 4, want: []int{2, 2}},
+		{name: "partial batch on flush", batchSize: 3, entries: 4, want: []int{3, 1}},
+		{name: "single batch", batchSize: 10, entries: 4, want: []int{4}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport := &fakeTransport{}
+			// the flush interval is long enough to never tick during the test
+			client := NewClient(transport, Options{BatchSize: test.batchSize, FlushInterval: time.Hour})
+
+			deliveries := make([]*Delivery, test.entries)
+			for i := range deliveries {
+				deliveries[i] = client.Send(Entry{Source: "app", Content: strconv.Itoa(i)})
+			}
+			if err := client.Flush(context.Background()); err != nil {
+				t.Fatalf("Flush() error = %v", err)
+			}
+
+			for i, delivery := range deliveries {
+				receipt, err := delivery.Wait(context.Background())
+				if err != nil || receipt.LogID != strconv.Itoa(i) {
+					t.Errorf("delivery %d = %+v, %v", i, receipt, err)
+				}
+			}
+			if got := transport.batchSizes(); !slices.Equal(got, test.want) {
+				t.Errorf("batch sizes = %v, want %v", got, test.want)
+			}
+			if err := client.Close(context.Background()); err != nil {
+				t.Errorf("Close() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestClientReceipts(t *testing.T) {
+	sendErr := errors.New("gateway unavailable")
+
+	tests := []struct {
+		name          string
+		content       string
+		transportErr  error
+		wantStatus    string
+		wantErr       bool
+		wantOnReceipt int
+	}{
+		{name: "committed", content: "ok", wantStatus: StatusCommitted, wantOnReceipt: 1},
+		{name: "rejected entry", content: "fail", wantStatus: StatusFailed, wantErr: true, wantOnReceipt: 1},
+		{name: "failed batch", content: "ok", transportErr: sendErr, wantStatus: StatusFailed, wantErr: true, wantOnReceipt: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var onReceipt int
+			transport := &fakeTransport{err: test.transportErr}
+			client := NewClient(transport, Options{
+				BatchSize: 1,
+				OnReceipt: func(Entry, Receipt) { onReceipt++ },
+			})
+			defer client.Close(context.Background())
+
+			receipt, err := client.Log(context.Background(), Entry{Source: "app", Content: test.content})
+			if (err != nil) != test.wantErr {
+				t.Errorf("Log() error = %v, want error %v", err, test.wantErr)
+			}
+			if receipt.Status != test.wantStatus {
+				t.Errorf("Log() status = %q, want %q", receipt.Status, test.wantStatus)
+			}
+			if onReceipt != test.wantOnReceipt {
+				t.Errorf("OnReceipt called %d times, want %d", onReceipt, test.wantOnReceipt)
+			}
+		})
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	transport := &fakeTransport{}
+	client := NewClient(transport, Options{BatchSize: 100, FlushInterval: time.Hour})
+
+	queued := client.Send(Entry{Source: "app", Content: "queued"})
+	if err := client.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// entries queued before Close are still delivered
+	if receipt, err := queued.Wait(context.Background()); err != nil || receipt.Status != StatusCommitted {
+		t.Errorf("queued delivery = %+v, %v", receipt, err)
+	}
+	if !transport.closed {
+		t.Error("Close() did not close the transport")
+	}
+
+	late := client.Send(Entry{Source: "app", Content: "late"})
+	if receipt, err := late.Wait(context.Background()); !errors.Is(err, ErrClientClosed) || receipt.Status != StatusFailed {
+		t.Errorf("Send() after Close = %+v, %v", receipt, err)
+	}
+	if err := client.Flush(context.Background()); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("Flush() after Close error = %v", err)
+	}
+}
+
+func TestClientCloseUnblocksSenders(t *testing.T) {
+	transport := &fakeTransport{}
+	client := NewClient(transport, Options{BatchSize: 100, QueueSize: 1, FlushInterval: time.Hour})
+
+	var wg sync.WaitGroup
+	deliveries := make([]*Delivery, 10)
+	for i := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			deliveries[i] = client.Send(Entry{Source: "app", Content: strconv.Itoa(i)})
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Close(ctx); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	wg.Wait()
+
+	// every entry is either delivered or refused, none is left hanging
+	for i, delivery := range deliveries {
+		select {
+		case <-delivery.Done():
+		default:
+			t.Errorf("delivery %d is unresolved", i)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Package fabric delivers SDK entries straight to Fabric. It lives in its own
+// module so that applications sending through the gateway do not depend on
+// the database and Fabric client libraries.
+package fabric
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"log-client/internal"
+	"log-client/sdk"
+)
+
+// Transport stores and anchors entries itself, without a gateway. It needs
+// the same database and Fabric settings as the gateway and transacts as the
+// identity mapped to each entry's source.
+type Transport struct {
+	connection *internal.Connection
+	writer     *internal.Writer
+	async      bool
+}
+
+// NewTransport connects to the Fabric peers. With async, receipts are
+// returned as soon as entries are stored. Cancelling ctx aborts submissions
+// still waiting on the ledger.
+func NewTransport(ctx context.Context, async bool) (*Transport, error) {
+	connection, err := internal.GetConnection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Fabric: %w", err)
+	}
+
+	return &Transport{
+		connection: connection,
+		writer:     internal.NewWriter(ctx, connection),
+		async:      async,
+	}, nil
+}
+
+func (t *Transport) Send(ctx context.Context, entries []sdk.Entry) ([]sdk.Receipt, error) {
+	inputs := make([]internal.LogInput, len(entries))
+	for i, entry := range entries {
+		inputs[i] = logInput(entry)
+	}
+
+	receipts := make([]sdk.Receipt, 0, len(entries))
+	for _, receipt := range t.writer.IngestBatch(inputs, t.async) {
+		receipts = append(receipts, sdkReceipt(receipt))
+	}
+	return receipts, nil
+}
+
+func (t *Transport) Receipt(ctx context.Context, token string) (sdk.Receipt, error) {
+	receipt, err := internal.LoadReceipt(token)
+	if err != nil {
+		return sdk.Receipt{}, err
+	}
+	return sdkReceipt(*receipt), nil
+}
+
+func logInput(entry sdk.Entry) internal.LogInput {
+	return internal.LogInput{
+		Source:         entry.Source,
+		Content:        entry.Content,
+		EventTime:      entry.EventTime,
+		Labels:         entry.Labels,
+		IdempotencyKey: entry.IdempotencyKey,
+		Parser:         entry.Parser,
+	}
+}
+
+func sdkReceipt(receipt internal.Receipt) sdk.Receipt {
+	return sdk.Receipt{
+		EntryID:      receipt.EntryID,
+		Source:       receipt.Source,
+		LogID:        receipt.LogID,
+		TxID:         receipt.TxID,
+		Status:       receipt.Status,
+		PendingToken: receipt.PendingToken,
+		Duplicate:    receipt.Duplicate,
+		Error:        receipt.Error,
+	}
+}
+
+// Close waits for entries still being anchored and closes the connections.
+func (t *Transport) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), internal.ShutdownTimeout)
+	defer cancel()
+
+	return errors.Join(t.writer.Drain(ctx), t.connection.Close(), internal.CloseDB())
+}
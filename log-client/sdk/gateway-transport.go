@@ -0,0 +1,114 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// gatewayBatchLimit is the most entries the gateway accepts per batch.
+const gatewayBatchLimit = 1000
+
+// GatewayConfig configures delivery through the API gateway.
+type GatewayConfig struct {
+	// URL is the base URL of the gateway, e.g. http://localhost:3001.
+	URL string
+	// APIKey or Token (a JWT) authenticate the client when the gateway
+	// requires authentication.
+	APIKey string
+	Token  string
+	// Async returns pending receipts as soon as entries are stored instead of
+	// waiting for their commit.
+	Async bool
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// GatewayTransport sends batches to POST /log/batch of the API gateway.
+type GatewayTransport struct {
+	config GatewayConfig
+}
+
+// NewGatewayTransport creates a transport for the gateway at config.URL.
+func NewGatewayTransport(config GatewayConfig) *GatewayTransport {
+	config.URL = strings.TrimRight(config.URL, "/")
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	return &GatewayTransport{config: config}
+}
+
+func (t *GatewayTransport) Send(ctx context.Context, entries []Entry) ([]Receipt, error) {
+	receipts := make([]Receipt, 0, len(entries))
+	for start := 0; start < len(entries); start += gatewayBatchLimit {
+		end := min(start+gatewayBatchLimit, len(entries))
+
+		body, err := json.Marshal(entries[start:end])
+		if err != nil {
+			return nil, err
+		}
+
+		target := t.config.URL + "/log/batch"
+		if t.config.Async {
+			target += "?async=true"
+		}
+
+		var response struct {
+			Receipts []Receipt `json:"receipts"`
+		}
+		if err := t.do(ctx, http.MethodPost, target, body, &response); err != nil {
+			return nil, err
+		}
+		receipts = append(receipts, response.Receipts...)
+	}
+	return receipts, nil
+}
+
+func (t *GatewayTransport) Receipt(ctx context.Context, token string) (Receipt, error) {
+	var receipt Receipt
+	err := t.do(ctx, http.MethodGet, t.config.URL+"/log/receipt/"+url.PathEscape(token), nil, &receipt)
+	return receipt, err
+}
+
+func (t *GatewayTransport) Close() error {
+	t.config.HTTPClient.CloseIdleConnections()
+	return nil
+}
+
+func (t *GatewayTransport) do(ctx context.Context, method string, target string, body []byte, result any) error {
+	request, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if t.config.APIKey != "" {
+		request.Header.Set("X-API-Key", t.config.APIKey)
+	}
+	if t.config.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+t.config.Token)
+	}
+
+	response, err := t.config.HTTPClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to reach gateway: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(response.Body).Decode(&failure)
+		return fmt.Errorf("gateway returned %s: %s", response.Status, failure.Error)
+	}
+	if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode gateway response: %w", err)
+	}
+	return nil
+}
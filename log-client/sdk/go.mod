@@ -0,0 +1,3 @@
+module log-client/sdk
+
+go 1.23.0
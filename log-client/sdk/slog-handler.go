@@ -0,0 +1,94 @@
+package sdk
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+)
+
+// HandlerOptions configures a Handler.
+type HandlerOptions struct {
+	// Level is the minimum level logged, slog.LevelInfo by default.
+	Level slog.Leveler
+}
+
+// Handler is a slog.Handler that sends every record as an entry of source.
+// The message is the entry's content, the record time its event time and the
+// level and attributes are kept as labels, with groups joined by dots.
+type Handler struct {
+	client *Client
+	source string
+	level  slog.Leveler
+	labels map[string]string
+	prefix string
+}
+
+// NewHandler creates a handler sending records through client.
+func NewHandler(client *Client, source string, options *HandlerOptions) *Handler {
+	h := &Handler{client: client, source: source, level: slog.LevelInfo, labels: map[string]string{}}
+	if options != nil && options.Level != nil {
+		h.level = options.Level
+	}
+	return h
+}
+
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle queues the record without waiting for its delivery.
+func (h *Handler) Handle(_ context.Context, record slog.Record) error {
+	labels := maps.Clone(h.labels)
+	labels["level"] = record.Level.String()
+	record.Attrs(func(attr slog.Attr) bool {
+		addAttrLabels(labels, h.prefix, attr)
+		return true
+	})
+
+	entry := Entry{Source: h.source, Content: record.Message, Labels: labels}
+	if !record.Time.IsZero() {
+		eventTime := record.Time
+		entry.EventTime = &eventTime
+	}
+
+	h.client.Send(entry)
+	return nil
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.labels = maps.Clone(h.labels)
+	for _, attr := range attrs {
+		addAttrLabels(clone.labels, h.prefix, attr)
+	}
+	return &clone
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+func addAttrLabels(labels map[string]string, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		// attributes of an unnamed group belong to the enclosing one
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, member := range attr.Value.Group() {
+			addAttrLabels(labels, prefix, member)
+		}
+		return
+	}
+
+	labels[prefix+attr.Key] = attr.Value.String()
+}
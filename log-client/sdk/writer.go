@@ -0,0 +1,46 @@
+package sdk
+
+import (
+	"bytes"
+	"sync"
+)
+
+// Writer is an io.Writer sending each line written to it as an entry of
+// source, for use with the standard log package:
+//
+//	log.SetOutput(sdk.NewWriter(client, "billing"))
+type Writer struct {
+	client *Client
+	source string
+
+	mu      sync.Mutex
+	partial []byte
+}
+
+// NewWriter creates a writer sending lines through client.
+func NewWriter(client *Client, source string) *Writer {
+	return &Writer{client: client, source: source}
+}
+
+// Write queues every complete line of p. A trailing partial line is kept until
+// the rest of it is written.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.partial = append(w.partial, p...)
+	for {
+		end := bytes.IndexByte(w.partial, '\n')
+		if end < 0 {
+			break
+		}
+
+		line := bytes.TrimSpace(w.partial[:end])
+		if len(line) > 0 {
+			w.client.Send(Entry{Source: w.source, Content: string(line)})
+		}
+		w.partial = w.partial[end+1:]
+	}
+
+	return len(p), nil
+}
@@ -1,5 +1,5 @@
 import { Table, TableBody, TableCell, TableHead, TableHeader, TableRow } from "@/components/ui/table";
-import { API_BASE_URL } from "@/constants";
+import { API_BASE_URL, authHeaders } from "@/constants";
 import { useInfiniteQuery } from "@tanstack/react-query";
 import { useState } from "react";
 import LogFilters from "./log-filters";
@@ -9,7 +9,11 @@ interface Log {
   Timestamp: string;
   Content: string;
   IsValid: boolean;
+  TamperedFields: string[] | null;
+  Shredded: boolean;
   Source: string;
+  LastVerifiedAt: string | null;
+  VerificationResult: string;
 }
 
 interface LogsResponse {
@@ -53,7 +57,7 @@ function Logs() {
       if (filtersKey.startDate) params.append('startDate', String(filtersKey.startDate))
       if (filtersKey.endDate) params.append('endDate', String(filtersKey.endDate))
 
-      const res = await fetch(`${API_BASE_URL}/log?` + params.toString())
+      const res = await fetch(`${API_BASE_URL}/log?` + params.toString(), { headers: authHeaders() })
       return res.json()
     },
     getNextPageParam: (lastPage: LogsResponse) => lastPage.hasNextPage ? lastPage.bookmark : null,
@@ -69,6 +73,7 @@ function Logs() {
             <TableHead className="w-[100px]">Verified</TableHead>
             <TableHead className="w-[100px]">Client</TableHead>
             <TableHead className="w-[100px]">Timestamp</TableHead>
+            <TableHead className="w-[150px]">Last Scanned</TableHead>
           </TableRow>
         </TableHeader>
         <TableBody>
@@ -84,10 +89,21 @@ function Logs() {
             ) : (
               data?.pages?.flatMap(page => (page as LogsResponse).logs)?.map((log, index) => (
                 <TableRow key={index} className={log.IsValid ? undefined : 'bg-red-100/60 hover:bg-red-200/70'}>
-                  <TableCell>{log.Content}</TableCell>
-                  <TableCell>{log.IsValid ? 'Yes' : 'No'}</TableCell>
+                  <TableCell>{log.Shredded ? <em>Erased (data key shredded)</em> : log.Content}</TableCell>
+                  <TableCell>
+                    {log.IsValid
+                      ? 'Yes'
+                      : log.TamperedFields?.length
+                        ? `No (changed: ${log.TamperedFields.join(', ')})`
+                        : 'No'}
+                  </TableCell>
                   <TableCell>{log.Source}</TableCell>
                   <TableCell>{new Date(log.Timestamp).toLocaleString()}</TableCell>
+                  <TableCell>
+                    {log.LastVerifiedAt
+                      ? `${log.VerificationResult} (${new Date(log.LastVerifiedAt).toLocaleString()})`
+                      : 'Not yet'}
+                  </TableCell>
                 </TableRow>
               ))
             )
@@ -3,7 +3,7 @@ import { Button } from "./ui/button"
 import { Input } from "./ui/input"
 import { Label } from "./ui/label"
 import { useMutation, useQuery, useQueryClient } from "@tanstack/react-query"
-import { API_BASE_URL } from "@/constants"
+import { API_BASE_URL, authHeaders } from "@/constants"
 import { Alert, AlertDescription, AlertTitle } from "./ui/alert"
 import { AlertCircleIcon } from "lucide-react"
 
@@ -13,7 +13,7 @@ function Settings() {
   const query = useQuery({
     queryKey: ['log-path'],
     queryFn: async () => {
-      return await (await fetch(`${API_BASE_URL}/settings/log`)).json()
+      return await (await fetch(`${API_BASE_URL}/settings/log`, { headers: authHeaders() })).json()
     }
   })
 
@@ -23,6 +23,7 @@ function Settings() {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
+          ...authHeaders(),
         },
         body: JSON.stringify({ path: editingPath })
       })
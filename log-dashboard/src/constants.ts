@@ -1 +1,11 @@
-export const API_BASE_URL = 'http://localhost:3001';
+export const API_BASE_URL = import.meta.env.VITE_API_BASE_URL ?? 'http://localhost:3001';
+
+// credentials sent to the gateway when it requires authentication
+const API_KEY: string | undefined = import.meta.env.VITE_API_KEY;
+const API_TOKEN: string | undefined = import.meta.env.VITE_API_TOKEN;
+
+export function authHeaders(): Record<string, string> {
+  if (API_TOKEN) return { Authorization: `Bearer ${API_TOKEN}` };
+  if (API_KEY) return { 'X-API-Key': API_KEY };
+  return {};
+}
@@ -4,6 +4,7 @@
 pushd ./log-client
 go mod tidy
 go build -o gateway ./cmd/gateway/main.go
+go run ./cmd/migrate/main.go up
 popd
 
 # run frontend